@@ -2,7 +2,9 @@ package database
 
 import (
 	"database/sql"
-	_ "github.com/go-sql-driver/mysql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
 	"github.com/iancoleman/strcase"
 	"github.com/jmoiron/sqlx"
 	"peec/database/db"
@@ -15,26 +17,68 @@ const (
 	maxOpenConnexion     = 120
 	maxIdleConnexion     = 8
 	maxConnexionLifeTime = time.Minute
+
+	// duplicateEntryError is the MySQL error raised when an insert or update violates a unique index.
+	duplicateEntryError = 1062
 )
 
-var Client *sqlx.DB
+// DeletedClause matches the soft deleted rows, the others holding NULL or the '0000-00-00' default in deleted_at.
+const DeletedClause = "deleted_at > '1000-01-01'"
+
+// NotDeleted returns the condition matching the live rows of table. Queries over soft deleted tables add it for
+// the table they read and for each table they join.
+func NotDeleted(table string) string {
+	return fmt.Sprintf("(%s.deleted_at IS NULL OR NOT %s.%s)", table, table, DeletedClause)
+}
+
+// IsDuplicate tells whether err is the violation of a unique index.
+func IsDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == duplicateEntryError
+}
+
+// DB is the connexion pool of the application. Client is left reachable for the statements the helpers don't
+// cover, such as an UPDATE whose affected rows matter.
+type DB struct {
+	Client *sqlx.DB
+}
 
-func init() {
-	var err error
-	Client, err = sqlx.Connect(defaultDriver, configuration.App.DatabaseConnexionString)
+// Connect opens the pool described by config. Every connection of the pool runs with an empty sql_mode: the tables
+// default their dates to '0000-00-00 00:00:00', which the strict modes of MySQL 8 refuse, both in the migrations and
+// in the inserts that leave deleted_at to its default.
+func Connect(config configuration.Config) (d *DB, err error) {
+	dsn, err := mysql.ParseDSN(config.DatabaseConnexionString)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	Client.SetMaxOpenConns(maxOpenConnexion)
-	Client.SetMaxIdleConns(maxIdleConnexion)
-	Client.SetConnMaxLifetime(maxConnexionLifeTime)
-	Client.MapperFunc(strcase.ToSnake)
+	if dsn.Params == nil {
+		dsn.Params = map[string]string{}
+	}
+	dsn.Params["sql_mode"] = "''"
+
+	client, err := sqlx.Connect(defaultDriver, dsn.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetMaxOpenConns(maxOpenConnexion)
+	client.SetMaxIdleConns(maxIdleConnexion)
+	client.SetConnMaxLifetime(maxConnexionLifeTime)
+	client.MapperFunc(strcase.ToSnake)
+
+	return &DB{Client: client}, nil
+}
+
+// Close closes the pool.
+func (d *DB) Close() error {
+	return d.Client.Close()
 }
 
-func Insert(T any) (lastId int64, err error) {
+func (d *DB) Insert(T any) (lastId int64, err error) {
 	var result sql.Result
-	result, err = Client.Exec(db.I(T))
+	q, args := db.I(T)
+	result, err = d.Client.Exec(q, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -47,25 +91,27 @@ func Insert(T any) (lastId int64, err error) {
 	return lastId, err
 }
 
-func Select(R any, Q string, A ...any) (err error) {
-	err = Client.Select(R, Q, A...)
+// Select reads the rows of Q into R. Nothing is filtered here: Q leaves out the soft deleted rows of every table it
+// reads, see NotDeleted, unless it lists them on purpose.
+func (d *DB) Select(R any, Q string, A ...any) (err error) {
+	err = d.Client.Select(R, Q, A...)
 	if err != nil {
 		return err
 	}
-
 	return err
 }
 
-func Get(R any, Q string, A ...any) (err error) {
-	err = Client.Get(R, Q, A...)
+// Get reads the first row of Q into R. Like Select, it leaves the soft deleted rows to the NotDeleted conditions of Q.
+func (d *DB) Get(R any, Q string, A ...any) (err error) {
+	err = d.Client.Get(R, Q, A...)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func InsertOne(T any) (id uint, err error) {
-	lastId, err := Insert(T)
+func (d *DB) InsertOne(T any) (id uint, err error) {
+	lastId, err := d.Insert(T)
 	if err != nil {
 		return 0, err
 	}
@@ -73,16 +119,42 @@ func InsertOne(T any) (id uint, err error) {
 	return uint(lastId), err
 }
 
-func Update(T any) (err error) {
-	_, err = Client.Exec(db.U(T))
+func (d *DB) Update(T any) (err error) {
+	q, args := db.U(T)
+	_, err = d.Client.Exec(q, args...)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// Delete soft deletes T: its deleted_at is set, and the queries filtering with NotDeleted don't return it anymore.
+func (d *DB) Delete(T any) (err error) {
+	q, args := db.D(T)
+	_, err = d.Client.Exec(q, args...)
 	if err != nil {
 		return err
 	}
+
+	return err
+}
+
+// HardDelete removes the row of T for good. It is meant for link rows whose unique keys would otherwise prevent
+// creating them again.
+func (d *DB) HardDelete(T any) (err error) {
+	q, args := db.HD(T)
+	_, err = d.Client.Exec(q, args...)
+	if err != nil {
+		return err
+	}
+
 	return err
 }
 
-func Delete(T any) (err error) {
-	_, err = Client.Exec(db.D(T))
+// Restore clears the deleted_at of T.
+func (d *DB) Restore(T any) (err error) {
+	q, args := db.R(T)
+	_, err = d.Client.Exec(q, args...)
 	if err != nil {
 		return err
 	}
@@ -90,17 +162,17 @@ func Delete(T any) (err error) {
 	return err
 }
 
-func Exec(Q string, A ...any) (err error) {
-	_, err = Client.Exec(Q, A...)
+func (d *DB) Exec(Q string, A ...any) (err error) {
+	_, err = d.Client.Exec(Q, A...)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func InsertMany(T []any) (err error) {
+func (d *DB) InsertMany(T []any) (err error) {
 	for i := 0; i < len(T); i++ {
-		_, err = InsertOne(T[i])
+		_, err = d.InsertOne(T[i])
 		if err != nil {
 			return err
 		}
@@ -108,8 +180,8 @@ func InsertMany(T []any) (err error) {
 	return err
 }
 
-func GetMany(R interface{}, Q string, A ...interface{}) (err error) {
-	err = Client.Select(R, Q, A...)
+func (d *DB) GetMany(R interface{}, Q string, A ...interface{}) (err error) {
+	err = d.Client.Select(R, Q, A...)
 	if err != nil {
 		return err
 	}
@@ -5,6 +5,7 @@ import (
 	"github.com/fatih/structs"
 	"github.com/iancoleman/strcase"
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -16,70 +17,96 @@ func skipSpecialField(field *structs.Field) bool {
 	return asName || asTag
 }
 
-func D(T any) (q string) {
+// value returns the argument bound for the field. Nil pointers and zero times are NULL, other pointers are
+// dereferenced. ok is false for the fields which are not columns, like nested structs.
+func value(field *structs.Field) (arg any, ok bool) {
+	v := reflect.ValueOf(field.Value())
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, true
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		t, isTime := v.Interface().(time.Time)
+		if !isTime {
+			return nil, false
+		}
+		if t.IsZero() {
+			return nil, true
+		}
+		return t, true
+	}
+
+	return v.Interface(), true
+}
+
+// D returns the query soft deleting the row of T, by id: deleted_at is set and the row is kept.
+func D(T any) (q string, args []any) {
+	t := structs.New(T)
+	q = fmt.Sprintf("update %s set deleted_at = UTC_TIMESTAMP() where id = ?", strcase.ToSnake(t.Name()))
+	return q, []any{t.Field("Id").Value()}
+}
+
+// HD returns the query deleting the row of T for good, by id.
+func HD(T any) (q string, args []any) {
 	t := structs.New(T)
-	q = fmt.Sprintf("delete from %s  ", strcase.ToSnake(t.Name()))
-	return q + fmt.Sprintf(" where id = %d", t.Field("Id").Value())
+	q = fmt.Sprintf("delete from %s where id = ?", strcase.ToSnake(t.Name()))
+	return q, []any{t.Field("Id").Value()}
 }
 
-func U(T any) (q string) {
+// R returns the query restoring the soft deleted row of T, by id.
+func R(T any) (q string, args []any) {
 	t := structs.New(T)
-	q = fmt.Sprintf("update %s set ", strcase.ToSnake(t.Name()))
-	v := t.Fields()
-	for i := 0; i < len(v); i++ {
-		if skipSpecialField(v[i]) {
+	q = fmt.Sprintf("update %s set deleted_at = NULL where id = ?", strcase.ToSnake(t.Name()))
+	return q, []any{t.Field("Id").Value()}
+}
+
+// U returns the query updating every column of the row of T, by id. Nil pointers and zero times are set to NULL.
+func U(T any) (q string, args []any) {
+	t := structs.New(T)
+	var columns []string
+
+	for _, field := range t.Fields() {
+		if skipSpecialField(field) {
 			continue
 		}
 
-		switch v[i].Kind() {
-		case reflect.String:
-			q += fmt.Sprintf("%s = '%s',", strcase.ToSnake(v[i].Name()), v[i].Value())
-			break
-		case reflect.Struct:
-			if w, ok := v[i].Value().(time.Time); ok {
-				q += fmt.Sprintf("%s = '%s',", strcase.ToSnake(v[i].Name()), w.Format(time.DateTime))
-			}
-			break
-		default:
-			q += fmt.Sprintf("%s = %v,", strcase.ToSnake(v[i].Name()), v[i].Value())
-			break
+		arg, ok := value(field)
+		if !ok {
+			continue
 		}
+
+		columns = append(columns, strcase.ToSnake(field.Name())+" = ?")
+		args = append(args, arg)
 	}
 
-	return q[:len(q)-1] + fmt.Sprintf(" where id = %d", t.Field("Id").Value())
+	q = fmt.Sprintf("update %s set %s where id = ?", strcase.ToSnake(t.Name()), strings.Join(columns, ", "))
+	return q, append(args, t.Field("Id").Value())
 }
 
-func I(T any) (q string) {
+// I returns the query inserting T. Nil pointers and zero times are left out, so that the column default applies.
+func I(T any) (q string, args []any) {
 	t := structs.New(T)
-	q = fmt.Sprintf("insert into %s (", strcase.ToSnake(t.Name()))
-	v := t.Fields()
-	for i := 0; i < len(v); i++ {
-		if skipSpecialField(v[i]) {
+	var columns, placeholders []string
+
+	for _, field := range t.Fields() {
+		if skipSpecialField(field) {
 			continue
 		}
-		q += fmt.Sprintf("%s,", strcase.ToSnake(v[i].Name()))
-	}
-	q = q[:len(q)-1] + ") VALUES ("
-	for i := 0; i < len(v); i++ {
-		if skipSpecialField(v[i]) {
+
+		arg, ok := value(field)
+		if !ok || arg == nil {
 			continue
 		}
-		switch v[i].Kind() {
-		case reflect.String:
-			q += fmt.Sprintf("'%s',", v[i].Value())
-			break
-		case reflect.Struct:
-			if w, ok := v[i].Value().(time.Time); ok {
-				q += fmt.Sprintf("'%s',", w.Format(time.DateTime))
-			}
-			break
-		default:
-			q += fmt.Sprintf("%v,", v[i].Value())
-			break
-		}
-	}
 
-	q = q[:len(q)-1] + ")"
+		columns = append(columns, strcase.ToSnake(field.Name()))
+		placeholders = append(placeholders, "?")
+		args = append(args, arg)
+	}
 
-	return q
+	q = fmt.Sprintf("insert into %s (%s) VALUES (%s)", strcase.ToSnake(t.Name()), strings.Join(columns, ","), strings.Join(placeholders, ","))
+	return q, args
 }
@@ -0,0 +1,33 @@
+set foreign_key_checks = 0;
+
+drop table if exists user_post;
+
+drop table if exists post;
+
+drop table if exists user_education_level_subject;
+
+drop table if exists subject;
+
+drop table if exists education;
+
+drop table if exists qr_code_registry;
+
+drop table if exists user_media_detail;
+
+drop table if exists media_thumb;
+
+drop table if exists user_address;
+
+drop table if exists address;
+
+drop table if exists code;
+
+drop table if exists media;
+
+drop table if exists password;
+
+drop table if exists authorization;
+
+drop table if exists user;
+
+set foreign_key_checks = 1;
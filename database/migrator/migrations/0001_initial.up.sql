@@ -1,8 +1,4 @@
-drop database if exists peec;
-set sql_mode = '';
-create database peec;
-use peec;
-
+-- Schema of the application before versioned migrations.
 create table user
 (
     id          int auto_increment
@@ -248,4 +244,4 @@ create table user_post
     updated_at datetime     default CURRENT_TIMESTAMP,
     post_id int default 0,
     user_id int default 0
-);
\ No newline at end of file
+);
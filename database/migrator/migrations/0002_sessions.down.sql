@@ -0,0 +1,3 @@
+drop table if exists refresh_token;
+
+drop table if exists session;
@@ -0,0 +1,39 @@
+-- SESSION
+create table session
+(
+    id           int primary key auto_increment,
+    created_at   datetime     default CURRENT_TIMESTAMP,
+    updated_at   datetime     default CURRENT_TIMESTAMP,
+    deleted_at   datetime     default '0000-00-00 00:00:00',
+    user_id      int          default 0,
+    xid          varchar(100) default '' unique,
+    device       varchar(500) default '',
+    ip           varchar(100) default '',
+    active_level int          default 0,
+    last_seen_at datetime     default CURRENT_TIMESTAMP,
+    expires_at   datetime     default CURRENT_TIMESTAMP,
+    is_revoked   boolean      default false,
+    foreign key (user_id) references user (id)
+);
+
+create index session_user_id_index
+    on session (user_id);
+
+-- REFRESH TOKEN
+create table refresh_token
+(
+    id         int primary key auto_increment,
+    created_at datetime     default CURRENT_TIMESTAMP,
+    updated_at datetime     default CURRENT_TIMESTAMP,
+    deleted_at datetime     default '0000-00-00 00:00:00',
+    user_id    int          default 0,
+    family     varchar(100) default '',
+    token_hash varchar(64)  default '' unique,
+    expires_at datetime     default CURRENT_TIMESTAMP,
+    is_used    boolean      default false,
+    is_revoked boolean      default false,
+    foreign key (user_id) references user (id)
+);
+
+create index refresh_token_family_index
+    on refresh_token (family);
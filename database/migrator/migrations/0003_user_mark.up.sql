@@ -0,0 +1,14 @@
+-- USER MARK
+-- The table may already exist on databases built before this migration, where it was created by hand.
+create table if not exists user_mark
+(
+    id                      int primary key auto_increment,
+    created_at              datetime      default CURRENT_TIMESTAMP,
+    updated_at              datetime      default CURRENT_TIMESTAMP,
+    deleted_at              datetime      default '0000-00-00 00:00:00',
+    user_id                 int           default 0,
+    author_id               int           default 0,
+    author_authorization_id int           default 0,
+    author_comment          varchar(5000) default '',
+    author_mark             int           default 0
+);
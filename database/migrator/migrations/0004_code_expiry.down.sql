@@ -0,0 +1,5 @@
+alter table code
+    drop column purpose,
+    drop column expires_at,
+    drop column attempts,
+    drop column is_used;
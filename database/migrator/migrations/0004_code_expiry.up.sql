@@ -0,0 +1,6 @@
+-- CODE EXPIRY
+alter table code
+    add purpose    int      default 0,
+    add expires_at datetime default '0000-00-00 00:00:00',
+    add attempts   int      default 0,
+    add is_used    boolean  default false;
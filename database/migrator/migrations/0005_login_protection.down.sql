@@ -0,0 +1,5 @@
+drop table if exists lockout_event;
+
+drop table if exists lockout;
+
+drop table if exists login_attempt;
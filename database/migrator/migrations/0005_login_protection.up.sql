@@ -0,0 +1,43 @@
+-- LOGIN BRUTE-FORCE PROTECTION
+create table login_attempt
+(
+    id         int primary key auto_increment,
+    created_at datetime     default CURRENT_TIMESTAMP,
+    updated_at datetime     default CURRENT_TIMESTAMP,
+    deleted_at datetime     default '0000-00-00 00:00:00',
+    user_id    int          default 0,
+    ip         varchar(100) default '',
+    is_success boolean      default false,
+    is_cleared boolean      default false
+);
+
+create index login_attempt_user_id_index
+    on login_attempt (user_id, created_at);
+
+create index login_attempt_ip_index
+    on login_attempt (ip, created_at);
+
+create table lockout
+(
+    id           int primary key auto_increment,
+    created_at   datetime     default CURRENT_TIMESTAMP,
+    updated_at   datetime     default CURRENT_TIMESTAMP,
+    deleted_at   datetime     default '0000-00-00 00:00:00',
+    user_id      int          default 0,
+    ip           varchar(100) default '',
+    locked_until datetime     default CURRENT_TIMESTAMP,
+    reason       varchar(500) default ''
+);
+
+create table lockout_event
+(
+    id         int primary key auto_increment,
+    created_at datetime     default CURRENT_TIMESTAMP,
+    updated_at datetime     default CURRENT_TIMESTAMP,
+    deleted_at datetime     default '0000-00-00 00:00:00',
+    user_id    int          default 0,
+    ip         varchar(100) default '',
+    action     varchar(20)  default '',
+    reason     varchar(500) default '',
+    actor_id   int          default 0
+);
@@ -0,0 +1,3 @@
+drop table if exists recovery_code;
+
+drop table if exists two_factor;
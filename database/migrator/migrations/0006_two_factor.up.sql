@@ -0,0 +1,28 @@
+-- TWO FACTOR AUTHENTICATION
+create table two_factor
+(
+    id             int primary key auto_increment,
+    created_at     datetime    default CURRENT_TIMESTAMP,
+    updated_at     datetime    default CURRENT_TIMESTAMP,
+    deleted_at     datetime    default '0000-00-00 00:00:00',
+    user_id        int         default 0,
+    secret         varchar(64) default '',
+    is_enabled     boolean     default false,
+    last_used_step bigint      default 0,
+    constraint two_factor_user_id_uindex
+        unique (user_id)
+);
+
+create table recovery_code
+(
+    id         int primary key auto_increment,
+    created_at datetime    default CURRENT_TIMESTAMP,
+    updated_at datetime    default CURRENT_TIMESTAMP,
+    deleted_at datetime    default '0000-00-00 00:00:00',
+    user_id    int         default 0,
+    code_hash  varchar(64) default '',
+    is_used    boolean     default false
+);
+
+create index recovery_code_user_id_index
+    on recovery_code (user_id);
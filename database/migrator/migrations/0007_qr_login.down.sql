@@ -0,0 +1,12 @@
+drop table if exists qr_code_registry;
+
+create table qr_code_registry
+(
+    id         int primary key auto_increment,
+    created_at datetime            default CURRENT_TIMESTAMP,
+    deleted_at datetime            default '0000-00-00 00:00:00',
+    user_id    int unique          default 0,
+    xid        varchar(100) unique default '',
+    is_used    boolean,
+    foreign key (user_id) references user (id)
+);
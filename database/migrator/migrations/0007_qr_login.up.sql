@@ -0,0 +1,17 @@
+-- QR LOGIN
+-- Pending QR logins are short-lived, the previous registry is dropped rather than migrated.
+drop table if exists qr_code_registry;
+
+create table qr_code_registry
+(
+    id          int primary key auto_increment,
+    created_at  datetime            default CURRENT_TIMESTAMP,
+    updated_at  datetime            default CURRENT_TIMESTAMP,
+    deleted_at  datetime            default '0000-00-00 00:00:00',
+    user_id     int                 default 0,
+    xid         varchar(100) unique default '',
+    secret_hash varchar(64)         default '',
+    expires_at  datetime            default '0000-00-00 00:00:00',
+    is_approved boolean             default false,
+    is_used     boolean             default false
+);
@@ -0,0 +1,4 @@
+drop table if exists phone_number;
+
+alter table code
+    drop column reference;
@@ -0,0 +1,19 @@
+-- PHONE NUMBERS
+alter table code
+    add reference int default 0;
+
+-- The table may already exist on databases built before this migration, where it was created by hand.
+create table if not exists phone_number
+(
+    id                  int primary key auto_increment,
+    created_at          datetime    default CURRENT_TIMESTAMP,
+    updated_at          datetime    default CURRENT_TIMESTAMP,
+    deleted_at          datetime    default '0000-00-00 00:00:00',
+    user_id             int         default 0,
+    mobile_phone_number varchar(16) default '',
+    is_urgency          boolean     default false,
+    is_primary          boolean     default false,
+    is_verified         boolean     default false,
+    constraint phone_number_user_id_mobile_phone_number_uindex
+        unique (user_id, mobile_phone_number)
+);
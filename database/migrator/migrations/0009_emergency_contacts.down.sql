@@ -0,0 +1,10 @@
+drop table if exists emergency_contact_access;
+
+drop table if exists emergency_contact;
+
+delete from phone_number where is_urgency = true;
+
+alter table phone_number
+    drop index phone_number_user_id_mobile_phone_number_uindex,
+    add constraint phone_number_user_id_mobile_phone_number_uindex
+        unique (user_id, mobile_phone_number);
@@ -0,0 +1,38 @@
+-- EMERGENCY CONTACTS
+-- Urgency numbers belong to emergency contacts and may repeat a number of the user.
+alter table phone_number
+    drop index phone_number_user_id_mobile_phone_number_uindex,
+    add constraint phone_number_user_id_mobile_phone_number_uindex
+        unique (user_id, mobile_phone_number, is_urgency);
+
+create table emergency_contact
+(
+    id              int primary key auto_increment,
+    created_at      datetime     default CURRENT_TIMESTAMP,
+    updated_at      datetime     default CURRENT_TIMESTAMP,
+    deleted_at      datetime     default '0000-00-00 00:00:00',
+    user_id         int          default 0,
+    phone_number_id int          default 0,
+    name            varchar(255) default '',
+    relationship    varchar(20)  default '',
+    priority        int          default 1
+);
+
+create index emergency_contact_user_id_index
+    on emergency_contact (user_id);
+
+create table emergency_contact_access
+(
+    id                      int primary key auto_increment,
+    created_at              datetime     default CURRENT_TIMESTAMP,
+    updated_at              datetime     default CURRENT_TIMESTAMP,
+    deleted_at              datetime     default '0000-00-00 00:00:00',
+    emergency_contact_id    int          default 0,
+    user_id                 int          default 0,
+    viewer_id               int          default 0,
+    viewer_authorization_id int          default 0,
+    ip                      varchar(100) default ''
+);
+
+create index emergency_contact_access_user_id_index
+    on emergency_contact_access (user_id, created_at);
@@ -0,0 +1,3 @@
+drop table if exists user_follow;
+
+drop table if exists notification;
@@ -0,0 +1,30 @@
+-- NOTIFICATIONS
+create table notification
+(
+    id           int primary key auto_increment,
+    created_at   datetime      default CURRENT_TIMESTAMP,
+    updated_at   datetime      default CURRENT_TIMESTAMP,
+    deleted_at   datetime      default '0000-00-00 00:00:00',
+    user_id      int           default 0,
+    actor_id     int           default 0,
+    type         varchar(50)   default '',
+    reference_id int           default 0,
+    message      varchar(1000) default '',
+    is_read      boolean       default false,
+    read_at      datetime      null
+);
+
+create index notification_user_id_index
+    on notification (user_id, is_read, created_at);
+
+create table user_follow
+(
+    id          int primary key auto_increment,
+    created_at  datetime default CURRENT_TIMESTAMP,
+    updated_at  datetime default CURRENT_TIMESTAMP,
+    deleted_at  datetime default '0000-00-00 00:00:00',
+    follower_id int      default 0,
+    followed_id int      default 0,
+    constraint user_follow_uindex
+        unique (follower_id, followed_id)
+);
@@ -0,0 +1,3 @@
+drop table if exists notification_setting;
+
+drop table if exists notification_preference;
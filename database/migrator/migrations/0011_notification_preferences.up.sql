@@ -0,0 +1,29 @@
+-- NOTIFICATION PREFERENCES
+create table notification_preference
+(
+    id         int primary key auto_increment,
+    created_at datetime    default CURRENT_TIMESTAMP,
+    updated_at datetime    default CURRENT_TIMESTAMP,
+    deleted_at datetime    default '0000-00-00 00:00:00',
+    user_id    int         default 0,
+    type       varchar(50) default '',
+    in_app     boolean     default true,
+    email      boolean     default false,
+    sms        boolean     default false,
+    constraint notification_preference_uindex
+        unique (user_id, type)
+);
+
+create table notification_setting
+(
+    id                int primary key auto_increment,
+    created_at        datetime     default CURRENT_TIMESTAMP,
+    updated_at        datetime     default CURRENT_TIMESTAMP,
+    deleted_at        datetime     default '0000-00-00 00:00:00',
+    user_id           int          default 0,
+    timezone          varchar(64)  default 'UTC',
+    quiet_hours_start varchar(5)   default '',
+    quiet_hours_end   varchar(5)   default '',
+    constraint notification_setting_uindex
+        unique (user_id)
+);
@@ -0,0 +1,19 @@
+-- OUTBOX
+create table outbox_event
+(
+    id              int primary key auto_increment,
+    created_at      datetime      default CURRENT_TIMESTAMP,
+    updated_at      datetime      default CURRENT_TIMESTAMP,
+    deleted_at      datetime      default '0000-00-00 00:00:00',
+    type            varchar(100)  default '',
+    subscriber      varchar(100)  default '',
+    payload         text,
+    status          varchar(20)   default 'pending',
+    attempts        int           default 0,
+    next_attempt_at datetime      default CURRENT_TIMESTAMP,
+    last_error      varchar(1000) default '',
+    delivered_at    datetime      null
+);
+
+create index outbox_event_status_index
+    on outbox_event (status, next_attempt_at);
@@ -0,0 +1,3 @@
+drop table if exists webhook_delivery;
+
+drop table if exists webhook;
@@ -0,0 +1,32 @@
+-- WEBHOOKS
+create table webhook
+(
+    id          int primary key auto_increment,
+    created_at  datetime      default CURRENT_TIMESTAMP,
+    updated_at  datetime      default CURRENT_TIMESTAMP,
+    deleted_at  datetime      default '0000-00-00 00:00:00',
+    user_id     int           default 0,
+    url         varchar(2048) default '',
+    secret      varchar(255)  default '',
+    event_types varchar(1000) default '',
+    is_active   boolean       default true
+);
+
+create table webhook_delivery
+(
+    id              int primary key auto_increment,
+    created_at      datetime      default CURRENT_TIMESTAMP,
+    updated_at      datetime      default CURRENT_TIMESTAMP,
+    deleted_at      datetime      default '0000-00-00 00:00:00',
+    webhook_id      int           default 0,
+    event_type      varchar(100)  default '',
+    payload         text,
+    status          varchar(20)   default 'pending',
+    attempts        int           default 0,
+    response_status int           default 0,
+    last_error      varchar(1000) default '',
+    delivered_at    datetime      null
+);
+
+create index webhook_delivery_webhook_id_index
+    on webhook_delivery (webhook_id, created_at);
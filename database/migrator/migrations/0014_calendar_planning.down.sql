@@ -0,0 +1,3 @@
+drop table if exists calendar_planning_actor;
+
+drop table if exists calendar_planning;
@@ -0,0 +1,29 @@
+-- CALENDAR PLANNING
+-- The tables may already exist on databases built before this migration, where they were created by hand.
+create table if not exists calendar_planning
+(
+    id               int primary key auto_increment,
+    created_at       datetime      default CURRENT_TIMESTAMP,
+    updated_at       datetime      default CURRENT_TIMESTAMP,
+    deleted_at       datetime      default '0000-00-00 00:00:00',
+    authorization_id int           default 0,
+    start_date_time  datetime      default CURRENT_TIMESTAMP,
+    end_date_time    datetime      default CURRENT_TIMESTAMP,
+    description      varchar(5000) default '',
+    index calendar_planning_authorization_id_index (authorization_id)
+);
+
+create table if not exists calendar_planning_actor
+(
+    id                   int primary key auto_increment,
+    created_at           datetime default CURRENT_TIMESTAMP,
+    updated_at           datetime default CURRENT_TIMESTAMP,
+    deleted_at           datetime default '0000-00-00 00:00:00',
+    authorization_id     int      default 0,
+    calendar_planning_id int      default 0,
+    constraint calendar_planning_actor_uindex
+        unique (calendar_planning_id, authorization_id),
+    constraint calendar_planning_actor_calendar_planning_id_fk
+        foreign key (calendar_planning_id) references calendar_planning (id)
+            on delete cascade
+);
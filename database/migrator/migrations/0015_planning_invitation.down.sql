@@ -0,0 +1,2 @@
+alter table calendar_planning_actor
+    drop column accepted_at;
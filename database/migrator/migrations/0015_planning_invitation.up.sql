@@ -0,0 +1,9 @@
+-- PLANNING INVITATION
+-- An actor takes part in a planning once they accepted the invitation; the author from the start.
+alter table calendar_planning_actor
+    add accepted_at datetime null;
+
+update calendar_planning_actor
+    join calendar_planning on calendar_planning.id = calendar_planning_actor.calendar_planning_id
+set calendar_planning_actor.accepted_at = calendar_planning_actor.created_at
+where calendar_planning_actor.authorization_id = calendar_planning.authorization_id;
@@ -0,0 +1,14 @@
+-- NOTIFICATION DELIVERY
+-- One row per outbox event, recipient and channel the notification went out on, so that retries skip them.
+create table notification_delivery
+(
+    id         int primary key auto_increment,
+    created_at datetime    default CURRENT_TIMESTAMP,
+    updated_at datetime    default CURRENT_TIMESTAMP,
+    deleted_at datetime    default '0000-00-00 00:00:00',
+    event_id   int         default 0,
+    user_id    int         default 0,
+    channel    varchar(20) default '',
+    constraint notification_delivery_uindex
+        unique (event_id, user_id, channel)
+);
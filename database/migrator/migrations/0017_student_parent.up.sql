@@ -0,0 +1,14 @@
+-- STUDENT PARENT
+-- A parent manages the emergency contacts of a student once the student accepted the link.
+create table student_parent
+(
+    id          int primary key auto_increment,
+    created_at  datetime default CURRENT_TIMESTAMP,
+    updated_at  datetime default CURRENT_TIMESTAMP,
+    deleted_at  datetime default '0000-00-00 00:00:00',
+    parent_id   int      default 0,
+    student_id  int      default 0,
+    accepted_at datetime null,
+    constraint student_parent_uindex
+        unique (parent_id, student_id)
+);
@@ -0,0 +1,4 @@
+drop index code_ip_index on code;
+
+alter table code
+    drop column ip;
@@ -0,0 +1,7 @@
+-- CODE IP
+-- The address a code was requested from, to limit how many codes an address is issued.
+alter table code
+    add ip varchar(100) default '';
+
+create index code_ip_index
+    on code (ip, created_at);
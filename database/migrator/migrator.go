@@ -0,0 +1,448 @@
+package migrator
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"peec/database"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migrations are named <version>_<name>.up.sql and <version>_<name>.down.sql. Versions are applied in order,
+// and an applied migration must never be edited: add a new one instead.
+//
+//go:embed migrations/*.sql
+var files embed.FS
+
+const directory = "migrations"
+
+// Migration is one versioned change of the schema, with the script reverting it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaMigration is the row recording an applied migration.
+type SchemaMigration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// MigrationStatus tells whether a migration is applied, and when.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var (
+	ErrSchemaBehind        = errors.New("database schema is behind, run: migrate up")
+	ErrSchemaMissingTables = errors.New("database schema lacks tables the migrations create, was it baselined too far?")
+)
+
+var (
+	createTable = regexp.MustCompile(`(?i)\bcreate\s+table\s+(?:if\s+not\s+exists\s+)?` + "`?" + `(\w+)`)
+	dropTable   = regexp.MustCompile(`(?i)\bdrop\s+table\s+(?:if\s+exists\s+)?` + "`?" + `(\w+)`)
+)
+
+/*
+
+	COMMANDS
+
+*/
+
+// Up applies every pending migration.
+func Up(ctx context.Context, d *database.DB) (applied []Migration, err error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return To(ctx, d, migrations[len(migrations)-1].Version)
+}
+
+// Down reverts the last applied migration.
+func Down(ctx context.Context, d *database.DB) (reverted []Migration, err error) {
+	current, err := Version(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	if current == 0 {
+		return nil, nil
+	}
+
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	target := 0
+	for _, migration := range migrations {
+		if migration.Version < current {
+			target = migration.Version
+		}
+	}
+	return To(ctx, d, target)
+}
+
+// To migrates the schema up or down to version, 0 reverting every migration. It stops at the first failing
+// script: MySQL commits schema changes as they run, so the migration failing is left partly applied and must be
+// fixed by hand.
+func To(ctx context.Context, d *database.DB, version int) (done []Migration, err error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && find(migrations, version) == nil {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	conn, err := connect(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version > version || applied[migration.Version] {
+			continue
+		}
+
+		err = run(ctx, conn, migration.Up)
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s up: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, migration.Version, migration.Name)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= version || !applied[migration.Version] {
+			continue
+		}
+
+		err = run(ctx, conn, migration.Down)
+		if err != nil {
+			return done, fmt.Errorf("migration %04d_%s down: %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Baseline records the migrations up to version as applied without running them. It is meant for a database built
+// by the former migrator.sql script, which holds the schema of version 1. Such a database may also hold the
+// user_mark, phone_number and calendar_planning tables, created by hand before their migrations existed; those
+// migrations only create them when they are missing.
+func Baseline(ctx context.Context, d *database.DB, version int) (err error) {
+	migrations, err := Load()
+	if err != nil {
+		return err
+	}
+
+	if find(migrations, version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	conn, err := connect(ctx, d)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, migration := range migrations {
+		if migration.Version > version {
+			break
+		}
+
+		_, err = conn.ExecContext(ctx, `INSERT IGNORE INTO schema_migrations (version, name) VALUES (?, ?)`, migration.Version, migration.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status lists every known migration along with its state.
+func Status(ctx context.Context, d *database.DB) (statuses []MigrationStatus, err error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := connect(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var rows []SchemaMigration
+	err = conn.SelectContext(ctx, &rows, `SELECT * FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := map[int]time.Time{}
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+
+	for _, migration := range migrations {
+		at, ok := appliedAt[migration.Version]
+		statuses = append(statuses, MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: at,
+		})
+	}
+	return statuses, nil
+}
+
+// Version returns the last applied migration, 0 on an empty schema.
+func Version(ctx context.Context, d *database.DB) (version int, err error) {
+	conn, err := connect(ctx, d)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	err = conn.GetContext(ctx, &version, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	return version, err
+}
+
+// CheckSchema returns ErrSchemaBehind when some migration is not applied, and ErrSchemaMissingTables when a table
+// created by the migrations is missing, which happens when a database is baselined past its actual schema. The
+// server calls it before serving.
+func CheckSchema(ctx context.Context, d *database.DB) (err error) {
+	var existing []string
+
+	statuses, err := Status(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		if !status.Applied {
+			return fmt.Errorf("%w (%04d_%s is pending)", ErrSchemaBehind, status.Version, status.Name)
+		}
+	}
+
+	err = d.Client.SelectContext(ctx, &existing, `SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()`)
+	if err != nil {
+		return err
+	}
+
+	migrations := make([]Migration, 0, len(statuses))
+	for _, status := range statuses {
+		migrations = append(migrations, status.Migration)
+	}
+
+	missing := MissingTables(migrations, existing)
+	if len(missing) > 0 {
+		return fmt.Errorf("%w (missing %s)", ErrSchemaMissingTables, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// MissingTables returns the tables the up scripts of migrations leave behind, in order, that are not in existing.
+func MissingTables(migrations []Migration, existing []string) (missing []string) {
+	var tables []string
+
+	for _, migration := range migrations {
+		for _, statement := range statements(migration.Up) {
+			if match := createTable.FindStringSubmatch(statement); match != nil {
+				tables = append(tables, strings.ToLower(match[1]))
+			}
+			if match := dropTable.FindStringSubmatch(statement); match != nil {
+				tables = slices.DeleteFunc(tables, func(table string) bool { return table == strings.ToLower(match[1]) })
+			}
+		}
+	}
+
+	for _, table := range tables {
+		if !slices.ContainsFunc(existing, func(name string) bool { return strings.EqualFold(name, table) }) {
+			missing = append(missing, table)
+		}
+	}
+	return missing
+}
+
+/*
+
+	UTILS
+
+*/
+
+// Load reads the embedded migrations, sorted by version. Every version needs both its up and down script.
+func Load() (migrations []Migration, err error) {
+	entries, err := fs.ReadDir(files, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s", fileName)
+		}
+
+		rawVersion, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %s", fileName)
+		}
+
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", fileName)
+		}
+
+		b, err := files.ReadFile(path.Join(directory, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(b)
+		} else {
+			migration.Down = string(b)
+		}
+	}
+
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	if len(migrations) == 0 {
+		return nil, errors.New("no migration found")
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// connect returns a dedicated connection, so that the session variables set by the scripts don't leak into the
+// pool, and makes sure the schema_migrations table exists. The connection inherits the sql_mode database.Connect
+// sets on the pool.
+func connect(ctx context.Context, d *database.DB) (conn *sqlx.Conn, err error) {
+	conn, err = d.Client.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version    int primary key,
+			name       varchar(200) default '',
+			applied_at datetime     default CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (applied map[int]bool, err error) {
+	var versions []int
+	err = conn.SelectContext(ctx, &versions, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	applied = map[int]bool{}
+	for _, version := range versions {
+		applied[version] = true
+	}
+	return applied, nil
+}
+
+// run executes the statements of a script one by one, the driver refusing several statements per query.
+func run(ctx context.Context, conn *sqlx.Conn, script string) (err error) {
+	for _, statement := range statements(script) {
+		_, err = conn.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statements splits a script on the semicolons ending a line, dropping the comment lines.
+func statements(script string) (list []string) {
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			list = append(list, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		list = append(list, rest)
+	}
+	return list
+}
+
+func find(migrations []Migration, version int) *Migration {
+	for i := range migrations {
+		if migrations[i].Version == version {
+			return &migrations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package migrator
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLoadEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d is %04d_%s, want consecutive versions from 1", i, migration.Version, migration.Name)
+		}
+		if len(statements(migration.Up)) == 0 || len(statements(migration.Down)) == 0 {
+			t.Errorf("migration %04d_%s has an empty script", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := `-- TITLE
+-- a comment; with a semicolon
+create table a
+(
+    id int
+);
+
+insert into a (id) values (1);
+update a set id = 2`
+
+	got := statements(script)
+	want := []string{
+		"create table a\n(\n    id int\n)",
+		"insert into a (id) values (1)",
+		"update a set id = 2",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("statements = %q, want %q", got, want)
+	}
+}
+
+func TestMissingTables(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Up: "create table user (id int);\nCREATE TABLE IF NOT EXISTS `post` (id int);"},
+		{Version: 2, Up: "create table draft (id int);\nalter table user add name text;"},
+		{Version: 3, Up: "drop table if exists draft;\ncreate table comment (id int);"},
+	}
+
+	missing := MissingTables(migrations, []string{"User", "schema_migrations"})
+	if want := []string{"post", "comment"}; !slices.Equal(missing, want) {
+		t.Errorf("missing = %v, want %v", missing, want)
+	}
+
+	missing = MissingTables(migrations, []string{"user", "post", "comment"})
+	if len(missing) != 0 {
+		t.Errorf("missing = %v, want none, the dropped table included", missing)
+	}
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"peec/database/db"
+)
+
+// WithTx runs fn within a transaction. It is committed when fn returns nil, and rolled back when fn returns an
+// error or panics.
+func (d *DB) WithTx(ctx context.Context, fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := d.Client.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertTx is Insert within tx.
+func InsertTx(tx *sqlx.Tx, T any) (lastId int64, err error) {
+	var result sql.Result
+	q, args := db.I(T)
+	result, err = tx.Exec(q, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	lastId, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return lastId, err
+}
+
+// InsertOneTx is InsertOne within tx.
+func InsertOneTx(tx *sqlx.Tx, T any) (id uint, err error) {
+	lastId, err := InsertTx(tx, T)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(lastId), err
+}
+
+// UpdateTx is Update within tx.
+func UpdateTx(tx *sqlx.Tx, T any) (err error) {
+	q, args := db.U(T)
+	_, err = tx.Exec(q, args...)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// DeleteTx is Delete within tx.
+func DeleteTx(tx *sqlx.Tx, T any) (err error) {
+	q, args := db.D(T)
+	_, err = tx.Exec(q, args...)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// HardDeleteTx is HardDelete within tx.
+func HardDeleteTx(tx *sqlx.Tx, T any) (err error) {
+	q, args := db.HD(T)
+	_, err = tx.Exec(q, args...)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// SelectTx is Select within tx.
+func SelectTx(tx *sqlx.Tx, R any, Q string, A ...any) (err error) {
+	err = tx.Select(R, Q, A...)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// GetTx is Get within tx.
+func GetTx(tx *sqlx.Tx, R any, Q string, A ...any) (err error) {
+	err = tx.Get(R, Q, A...)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// ExecTx is Exec within tx.
+func ExecTx(tx *sqlx.Tx, Q string, A ...any) (err error) {
+	_, err = tx.Exec(Q, A...)
+	if err != nil {
+		return err
+	}
+	return err
+}
@@ -6,6 +6,9 @@ sudo git fetch origin && sudo git reset --hard origin/main
 echo "Building the application ... "
 go build -buildvcs=false
 
+echo "Migrating the database..."
+./peec migrate up || exit 1
+
 echo "Reloading systemd..."
 sudo systemctl daemon-reload
 
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"peec/database"
+	"peec/internal/configuration"
+	"peec/internal/mailer"
+	"peec/internal/outbox"
+	"peec/internal/realtime"
+	"peec/internal/sms"
+	"peec/internal/storage"
+)
+
+// App owns the dependencies shared by the services. It is built once in main and handed to the constructors of the
+// services, which embed it.
+type App struct {
+	Config   configuration.Config
+	DB       *database.DB
+	Mailer   mailer.Mailer
+	Sms      sms.Sender
+	Storage  storage.Storage
+	Realtime *realtime.Broker
+	Outbox   *outbox.Outbox
+}
+
+// New connects to the database and builds the other dependencies from config.
+func New(config configuration.Config) (app *App, err error) {
+	db, err := database.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	texter, err := sms.New(config.Texter())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &App{
+		Config:   config,
+		DB:       db,
+		Mailer:   mailer.New(config.Mailer()),
+		Sms:      texter,
+		Storage:  storage.New(config.Uploads()),
+		Realtime: realtime.New(),
+		Outbox:   outbox.New(db, config.Dispatcher()),
+	}, nil
+}
+
+// Close releases the database connexions.
+func (app *App) Close() error {
+	return app.DB.Close()
+}
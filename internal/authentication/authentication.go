@@ -3,38 +3,108 @@ package authentication
 import (
 	"errors"
 	"peec/database"
-	"peec/internal/configuration"
+	"peec/internal/app"
+	"peec/internal/utils/state"
+	"peec/pkg/user/authorization"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Service issues the tokens and keeps the sessions of the users.
+type Service struct {
+	*app.App
+	authorizations *authorization.Service
+}
+
+// NewService returns the authentication service, reading the roles of the users through authorizations.
+func NewService(a *app.App, authorizations *authorization.Service) *Service {
+	return &Service{App: a, authorizations: authorizations}
+}
+
 type Auth struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+const TokenContextKey = "token"
+
+const (
+	twoFactorAudience          = "two_factor"
+	twoFactorChallengeLifeTime = 5 * time.Minute
+)
+
+// Token carries every authorization level of the user. UserLevel and AuthorizationId refer to the active role,
+// the one the user currently acts as.
 type Token struct {
-	UserId     uint `json:"user_id"`
-	UserLevel  uint `json:"user_level"`
-	UserStatus uint `json:"user_status"`
+	UserId          uint   `json:"user_id"`
+	UserLevel       uint   `json:"user_level"`
+	UserLevels      []uint `json:"user_levels"`
+	AuthorizationId uint   `json:"authorization_id"`
+	UserStatus      uint   `json:"user_status"`
 	jwt.RegisteredClaims
 }
 
-func GetTokenString(userId uint) (str string, err error) {
-	var tok Token
-	err = database.Get(&tok, `SELECT u.id as 'user_id', u.status as 'user_status' FROM user u WHERE u.id = ?`, userId)
+// GetTokenString opens a new session for the user on the requesting device and returns its access token.
+func (s *Service) GetTokenString(ctx *gin.Context, userId uint) (str string, session Session, err error) {
+	session, err = s.NewSession(ctx, userId)
+	if err != nil {
+		return str, session, err
+	}
+
+	str, err = s.GetSessionTokenString(session)
+	if err != nil {
+		return str, session, err
+	}
+
+	return str, session, err
+}
+
+// GetSessionTokenString returns an access token bound to an existing session, the session xid being used as jti.
+func (s *Service) GetSessionTokenString(session Session) (str string, err error) {
+	var (
+		tok   Token
+		auths []authorization.Authorization
+	)
+
+	err = s.DB.Get(&tok, `SELECT u.id as 'user_id', u.status as 'user_status' FROM user u WHERE u.id = ? AND `+database.NotDeleted("u"), session.UserId)
 	if err != nil {
 		return str, err
 	}
 
-	err = database.Get(&tok, `SELECT auth.level as 'user_level' FROM authorization auth WHERE auth.user_id = ?`, userId)
+	auths, err = s.authorizations.GetUserAuthorizations(session.UserId)
 	if err != nil {
 		return str, err
 	}
 
-	str, err = NewAccessToken(tok)
+	if len(auths) == state.ZERO {
+		return str, errors.New("user has no authorization")
+	}
+
+	// Fall back on the first role when the active one has been withdrawn since the session was opened.
+	active := auths[0]
+	for i := 0; i < len(auths); i++ {
+		tok.UserLevels = append(tok.UserLevels, auths[i].Level)
+		if auths[i].Level == session.ActiveLevel {
+			active = auths[i]
+		}
+	}
+
+	tok.UserLevel = active.Level
+	tok.AuthorizationId = active.Id
+
+	now := time.Now()
+	tok.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        session.Xid,
+		Subject:   strconv.Itoa(int(session.UserId)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.Config.AccessTokenLifeTime())),
+	}
+
+	str, err = s.NewAccessToken(tok)
 	if err != nil {
 		return str, err
 	}
@@ -42,44 +112,110 @@ func GetTokenString(userId uint) (str string, err error) {
 	return str, err
 }
 
+// GetTokenDataFromContext returns the token stored in the context by the authentication middleware.
 func GetTokenDataFromContext(ctx *gin.Context) (tok *Token, err error) {
+	value, exists := ctx.Get(TokenContextKey)
+	if !exists {
+		return nil, errors.New("no token found in context")
+	}
+
+	tok, ok := value.(*Token)
+	if !ok || tok == nil {
+		return nil, errors.New("invalid token found in context")
+	}
+
+	return tok, err
+}
+
+// GetTokenStringFromHeader extracts the bearer token from the Authorization header.
+func GetTokenStringFromHeader(ctx *gin.Context) (str string, err error) {
 	tokenString := ctx.GetHeader("Authorization")
 	if len(strings.TrimSpace(tokenString)) == 0 {
-		return nil, errors.New("bad header value given")
+		return str, errors.New("bad header value given")
 	}
 
 	bearer := strings.Split(tokenString, " ")
-	if len(bearer) != 2 {
-		return nil, errors.New("incorrectly formatted authorization header")
+	if len(bearer) != 2 || !strings.EqualFold(bearer[0], "Bearer") {
+		return str, errors.New("incorrectly formatted authorization header")
 	}
 
-	return ParseAccessToken(bearer[1]), err
+	return bearer[1], err
 }
 
-func NewAccessToken(claims Token) (string, error) {
+func (s *Service) NewAccessToken(claims Token) (string, error) {
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return accessToken.SignedString([]byte(configuration.App.TokenSecret))
+	return accessToken.SignedString([]byte(s.Config.TokenSecret))
 }
 
-func NewRefreshToken(claims jwt.RegisteredClaims) (string, error) {
+func (s *Service) NewRefreshToken(claims jwt.RegisteredClaims) (string, error) {
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return refreshToken.SignedString([]byte(configuration.App.TokenSecret))
+	return refreshToken.SignedString([]byte(s.Config.TokenSecret))
 }
 
-func ParseAccessToken(accessToken string) *Token {
-	parsedAccessToken, _ := jwt.ParseWithClaims(accessToken, &Token{}, func(token *jwt.Token) (any, error) {
-		return []byte(configuration.App.TokenSecret), nil
-	})
+func (s *Service) ParseAccessToken(accessToken string) (tok *Token, err error) {
+	parsedAccessToken, err := jwt.ParseWithClaims(accessToken, &Token{}, s.keyFunc, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	tok, ok := parsedAccessToken.Claims.(*Token)
+	if !ok || !parsedAccessToken.Valid || len(tok.Audience) > 0 {
+		return nil, errors.New("invalid access token")
+	}
+
+	return tok, err
+}
+
+func (s *Service) ParseRefreshToken(refreshToken string) (claims *jwt.RegisteredClaims, err error) {
+	parsedRefreshToken, err := jwt.ParseWithClaims(refreshToken, &jwt.RegisteredClaims{}, s.keyFunc, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := parsedRefreshToken.Claims.(*jwt.RegisteredClaims)
+	if !ok || !parsedRefreshToken.Valid {
+		return nil, errors.New("invalid refresh token")
+	}
 
-	return parsedAccessToken.Claims.(*Token)
+	return claims, err
 }
 
-func ParseRefreshToken(refreshToken string) *jwt.RegisteredClaims {
-	parsedRefreshToken, _ := jwt.ParseWithClaims(refreshToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		return []byte(configuration.App.TokenSecret), nil
+// NewTwoFactorChallenge returns a short-lived token proving the password of the user was checked.
+// It can only be exchanged for an access token along with a valid second factor.
+func (s *Service) NewTwoFactorChallenge(userId uint) (string, error) {
+	now := time.Now()
+	challenge := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strconv.Itoa(int(userId)),
+		Audience:  jwt.ClaimStrings{twoFactorAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeLifeTime)),
 	})
 
-	return parsedRefreshToken.Claims.(*jwt.RegisteredClaims)
+	return challenge.SignedString([]byte(s.Config.TokenSecret))
+}
+
+func (s *Service) ParseTwoFactorChallenge(challenge string) (userId uint, err error) {
+	parsedChallenge, err := jwt.ParseWithClaims(challenge, &jwt.RegisteredClaims{}, s.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(twoFactorAudience))
+	if err != nil {
+		return 0, err
+	}
+
+	claims, ok := parsedChallenge.Claims.(*jwt.RegisteredClaims)
+	if !ok || !parsedChallenge.Valid {
+		return 0, errors.New("invalid two factor challenge")
+	}
+
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(id), err
+}
+
+func (s *Service) keyFunc(token *jwt.Token) (any, error) {
+	return []byte(s.Config.TokenSecret), nil
 }
@@ -2,41 +2,102 @@ package authentication
 
 import (
 	"github.com/gin-gonic/gin"
+	"net/http"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
 	"peec/pkg/user/authorization"
 )
 
 func IsStudent(ctx *gin.Context) (ret bool) {
+	return isActiveLevel(ctx, authorization.StudentAuthorizationLevel)
+}
+
+func IsParent(ctx *gin.Context) (ret bool) {
+	return isActiveLevel(ctx, authorization.ParentAuthorizationLevel)
+}
+
+func IsTutor(ctx *gin.Context) (ret bool) {
+	return isActiveLevel(ctx, authorization.TutorAuthorizationLevel)
+}
+
+func IsProfessor(ctx *gin.Context) (ret bool) {
+	return isActiveLevel(ctx, authorization.ProfessorAuthorizationLevel)
+}
+
+func IsAdmin(ctx *gin.Context) (ret bool) {
+	return isActiveLevel(ctx, authorization.AdminAuthorizationLevel)
+}
+
+func isActiveLevel(ctx *gin.Context, level uint) (ret bool) {
 	tok, err := GetTokenDataFromContext(ctx)
 	if err != nil {
 		return false
 	}
 
-	return authorization.IsUserStudent(tok.UserId)
+	return tok.UserLevel == level
 }
 
-func IsParent(ctx *gin.Context) (ret bool) {
-	tok, err := GetTokenDataFromContext(ctx)
+// SwitchRole changes the active role of the current session and returns an access token acting as that role.
+func (s *Service) SwitchRole(ctx *gin.Context) {
+	var (
+		tok      *Token
+		err      error
+		level    uint
+		ok       bool
+		session  Session
+		tokenStr string
+	)
+
+	tok, err = GetTokenDataFromContext(ctx)
 	if err != nil {
-		return false
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
 	}
 
-	return authorization.IsUserParent(tok.UserId)
-}
+	level, ok = authorization.RoleLevel(ctx.Param("role"))
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidRoleError,
+		})
+		return
+	}
 
-func IsTutor(ctx *gin.Context) (ret bool) {
-	tok, err := GetTokenDataFromContext(ctx)
+	_, err = s.authorizations.GetUserAuthorization(tok.UserId, level)
 	if err != nil {
-		return false
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
 	}
 
-	return authorization.IsUserTutor(tok.UserId)
-}
+	session, err = s.GetSession(tok.ID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
 
-func IsProfessor(ctx *gin.Context) (ret bool) {
-	tok, err := GetTokenDataFromContext(ctx)
+	err = s.SetSessionActiveLevel(session, level)
 	if err != nil {
-		return false
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	session.ActiveLevel = level
+	tokenStr, err = s.GetSessionTokenString(session)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
 	}
 
-	return authorization.IsUserProfessor(tok.UserId)
+	ctx.JSON(http.StatusOK, gin.H{
+		"token": tokenStr,
+	})
 }
@@ -1,126 +1,221 @@
 package authentication
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/joinverse/xid"
-	"github.com/yeqown/go-qrcode/v2"
-	"github.com/yeqown/go-qrcode/writer/standard"
+	"io"
+	"log"
 	"net/http"
 	"peec/database"
-	"peec/internal/configuration"
+	"peec/internal/realtime"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
-	"strconv"
 	"time"
 )
 
+// QR login states reported to the device waiting for approval.
+const (
+	QrLoginPending  = "pending"
+	QrLoginApproved = "approved"
+	QrLoginExpired  = "expired"
+)
+
+// QrLoginSecretHeader carries the secret of a QR login when polling it. It is kept out of the URL, which ends up in
+// the access logs, except for the event stream, see QrLoginEvents.
+const QrLoginSecretHeader = "X-Qr-Login-Secret"
+
+var errQrLoginExpired = errors.New("qr login request expired or already used")
+
+// QrCodeRegistry is a cross-device login request. It is created by a device without any session, approved by a
+// logged-in device scanning the QR code, then exchanged exactly once for a token by the first device, the only one
+// holding the secret.
 type QrCodeRegistry struct {
-	Id        uint       `json:"id"`
-	CreatedAt time.Time  `json:"created_at"`
-	DeletedAt *time.Time `json:"deleted_at"`
-	UserId    uint       `json:"user_id"`
-	Xid       string     `json:"xid"`
-	IsUsed    bool       `json:"is_used"`
+	Id         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+	UserId     uint       `json:"user_id"`
+	Xid        string     `json:"xid"`
+	SecretHash string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	IsApproved bool       `json:"is_approved"`
+	IsUsed     bool       `json:"is_used"`
 }
 
-func GenerateQrCode(ctx *gin.Context) {
+// RequestQrLogin starts a QR login. The QR code only carries the approval link; the secret returned alongside must
+// be kept by the device to collect its token, sent in QrLoginSecretHeader.
+func (s *Service) RequestQrLogin(ctx *gin.Context) {
 	var (
-		tok            *Token
 		err            error
-		networkLink    string
-		qrImageLink    string
+		secret         string
+		qrImage        string
 		qrCodeRegistry QrCodeRegistry
 	)
-	time.Sleep(100)
-	tok, err = GetTokenDataFromContext(ctx)
+
+	secret, err = newQrLoginSecret()
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
+			Message: errx.Lambda(err),
 		})
 		return
 	}
 
-	networkLink = "http://" + configuration.App.Host + ":" + configuration.App.Port + "/api/login/with-qr/:" + strconv.Itoa(int(tok.UserId))
+	qrCodeRegistry.Xid = xid.New().String()
+	qrCodeRegistry.SecretHash = HashToken(secret)
+	qrCodeRegistry.ExpiresAt = time.Now().UTC().Add(s.Config.QrLoginLifeTime())
+
+	approveLink := s.Config.PublicUrl("/api/qr/login/" + qrCodeRegistry.Xid + "/approve")
 
-	qrc, err := qrcode.New(networkLink)
+	qrImage, err = utils.QrCodeDataUri(approveLink)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+			Message: errx.Lambda(err),
 		})
 		return
 	}
 
-	qrCodeRegistry.UserId = tok.UserId
-	qrCodeRegistry.Xid = xid.New().String()
-	qrCodeRegistry.IsUsed = false
-
-	qrImageLink = "http://" + configuration.App.Host + ":" + configuration.App.Port + "/api/public/qr/" + qrCodeRegistry.Xid + ".jpg"
-
-	w, err := standard.New(utils.FILE_UPLOAD_DIR + utils.QR_CODE_UPLOAD_DIR + qrCodeRegistry.Xid + ".jpg")
+	_, err = s.DB.InsertOne(qrCodeRegistry)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+			Message: errx.DbInsertError,
 		})
 		return
 	}
-	// save file
-	err = qrc.Save(w)
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"xid":          qrCodeRegistry.Xid,
+		"secret":       secret,
+		"approve_link": approveLink,
+		"qr_code":      qrImage,
+		"expires_at":   qrCodeRegistry.ExpiresAt,
+	})
+}
+
+// ApproveQrLogin lets a logged-in device grant its account to the device which displayed the QR code.
+func (s *Service) ApproveQrLogin(ctx *gin.Context) {
+	var (
+		tok *Token
+		err error
+	)
+
+	tok, err = GetTokenDataFromContext(ctx)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+			Message: errx.UnAuthorizedError,
 		})
 		return
 	}
-	_, err = database.InsertOne(qrCodeRegistry)
+
+	result, err := s.DB.Client.Exec(`UPDATE qr_code_registry SET user_id = ?, is_approved = true, updated_at = CURRENT_TIMESTAMP
+			WHERE xid = ? AND is_approved = false AND is_used = false AND expires_at > UTC_TIMESTAMP()`, tok.UserId, ctx.Param("xid"))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.DbInsertError,
+			Message: errx.DbUpdateError,
 		})
 		return
 	}
 
-	ctx.AbortWithStatusJSON(http.StatusOK, qrImageLink)
-}
+	affected, err := result.RowsAffected()
+	if err != nil || affected != 1 {
+		ctx.AbortWithStatusJSON(http.StatusGone, utils.ErrorResponse{
+			Message: errx.ExpiredQrLoginError,
+		})
+		return
+	}
 
-func LoginWithQr(ctx *gin.Context) {
-	time.Sleep(100)
-	var (
-		tok            string
-		err            error
-		qrCodeRegistry QrCodeRegistry
-	)
+	err = s.Realtime.Publish(realtime.QrLoginTopic(ctx.Param("xid")), realtime.EventQrLogin, gin.H{"status": QrLoginApproved})
+	if err != nil {
+		log.Println("qr login event:", err)
+	}
 
-	xId := ctx.Param("xid")
+	ctx.AbortWithStatus(http.StatusOK)
+}
 
-	//Retrieve QR Code Registry: Retrieves the qr_code_registry record that corresponds to a given xid (likely a unique identifier for the QR code).
-	qrCodeRegistry, err = GetQrCodeRegistry(xId)
+// PollQrLogin reports the state of a QR login. Once approved, the first call returns the token of a new session.
+func (s *Service) PollQrLogin(ctx *gin.Context) {
+	qrCodeRegistry, err := s.GetQrCodeRegistryWithSecret(ctx.Param("xid"), ctx.GetHeader(QrLoginSecretHeader))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.InvalidQrLoginError,
 		})
 		return
 	}
 
-	//Update is_used Flag: Sets the is_used field of the retrieved qr_code_registry to true, indicating the QR code has been used for login.
-	err = UpdateQrCodeRegistryFlag(qrCodeRegistry)
+	response, err := s.claimQrLogin(ctx, qrCodeRegistry)
+	if errors.Is(err, errQrLoginExpired) {
+		ctx.AbortWithStatusJSON(http.StatusGone, utils.ErrorResponse{
+			Message: errx.ExpiredQrLoginError,
+		})
+		return
+	}
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.DbUpdateError,
+			Message: errx.Lambda(err),
 		})
 		return
 	}
 
-	//	Generate Access Token: Creates an access token using the user_id from the qr_code_registry to authenticate the user's session
-	tok, err = GetTokenString(qrCodeRegistry.UserId)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// QrLoginEvents is the server-sent events alternative to PollQrLogin. A single event is sent once the request is
+// approved or expired, then the stream ends. Browsers cannot set headers on an EventSource, so the secret may also
+// be given as the secret query parameter, which the access log redacts.
+func (s *Service) QrLoginEvents(ctx *gin.Context) {
+	xId := ctx.Param("xid")
+	secret := ctx.GetHeader(QrLoginSecretHeader)
+	if secret == "" {
+		secret = ctx.Query("secret")
+	}
+
+	qrCodeRegistry, err := s.GetQrCodeRegistryWithSecret(xId, secret)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.InvalidQrLoginError,
 		})
 		return
 	}
 
-	ctx.AbortWithStatusJSON(http.StatusOK, gin.H{
-		"token": tok,
+	// Subscribe before checking the state again, so an approval in between is not missed.
+	events, unsubscribe := s.Realtime.Backend.Subscribe(realtime.QrLoginTopic(xId))
+	defer unsubscribe()
+
+	expiry := time.NewTimer(time.Until(qrCodeRegistry.ExpiresAt))
+	defer expiry.Stop()
+
+	ctx.Stream(func(w io.Writer) bool {
+		qrCodeRegistry, err := s.GetQrCodeRegistryWithSecret(xId, secret)
+		if err != nil {
+			return false
+		}
+
+		response, err := s.claimQrLogin(ctx, qrCodeRegistry)
+		if errors.Is(err, errQrLoginExpired) {
+			ctx.SSEvent(QrLoginExpired, gin.H{"status": QrLoginExpired})
+			return false
+		}
+		if err != nil {
+			ctx.SSEvent("error", gin.H{"message": err.Error()})
+			return false
+		}
+
+		if response["status"] != QrLoginPending {
+			ctx.SSEvent(QrLoginApproved, response)
+			return false
+		}
+
+		select {
+		case <-ctx.Request.Context().Done():
+			return false
+		case _, ok := <-events:
+			return ok
+		case <-expiry.C:
+			return true
+		}
 	})
 }
 
@@ -128,19 +223,83 @@ func LoginWithQr(ctx *gin.Context) {
 	UTILS
 */
 
-func GetQrCodeRegistry(xId string) (qrCodeRegistry QrCodeRegistry, err error) {
-	err = database.Get(&qrCodeRegistry, `SELECT * FROM qr_code_registry WHERE qr_code_registry.xid = ?`, xId)
+func newQrLoginSecret() (secret string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return secret, err
+	}
+	return hex.EncodeToString(b), err
+}
+
+func (s *Service) GetQrCodeRegistry(xId string) (qrCodeRegistry QrCodeRegistry, err error) {
+	err = s.DB.Get(&qrCodeRegistry, `SELECT * FROM qr_code_registry WHERE qr_code_registry.xid = ? AND `+database.NotDeleted("qr_code_registry"), xId)
+	if err != nil {
+		return qrCodeRegistry, err
+	}
+	return qrCodeRegistry, nil
+}
+
+// GetQrCodeRegistryWithSecret returns the QR login request only to the device which created it.
+func (s *Service) GetQrCodeRegistryWithSecret(xId, secret string) (qrCodeRegistry QrCodeRegistry, err error) {
+	qrCodeRegistry, err = s.GetQrCodeRegistry(xId)
 	if err != nil {
 		return qrCodeRegistry, err
 	}
+
+	if subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(qrCodeRegistry.SecretHash)) != 1 {
+		return QrCodeRegistry{}, errors.New("invalid qr login secret")
+	}
 	return qrCodeRegistry, nil
 }
 
-func UpdateQrCodeRegistryFlag(qrCodeRegistry QrCodeRegistry) (err error) {
-	qrCodeRegistry.IsUsed = true
-	err = database.Update(qrCodeRegistry)
+// ConsumeQrCodeRegistry flags an approved request as used. It returns false when it was already used or expired.
+func (s *Service) ConsumeQrCodeRegistry(qrCodeRegistry QrCodeRegistry) (consumed bool, err error) {
+	result, err := s.DB.Client.Exec(`UPDATE qr_code_registry SET is_used = true, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND is_approved = true AND is_used = false AND expires_at > UTC_TIMESTAMP()`, qrCodeRegistry.Id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return false, err
 	}
-	return
+
+	return affected == 1, err
+}
+
+// claimQrLogin returns the pending state of the request, or the tokens of a new session once it is approved.
+func (s *Service) claimQrLogin(ctx *gin.Context, qrCodeRegistry QrCodeRegistry) (response gin.H, err error) {
+	if qrCodeRegistry.IsUsed || !qrCodeRegistry.ExpiresAt.After(time.Now()) {
+		return nil, errQrLoginExpired
+	}
+
+	if !qrCodeRegistry.IsApproved {
+		return gin.H{"status": QrLoginPending, "expires_at": qrCodeRegistry.ExpiresAt}, nil
+	}
+
+	consumed, err := s.ConsumeQrCodeRegistry(qrCodeRegistry)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, errQrLoginExpired
+	}
+
+	tokenStr, session, err := s.GetTokenString(ctx, qrCodeRegistry.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshStr, err := s.GetRefreshTokenString(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"status":        QrLoginApproved,
+		"token":         tokenStr,
+		"refresh_token": refreshStr,
+	}, nil
 }
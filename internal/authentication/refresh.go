@@ -0,0 +1,202 @@
+package authentication
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joinverse/xid"
+	"net/http"
+	"peec/database"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"strconv"
+	"time"
+)
+
+// RefreshToken is the server side record of an issued refresh token. Only the hash of the token is stored.
+// Every token obtained by rotating another one shares its Family, the xid of the session it was issued for,
+// so a reused token can revoke the whole chain.
+type RefreshToken struct {
+	Id        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	UserId    uint       `json:"user_id"`
+	Family    string     `json:"family"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	IsUsed    bool       `json:"is_used"`
+	IsRevoked bool       `json:"is_revoked"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (s *Service) RefreshAccessToken(ctx *gin.Context) {
+	var (
+		err          error
+		request      RefreshRequest
+		claims       *jwt.RegisteredClaims
+		refreshToken RefreshToken
+		session      Session
+		consumed     bool
+		accessStr    string
+		refreshStr   string
+	)
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	claims, err = s.ParseRefreshToken(request.RefreshToken)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.InvalidRefreshTokenError,
+		})
+		return
+	}
+
+	refreshToken, err = s.GetRefreshToken(HashToken(request.RefreshToken))
+	if err != nil || claims.Subject != strconv.Itoa(int(refreshToken.UserId)) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.InvalidRefreshTokenError,
+		})
+		return
+	}
+
+	session, err = s.GetSession(refreshToken.Family)
+	if err != nil || session.IsRevoked || refreshToken.IsRevoked || refreshToken.ExpiresAt.Before(time.Now()) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.InvalidRefreshTokenError,
+		})
+		return
+	}
+
+	consumed, err = s.ConsumeRefreshToken(refreshToken)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	// A refresh token that was already rotated is being replayed: the family is considered compromised.
+	if !consumed {
+		err = s.RevokeUserSession(session)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbUpdateError,
+			})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.RefreshTokenReuseError,
+		})
+		return
+	}
+
+	err = s.ExtendSession(session)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	accessStr, err = s.GetSessionTokenString(session)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	refreshStr, err = s.GetRefreshTokenString(session)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":         accessStr,
+		"refresh_token": refreshStr,
+	})
+}
+
+/*
+	UTILS
+*/
+
+// GetRefreshTokenString issues a refresh token for the session.
+func (s *Service) GetRefreshTokenString(session Session) (str string, err error) {
+	var refreshToken RefreshToken
+
+	now := time.Now()
+	refreshToken.UserId = session.UserId
+	refreshToken.Family = session.Xid
+	refreshToken.ExpiresAt = now.Add(s.Config.RefreshTokenLifeTime()).UTC()
+
+	str, err = s.NewRefreshToken(jwt.RegisteredClaims{
+		ID:        xid.New().String(),
+		Subject:   strconv.Itoa(int(session.UserId)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(refreshToken.ExpiresAt),
+	})
+	if err != nil {
+		return str, err
+	}
+
+	refreshToken.TokenHash = HashToken(str)
+
+	_, err = s.DB.InsertOne(refreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	return str, err
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Service) GetRefreshToken(tokenHash string) (refreshToken RefreshToken, err error) {
+	err = s.DB.Get(&refreshToken, `SELECT * FROM refresh_token WHERE token_hash = ? AND `+database.NotDeleted("refresh_token"), tokenHash)
+	if err != nil {
+		return refreshToken, err
+	}
+	return refreshToken, err
+}
+
+// ConsumeRefreshToken flags the token as used. It returns false when the token had already been used.
+func (s *Service) ConsumeRefreshToken(refreshToken RefreshToken) (consumed bool, err error) {
+	result, err := s.DB.Client.Exec(`UPDATE refresh_token SET is_used = true, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND is_used = false`, refreshToken.Id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, err
+}
+
+func (s *Service) RevokeRefreshTokenFamily(family string) (err error) {
+	err = s.DB.Exec(`UPDATE refresh_token SET is_revoked = true, updated_at = CURRENT_TIMESTAMP WHERE family = ?`, family)
+	if err != nil {
+		return err
+	}
+	return err
+}
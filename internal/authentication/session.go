@@ -0,0 +1,283 @@
+package authentication
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joinverse/xid"
+	"net/http"
+	"peec/database"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"peec/pkg/user/authorization"
+	"time"
+)
+
+// Session is opened each time a user logs in on a device. Its Xid is the jti of every access token issued for it
+// and the family of its refresh tokens, so revoking a session kills both.
+type Session struct {
+	Id          uint       `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	UserId      uint       `json:"user_id"`
+	Xid         string     `json:"xid"`
+	Device      string     `json:"device"`
+	Ip          string     `json:"ip"`
+	ActiveLevel uint       `json:"active_level"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	IsRevoked   bool       `json:"is_revoked"`
+	IsCurrent   bool       `json:"is_current" q:"_" db:"-"`
+}
+
+var sessionSpec = query.Spec{
+	Table:       "session",
+	Sorts:       []string{"created_at", "last_seen_at", "expires_at"},
+	Filters:     []string{"device", "ip"},
+	DefaultSort: "-last_seen_at",
+}
+
+// GetSessions lists the active sessions of the user, last seen first. See query.Query for the parameters.
+func (s *Service) GetSessions(ctx *gin.Context) {
+	var (
+		tok      *Token
+		err      error
+		q        query.Query
+		sessions query.Page[Session]
+	)
+
+	tok, err = GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, sessionSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	sessions, err = s.GetUserActiveSessions(q, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	for i := 0; i < len(sessions.Items); i++ {
+		sessions.Items[i].IsCurrent = sessions.Items[i].Xid == tok.ID
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+func (s *Service) RevokeSession(ctx *gin.Context) {
+	var (
+		tok     *Token
+		err     error
+		session Session
+	)
+
+	tok, err = GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	session, err = s.GetSession(ctx.Param("xid"))
+	if err != nil || session.UserId != tok.UserId {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownSessionError,
+		})
+		return
+	}
+
+	err = s.RevokeUserSession(session)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+func (s *Service) RevokeOtherSessions(ctx *gin.Context) {
+	var (
+		tok *Token
+		err error
+	)
+
+	tok, err = GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = s.RevokeUserSessions(tok.UserId, tok.ID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+func (s *Service) Logout(ctx *gin.Context) {
+	var (
+		tok     *Token
+		err     error
+		session Session
+	)
+
+	tok, err = GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	session, err = s.GetSession(tok.ID)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	err = s.RevokeUserSession(session)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+	UTILS
+*/
+
+func (s *Service) NewSession(ctx *gin.Context, userId uint) (session Session, err error) {
+	var auths []authorization.Authorization
+
+	auths, err = s.authorizations.GetUserAuthorizations(userId)
+	if err != nil {
+		return session, err
+	}
+
+	if len(auths) > state.ZERO {
+		session.ActiveLevel = auths[0].Level
+	}
+
+	now := time.Now().UTC()
+
+	session.UserId = userId
+	session.Xid = xid.New().String()
+	session.Device = ctx.Request.UserAgent()
+	session.Ip = ctx.ClientIP()
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(s.Config.RefreshTokenLifeTime())
+
+	session.Id, err = s.DB.InsertOne(session)
+	if err != nil {
+		return session, err
+	}
+
+	return session, err
+}
+
+func (s *Service) GetSession(sessionXid string) (session Session, err error) {
+	err = s.DB.Get(&session, `SELECT * FROM session WHERE xid = ? AND `+database.NotDeleted("session"), sessionXid)
+	if err != nil {
+		return session, err
+	}
+	return session, err
+}
+
+func (s *Service) GetUserActiveSessions(q query.Query, userId uint) (sessions query.Page[Session], err error) {
+	sessions, err = query.List[Session](s.DB, q, "session",
+		`session.user_id = ? AND session.is_revoked = false AND session.expires_at > UTC_TIMESTAMP()`, userId)
+	if err != nil {
+		return sessions, err
+	}
+	return sessions, err
+}
+
+// IsSessionActive reports whether the session exists, is not revoked and has not expired.
+func (s *Service) IsSessionActive(sessionXid string) bool {
+	session, err := s.GetSession(sessionXid)
+	if err != nil {
+		return false
+	}
+
+	return !session.IsRevoked && session.ExpiresAt.After(time.Now())
+}
+
+// TouchSession records activity on the session, at most once per minute to limit writes.
+func (s *Service) TouchSession(sessionXid string) (err error) {
+	err = s.DB.Exec(`UPDATE session SET last_seen_at = UTC_TIMESTAMP()
+			WHERE xid = ? AND last_seen_at < UTC_TIMESTAMP() - INTERVAL 1 MINUTE`, sessionXid)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+// ExtendSession pushes the session expiry along with the rotation of its refresh token.
+func (s *Service) ExtendSession(session Session) (err error) {
+	err = s.DB.Exec(`UPDATE session SET expires_at = ?, last_seen_at = UTC_TIMESTAMP() WHERE id = ?`,
+		time.Now().UTC().Add(s.Config.RefreshTokenLifeTime()), session.Id)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+func (s *Service) SetSessionActiveLevel(session Session, level uint) (err error) {
+	err = s.DB.Exec(`UPDATE session SET active_level = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, level, session.Id)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+func (s *Service) RevokeUserSession(session Session) (err error) {
+	err = s.DB.Exec(`UPDATE session SET is_revoked = true, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, session.Id)
+	if err != nil {
+		return err
+	}
+
+	return s.RevokeRefreshTokenFamily(session.Xid)
+}
+
+// RevokeUserSessions revokes every session of the user except the one identified by exceptXid, which may be empty.
+func (s *Service) RevokeUserSessions(userId uint, exceptXid string) (err error) {
+	err = s.DB.Exec(`UPDATE session SET is_revoked = true, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND xid <> ?`, userId, exceptXid)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Exec(`UPDATE refresh_token SET is_revoked = true, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND family <> ?`, userId, exceptXid)
+	if err != nil {
+		return err
+	}
+	return err
+}
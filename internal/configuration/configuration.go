@@ -1,32 +1,146 @@
 package configuration
 
+import (
+	"strings"
+	"time"
+)
+
 const (
 	RunningModeTest = 0
 	RunningModeDev  = 1
 	RunningModeProd = 2
 )
 
+const (
+	defaultAccessTokenTtl       = 15
+	defaultRefreshTokenTtl      = 60 * 24 * 30
+	defaultPasswordResetCodeTtl = 15
+	defaultQrLoginTtl           = 2
+	defaultVerificationCodeTtl  = 30
+)
+
+const (
+	defaultPasswordMinLength           = 8
+	defaultPasswordMaxLength           = 72
+	defaultPasswordMinCharacterClasses = 3
+	defaultPasswordHistorySize         = 5
+)
+
+const (
+	defaultMaxAccountFailures = 5
+	defaultMaxIpFailures      = 20
+	defaultFailureWindow      = 15
+	defaultLockDuration       = 15
+	defaultMaxDelay           = 30
+	defaultMaxResetCodes      = 3
+	defaultMaxIpResetCodes    = 10
+)
+
+type PasswordPolicy struct {
+	MinLength           int    `toml:"min_length"`
+	MaxLength           int    `toml:"max_length"`
+	MinCharacterClasses int    `toml:"min_character_classes"`
+	HistorySize         int    `toml:"history_size"`
+	BlocklistFile       string `toml:"blocklist_file"`
+}
+
+type LoginProtection struct {
+	MaxAccountFailures int `toml:"max_account_failures"`
+	MaxIpFailures      int `toml:"max_ip_failures"`
+	FailureWindow      int `toml:"failure_window"`
+	LockDuration       int `toml:"lock_duration"`
+	MaxDelay           int `toml:"max_delay"`
+	MaxResetCodes      int `toml:"max_reset_codes"`
+	MaxIpResetCodes    int `toml:"max_ip_reset_codes"`
+}
+
+const (
+	MailDriverSmtp = "smtp"
+	MailDriverFile = "file"
+)
+
+const (
+	defaultMailDriver    = MailDriverFile
+	defaultMailDirectory = "mail/"
+	defaultMailFrom      = "no-reply@peec.local"
+	defaultMailSmtpPort  = "587"
+)
+
+// Mail configures outbound emails. The smtp driver delivers them, the file driver writes each message
+// into directory, which is meant for development and tests.
+type Mail struct {
+	Driver    string `toml:"driver"`
+	From      string `toml:"from"`
+	Host      string `toml:"host"`
+	Port      string `toml:"port"`
+	UserName  string `toml:"user_name"`
+	Password  string `toml:"password"`
+	Directory string `toml:"directory"`
+}
+
+const (
+	SmsDriverLog = "log"
+)
+
+// Sms configures outbound text messages. Only the log driver, which prints messages instead of sending them,
+// ships with the application; providers implement sms.Sender.
+type Sms struct {
+	Driver string `toml:"driver"`
+	Sender string `toml:"sender"`
+}
+
+const (
+	defaultStorageDirectory = "public/"
+)
+
+// Storage configures where uploaded files and their thumbnails are kept. directory is also served under /public.
+type Storage struct {
+	Directory string `toml:"directory"`
+}
+
+const (
+	defaultOutboxInterval    = 2
+	defaultOutboxBatchSize   = 50
+	defaultOutboxMaxAttempts = 8
+	defaultOutboxBackoff     = 30
+	defaultOutboxMaxBackoff  = 60 * 60
+)
+
+// Outbox configures the dispatcher of domain events. Interval, Backoff and MaxBackoff are in seconds; a failed
+// delivery waits Backoff doubled on each attempt, up to MaxBackoff, and is dead-lettered after MaxAttempts.
+type Outbox struct {
+	Interval    int `toml:"interval"`
+	BatchSize   int `toml:"batch_size"`
+	MaxAttempts int `toml:"max_attempts"`
+	Backoff     int `toml:"backoff"`
+	MaxBackoff  int `toml:"max_backoff"`
+}
+
 type Config struct {
 	Version                 string `toml:"version"`
 	RunningMode             int    `toml:"running_mode"`
 	Port                    string `toml:"port"`
 	Host                    string `toml:"host"`
+	PublicBaseUrl           string `toml:"public_base_url"`
 	TokenSecret             string `toml:"token_secret"`
+	AccessTokenTtl          int    `toml:"access_token_ttl"`
+	RefreshTokenTtl         int    `toml:"refresh_token_ttl"`
+	PasswordResetCodeTtl    int    `toml:"password_reset_code_ttl"`
+	QrLoginTtl              int    `toml:"qr_login_ttl"`
+	VerificationCodeTtl     int    `toml:"verification_code_ttl"`
 	DatabaseUserName        string `toml:"database_user_name"`
 	DatabaseUserPassword    string `toml:"database_user_password"`
 	DatabaseName            string `toml:"database_name"`
 	DatabaseHost            string `toml:"database_host"`
 	DatabasePort            string `toml:"database_port"`
 	DatabaseConnexionString string
-}
-
-var App Config
-
-func init() {
-	err := InitiateConfiguration()
-	if err != nil {
-		panic(err)
-	}
+	Command                 []string        `toml:"-"`
+	PasswordPolicy          PasswordPolicy  `toml:"password_policy"`
+	LoginProtection         LoginProtection `toml:"login_protection"`
+	Mail                    Mail            `toml:"mail"`
+	Sms                     Sms             `toml:"sms"`
+	Outbox                  Outbox          `toml:"outbox"`
+	Storage                 Storage         `toml:"storage"`
 }
 
 func (c *Config) IsDev() bool {
@@ -40,3 +154,160 @@ func (c *Config) IsProd() bool {
 func (c *Config) IsTest() bool {
 	return c.RunningMode == RunningModeTest
 }
+
+// PublicUrl returns the absolute https URL of path, as reached by the clients. public_base_url is the origin the
+// API is served from behind its proxy; it defaults to https on host.
+func (c *Config) PublicUrl(path string) string {
+	base := c.PublicBaseUrl
+	if base == "" {
+		base = "https://" + c.Host
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// AccessTokenLifeTime returns the validity of an access token. access_token_ttl is expressed in minutes.
+func (c *Config) AccessTokenLifeTime() time.Duration {
+	if c.AccessTokenTtl <= 0 {
+		return defaultAccessTokenTtl * time.Minute
+	}
+	return time.Duration(c.AccessTokenTtl) * time.Minute
+}
+
+// RefreshTokenLifeTime returns the validity of a refresh token. refresh_token_ttl is expressed in minutes.
+func (c *Config) RefreshTokenLifeTime() time.Duration {
+	if c.RefreshTokenTtl <= 0 {
+		return defaultRefreshTokenTtl * time.Minute
+	}
+	return time.Duration(c.RefreshTokenTtl) * time.Minute
+}
+
+// PasswordResetCodeLifeTime returns the validity of a password reset code. password_reset_code_ttl is expressed in minutes.
+func (c *Config) PasswordResetCodeLifeTime() time.Duration {
+	if c.PasswordResetCodeTtl <= 0 {
+		return defaultPasswordResetCodeTtl * time.Minute
+	}
+	return time.Duration(c.PasswordResetCodeTtl) * time.Minute
+}
+
+// VerificationCodeLifeTime returns the validity of an email verification code. verification_code_ttl is expressed in minutes.
+func (c *Config) VerificationCodeLifeTime() time.Duration {
+	if c.VerificationCodeTtl <= 0 {
+		return defaultVerificationCodeTtl * time.Minute
+	}
+	return time.Duration(c.VerificationCodeTtl) * time.Minute
+}
+
+// QrLoginLifeTime returns the validity of a QR login request. qr_login_ttl is expressed in minutes.
+func (c *Config) QrLoginLifeTime() time.Duration {
+	if c.QrLoginTtl <= 0 {
+		return defaultQrLoginTtl * time.Minute
+	}
+	return time.Duration(c.QrLoginTtl) * time.Minute
+}
+
+// Password returns the password policy, unset values falling back on defaults.
+func (c *Config) Password() PasswordPolicy {
+	policy := c.PasswordPolicy
+	if policy.MinLength <= 0 {
+		policy.MinLength = defaultPasswordMinLength
+	}
+	if policy.MaxLength <= 0 {
+		policy.MaxLength = defaultPasswordMaxLength
+	}
+	if policy.MinCharacterClasses <= 0 {
+		policy.MinCharacterClasses = defaultPasswordMinCharacterClasses
+	}
+	if policy.HistorySize <= 0 {
+		policy.HistorySize = defaultPasswordHistorySize
+	}
+	return policy
+}
+
+// Login returns the login brute-force protection settings, unset values falling back on defaults.
+// failure_window and lock_duration are expressed in minutes, max_delay in seconds. max_reset_codes and
+// max_ip_reset_codes are the password reset codes an account and an ip address may be issued over failure_window.
+func (c *Config) Login() LoginProtection {
+	protection := c.LoginProtection
+	if protection.MaxAccountFailures <= 0 {
+		protection.MaxAccountFailures = defaultMaxAccountFailures
+	}
+	if protection.MaxIpFailures <= 0 {
+		protection.MaxIpFailures = defaultMaxIpFailures
+	}
+	if protection.FailureWindow <= 0 {
+		protection.FailureWindow = defaultFailureWindow
+	}
+	if protection.LockDuration <= 0 {
+		protection.LockDuration = defaultLockDuration
+	}
+	if protection.MaxDelay <= 0 {
+		protection.MaxDelay = defaultMaxDelay
+	}
+	if protection.MaxResetCodes <= 0 {
+		protection.MaxResetCodes = defaultMaxResetCodes
+	}
+	if protection.MaxIpResetCodes <= 0 {
+		protection.MaxIpResetCodes = defaultMaxIpResetCodes
+	}
+	return protection
+}
+
+// Mailer returns the outbound email settings, unset values falling back on defaults.
+func (c *Config) Mailer() Mail {
+	mail := c.Mail
+	if mail.Driver == "" {
+		mail.Driver = defaultMailDriver
+	}
+	if mail.From == "" {
+		mail.From = defaultMailFrom
+	}
+	if mail.Port == "" {
+		mail.Port = defaultMailSmtpPort
+	}
+	if mail.Directory == "" {
+		mail.Directory = defaultMailDirectory
+	}
+	return mail
+}
+
+// Texter returns the outbound text message settings, unset values falling back on defaults.
+func (c *Config) Texter() Sms {
+	sms := c.Sms
+	if sms.Driver == "" {
+		sms.Driver = SmsDriverLog
+	}
+	if sms.Sender == "" {
+		sms.Sender = "Peec"
+	}
+	return sms
+}
+
+// Dispatcher returns the outbox settings, unset values falling back on defaults.
+func (c *Config) Dispatcher() Outbox {
+	outbox := c.Outbox
+	if outbox.Interval <= 0 {
+		outbox.Interval = defaultOutboxInterval
+	}
+	if outbox.BatchSize <= 0 {
+		outbox.BatchSize = defaultOutboxBatchSize
+	}
+	if outbox.MaxAttempts <= 0 {
+		outbox.MaxAttempts = defaultOutboxMaxAttempts
+	}
+	if outbox.Backoff <= 0 {
+		outbox.Backoff = defaultOutboxBackoff
+	}
+	if outbox.MaxBackoff <= 0 {
+		outbox.MaxBackoff = defaultOutboxMaxBackoff
+	}
+	return outbox
+}
+
+// Uploads returns the file storage settings, unset values falling back on defaults.
+func (c *Config) Uploads() Storage {
+	storage := c.Storage
+	if storage.Directory == "" {
+		storage.Directory = defaultStorageDirectory
+	}
+	return storage
+}
@@ -4,14 +4,23 @@ import (
 	"fmt"
 	"github.com/BurntSushi/toml"
 	go_console "github.com/DrSmithFr/go-console"
+	"github.com/DrSmithFr/go-console/input/argument"
 )
 
-func InitiateConfiguration() (err error) {
-	cmd := go_console.NewScript().Build()
+// Load reads config.toml, falling back on the production settings when it is missing, along with the command line.
+func Load() (config Config, err error) {
+	cmd := go_console.NewScript().
+		AddInputArgument(
+			argument.New("command", argument.Optional|argument.List).
+				SetDescription("migrate up|down|status|to <version>, the server is started when empty"),
+		).
+		Build()
 
-	_, err = toml.DecodeFile("config.toml", &App)
+	command := cmd.Input.ArgumentList("command")
+
+	_, err = toml.DecodeFile("config.toml", &config)
 	if err != nil {
-		App = Config{
+		config = Config{
 			Version:                 "v0.0.1",
 			Port:                    "8087",
 			Host:                    "3.83.15.71",
@@ -33,18 +42,20 @@ func InitiateConfiguration() (err error) {
 	}
 
 	cmd.PrintNotes([]string{
-		fmt.Sprintf("version : %s", App.Version),
-		fmt.Sprintf("port : %s", App.Port),
-		fmt.Sprintf("host : %s", App.Host),
-		fmt.Sprintf("token secret : %s", App.TokenSecret),
-		fmt.Sprintf("running mode : %d", App.RunningMode),
-		fmt.Sprintf("database host : %s", App.DatabaseHost),
-		fmt.Sprintf("database DatabasePort : %s", App.DatabasePort),
+		fmt.Sprintf("version : %s", config.Version),
+		fmt.Sprintf("port : %s", config.Port),
+		fmt.Sprintf("host : %s", config.Host),
+		fmt.Sprintf("token secret : %s", config.TokenSecret),
+		fmt.Sprintf("running mode : %d", config.RunningMode),
+		fmt.Sprintf("database host : %s", config.DatabaseHost),
+		fmt.Sprintf("database DatabasePort : %s", config.DatabasePort),
 	})
 
-	App.DatabaseConnexionString = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", App.DatabaseUserName,
-		App.DatabaseUserPassword, App.DatabaseHost, App.DatabasePort,
-		App.DatabaseName)
+	config.Command = command
+
+	config.DatabaseConnexionString = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", config.DatabaseUserName,
+		config.DatabaseUserPassword, config.DatabaseHost, config.DatabasePort,
+		config.DatabaseName)
 
-	return err
+	return config, err
 }
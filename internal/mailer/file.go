@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"fmt"
+	"github.com/joinverse/xid"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message into Directory laid out as a maildir, so that it can be opened with any mail
+// client. Nothing leaves the machine.
+type FileMailer struct {
+	From      string
+	Directory string
+}
+
+func (m FileMailer) Send(msg Message) (err error) {
+	b, err := msg.Bytes(m.From)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{"tmp", "new", "cur"} {
+		err = os.MkdirAll(filepath.Join(m.Directory, dir), 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Messages are written in tmp then moved to new, so a reader never sees a partial file.
+	name := fmt.Sprintf("%d.%s.eml", time.Now().UnixNano(), xid.New().String())
+	tmp := filepath.Join(m.Directory, "tmp", name)
+
+	err = os.WriteFile(tmp, b, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(m.Directory, "new", name))
+}
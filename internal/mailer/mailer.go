@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/joinverse/xid"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"peec/internal/configuration"
+	"strings"
+	"time"
+)
+
+// Message is an outbound email. Html is optional, Text is always sent as the plain alternative.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	Html    string
+}
+
+// Mailer delivers messages. SmtpMailer sends them for real, FileMailer drops them into a maildir.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the mailer matching the configured driver.
+func New(config configuration.Mail) Mailer {
+	if config.Driver == configuration.MailDriverSmtp {
+		return SmtpMailer{Config: config}
+	}
+	return FileMailer{From: config.From, Directory: config.Directory}
+}
+
+// SendTemplate renders the named template with data and delivers it to a single recipient with m.
+func SendTemplate(m Mailer, to, name string, data any) (err error) {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+
+	msg.To = []string{to}
+	return m.Send(msg)
+}
+
+// Bytes encodes the message as a MIME document, multipart/alternative when it has an html body.
+func (msg Message) Bytes(from string) (b []byte, err error) {
+	var buffer bytes.Buffer
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	header.Set("To", strings.Join(msg.To, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-Id", fmt.Sprintf("<%s@%s>", xid.New().String(), domainOf(from)))
+	header.Set("Mime-Version", "1.0")
+
+	if msg.Html == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		writeHeader(&buffer, header)
+		buffer.WriteString(msg.Text)
+		return buffer.Bytes(), nil
+	}
+
+	body := multipart.NewWriter(&buffer)
+	header.Set("Content-Type", "multipart/alternative; boundary="+body.Boundary())
+	writeHeader(&buffer, header)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.Html},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = w.Write([]byte(part.content))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), err
+}
+
+func writeHeader(buffer *bytes.Buffer, header textproto.MIMEHeader) {
+	for key, values := range header {
+		buffer.WriteString(key + ": " + strings.Join(values, ", ") + "\r\n")
+	}
+	buffer.WriteString("\r\n")
+}
+
+func domainOf(address string) string {
+	address = strings.TrimSuffix(address, ">")
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "localhost"
+	}
+	return address[at+1:]
+}
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"net"
+	"net/mail"
+	"net/smtp"
+	"peec/internal/configuration"
+)
+
+// SmtpMailer delivers messages through an SMTP relay. Authentication is skipped when no user name is configured.
+type SmtpMailer struct {
+	Config configuration.Mail
+}
+
+func (m SmtpMailer) Send(msg Message) (err error) {
+	var auth smtp.Auth
+
+	from, err := mail.ParseAddress(m.Config.From)
+	if err != nil {
+		return err
+	}
+
+	b, err := msg.Bytes(m.Config.From)
+	if err != nil {
+		return err
+	}
+
+	if m.Config.UserName != "" {
+		auth = smtp.PlainAuth("", m.Config.UserName, m.Config.Password, m.Config.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.Config.Host, m.Config.Port), auth, from.Address, msg.To, b)
+}
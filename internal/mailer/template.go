@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Templates shipped with the application. Each name has a .txt file defining the "subject" and "body" templates,
+// and an optional .html file holding the html body.
+const (
+	TemplateVerification       = "verification"
+	TemplatePasswordReset      = "password_reset"
+	TemplatePlanningInvitation = "planning_invitation"
+	TemplateNotification       = "notification"
+)
+
+//go:embed templates
+var templates embed.FS
+
+type VerificationData struct {
+	Name      string
+	Code      string
+	ExpiresIn time.Duration
+}
+
+type PasswordResetData struct {
+	Name      string
+	Code      string
+	ExpiresIn time.Duration
+}
+
+type PlanningInvitationData struct {
+	Name          string
+	InvitedBy     string
+	Description   string
+	StartDateTime time.Time
+	EndDateTime   time.Time
+}
+
+type NotificationData struct {
+	Name    string
+	Message string
+}
+
+var funcs = template.FuncMap{
+	"minutes": func(d time.Duration) int {
+		return int(d.Minutes())
+	},
+	"datetime": func(t time.Time) string {
+		return t.Format("Monday 02 January 2006 15:04")
+	},
+}
+
+// Render builds the message of the named template. Recipients are left to the caller.
+func Render(name string, data any) (msg Message, err error) {
+	var subject, text, html bytes.Buffer
+
+	txt, err := template.New(name).Funcs(funcs).ParseFS(templates, "templates/"+name+".txt")
+	if err != nil {
+		return msg, err
+	}
+
+	err = txt.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return msg, err
+	}
+
+	err = txt.ExecuteTemplate(&text, "body", data)
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Subject = strings.TrimSpace(subject.String())
+	msg.Text = strings.TrimSpace(text.String()) + "\n"
+
+	if _, err = fs.Stat(templates, "templates/"+name+".html"); err != nil {
+		return msg, nil
+	}
+
+	htm, err := htmltemplate.New(name+".html").Funcs(htmltemplate.FuncMap(funcs)).ParseFS(templates, "templates/"+name+".html")
+	if err != nil {
+		return msg, err
+	}
+
+	err = htm.Execute(&html, data)
+	if err != nil {
+		return msg, err
+	}
+
+	msg.Html = html.String()
+	return msg, err
+}
@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"strconv"
+)
+
+var deadEventSpec = query.Spec{
+	Table:       "outbox_event",
+	Sorts:       []string{"created_at", "updated_at"},
+	Filters:     []string{"type", "subscriber"},
+	DefaultSort: "-id",
+}
+
+// GetDeadEvents lists the events which ran out of attempts, most recent first. See query.Query for the parameters.
+func (o *Outbox) GetDeadEvents(ctx *gin.Context) {
+	var (
+		err    error
+		q      query.Query
+		events query.Page[OutboxEvent]
+	)
+
+	q, err = query.Parse(ctx, deadEventSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	events, err = query.List[OutboxEvent](o.db, q, "outbox_event", "outbox_event.status = ?", StatusDead)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, events)
+}
+
+// RetryEvent puts a dead event back in the queue with a fresh set of attempts.
+func (o *Outbox) RetryEvent(ctx *gin.Context) {
+	eventId, err := strconv.Atoi(ctx.Param("event_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	result, err := o.db.Client.Exec(`UPDATE outbox_event SET status = ?, attempts = 0, next_attempt_at = UTC_TIMESTAMP(),
+				updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?`, StatusPending, eventId, StatusDead)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected != 1 {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownOutboxEventError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
@@ -0,0 +1,136 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"peec/internal/configuration"
+	"time"
+)
+
+// lease is how long a claimed event is hidden from other dispatchers while its handler runs.
+const lease = 5 * time.Minute
+
+const maxErrorLength = 1000
+
+// Run delivers the pending events until ctx is done. Several instances may run at once: each event is claimed
+// before being handled.
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(o.config.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := o.Dispatch()
+		if err != nil {
+			log.Println("outbox:", err)
+		}
+	}
+}
+
+// Dispatch delivers one batch of due events.
+func (o *Outbox) Dispatch() (err error) {
+	var events []OutboxEvent
+
+	err = o.db.Select(&events, `SELECT * FROM outbox_event WHERE status = ? AND next_attempt_at <= UTC_TIMESTAMP()
+			ORDER BY id LIMIT ?`, StatusPending, o.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		claimed, err := o.claim(event)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		event.Attempts++
+		err = o.deliver(event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claim counts the attempt and pushes the next one past the lease. The attempts counter doubles as a version and the
+// event has to still be due, so only one dispatcher wins an event, even one which read it before it got deferred.
+func (o *Outbox) claim(event OutboxEvent) (claimed bool, err error) {
+	result, err := o.db.Client.Exec(`UPDATE outbox_event SET attempts = attempts + 1,
+				next_attempt_at = UTC_TIMESTAMP() + INTERVAL ? SECOND, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND status = ? AND attempts = ? AND next_attempt_at <= UTC_TIMESTAMP()`, int(lease.Seconds()), event.Id, StatusPending, event.Attempts)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, err
+}
+
+func (o *Outbox) deliver(event OutboxEvent) (err error) {
+	handler, err := o.handlerOf(event.Subscriber)
+	if err == nil {
+		err = handle(handler, event)
+	}
+
+	if err == nil {
+		return o.db.Exec(`UPDATE outbox_event SET status = ?, last_error = '', delivered_at = UTC_TIMESTAMP(),
+				updated_at = CURRENT_TIMESTAMP WHERE id = ?`, StatusDelivered, event.Id)
+	}
+
+	var deferred *Deferred
+	if errors.As(err, &deferred) {
+		return o.db.Exec(`UPDATE outbox_event SET attempts = attempts - 1, last_error = '', next_attempt_at = ?,
+				updated_at = CURRENT_TIMESTAMP WHERE id = ?`, deferred.Until.UTC(), event.Id)
+	}
+
+	message := err.Error()
+	if len(message) > maxErrorLength {
+		message = message[:maxErrorLength]
+	}
+
+	if event.Attempts >= o.config.MaxAttempts {
+		log.Printf("outbox: event %d dead after %d attempts: %s", event.Id, event.Attempts, message)
+		return o.db.Exec(`UPDATE outbox_event SET status = ?, last_error = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ?`, StatusDead, message, event.Id)
+	}
+
+	return o.db.Exec(`UPDATE outbox_event SET last_error = ?, next_attempt_at = UTC_TIMESTAMP() + INTERVAL ? SECOND,
+				updated_at = CURRENT_TIMESTAMP WHERE id = ?`, message, backoff(event.Attempts, o.config), event.Id)
+}
+
+// handle runs the handler, turning a panic into a failed attempt instead of stopping the dispatcher.
+func handle(handler Handler, event OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return handler(event)
+}
+
+// backoff returns the delay in seconds before the next attempt, doubled after each failure.
+func backoff(attempts int, config configuration.Outbox) int {
+	delay := config.Backoff
+	for i := 1; i < attempts && delay < config.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > config.MaxBackoff {
+		delay = config.MaxBackoff
+	}
+	return delay
+}
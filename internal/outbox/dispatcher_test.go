@@ -0,0 +1,24 @@
+package outbox
+
+import (
+	"peec/internal/configuration"
+	"testing"
+)
+
+func TestBackoffDoublesUpToTheMaximum(t *testing.T) {
+	config := configuration.Outbox{Backoff: 5, MaxBackoff: 60}
+
+	for attempts, want := range map[int]int{1: 5, 2: 10, 3: 20, 4: 40, 5: 60, 6: 60, 40: 60} {
+		if got := backoff(attempts, config); got != want {
+			t.Errorf("backoff(%d) = %d, want %d", attempts, got, want)
+		}
+	}
+}
+
+func TestBackoffNeverExceedsTheMaximum(t *testing.T) {
+	config := configuration.Outbox{Backoff: 90, MaxBackoff: 60}
+
+	if got := backoff(1, config); got != 60 {
+		t.Errorf("backoff(1) = %d, want 60", got)
+	}
+}
@@ -0,0 +1,170 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"peec/database"
+	"peec/internal/configuration"
+	"sync"
+	"time"
+)
+
+// Domain events written to the outbox. The payload of each one is the struct of the same name.
+const (
+	EventUserRegistered       = "user.registered"
+	EventPlanningCreated      = "planning.created"
+	EventPlanningDeleted      = "planning.deleted"
+	EventPlanningActorAdded   = "planning.actor_added"
+	EventPlanningActorRemoved = "planning.actor_removed"
+	EventUserRated            = "user.rated"
+	EventPostPublished        = "post.published"
+	EventWebhookDelivery      = "webhook.delivery"
+)
+
+// Delivery states of an outbox event.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+type UserRegistered struct {
+	UserId uint `json:"user_id"`
+}
+
+// PlanningChanged is the payload of the planning events but EventPlanningActorAdded. UserId is the actor removed,
+// or the author of a created or deleted planning.
+type PlanningChanged struct {
+	CalendarPlanningId uint `json:"calendar_planning_id"`
+	UserId             uint `json:"user_id"`
+}
+
+type PlanningActorAdded struct {
+	CalendarPlanningId uint `json:"calendar_planning_id"`
+	UserId             uint `json:"user_id"`
+	AddedBy            uint `json:"added_by"`
+}
+
+type UserRated struct {
+	UserMarkId uint `json:"user_mark_id"`
+	UserId     uint `json:"user_id"`
+	AuthorId   uint `json:"author_id"`
+	Mark       uint `json:"mark"`
+}
+
+type PostPublished struct {
+	PostId   uint `json:"post_id"`
+	PosterId uint `json:"poster_id"`
+}
+
+type WebhookDelivery struct {
+	DeliveryId uint `json:"delivery_id"`
+}
+
+// OutboxEvent is one delivery of a domain event to one subscriber. Rows are written in the transaction of the
+// business change, so an event exists if and only if the change was committed, then delivered by Run.
+type OutboxEvent struct {
+	Id            uint       `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+	Type          string     `json:"type"`
+	Subscriber    string     `json:"subscriber"`
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
+
+// Handler delivers an event. Events are delivered at least once: a handler may see the same event again after a
+// failure or a crash.
+type Handler func(event OutboxEvent) error
+
+type subscription struct {
+	kind    string
+	handler Handler
+}
+
+// Outbox holds the subscribers of the domain events and delivers the events enqueued for them.
+type Outbox struct {
+	db            *database.DB
+	config        configuration.Outbox
+	mutex         sync.RWMutex
+	subscriptions map[string]subscription
+}
+
+// New returns an outbox without subscribers, delivering its events with config.
+func New(db *database.DB, config configuration.Outbox) *Outbox {
+	return &Outbox{
+		db:            db,
+		config:        config,
+		subscriptions: map[string]subscription{},
+	}
+}
+
+// Subscribe registers handler under a unique name for kind. It is meant to be called by the constructors of the
+// services, before any event is enqueued.
+func (o *Outbox) Subscribe(name, kind string, handler Handler) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.subscriptions[name] = subscription{kind: kind, handler: handler}
+}
+
+// Enqueue writes the event within tx, one row for each subscriber of kind. Nothing is delivered before tx commits.
+func (o *Outbox) Enqueue(tx *sqlx.Tx, kind string, payload any) (err error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	for name, subscription := range o.subscriptions {
+		if subscription.kind != kind {
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO outbox_event (type, subscriber, payload, status, next_attempt_at)
+				VALUES (?, ?, ?, ?, UTC_TIMESTAMP())`, kind, name, string(b), StatusPending)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deferred is returned by a handler which cannot deliver the event yet. The event is tried again at Until, and the
+// attempt does not count as a failure.
+type Deferred struct {
+	Until time.Time
+}
+
+func (deferred *Deferred) Error() string {
+	return "deferred until " + deferred.Until.UTC().Format(time.RFC3339)
+}
+
+// Defer returns the error telling the outbox to try the event again at until.
+func Defer(until time.Time) error {
+	return &Deferred{Until: until}
+}
+
+// Decode unmarshals the payload of the event into v.
+func (event OutboxEvent) Decode(v any) error {
+	return json.Unmarshal([]byte(event.Payload), v)
+}
+
+func (o *Outbox) handlerOf(name string) (handler Handler, err error) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	subscription, ok := o.subscriptions[name]
+	if !ok {
+		return nil, errors.New("no subscriber named " + name)
+	}
+	return subscription.handler, nil
+}
@@ -0,0 +1,309 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"peec/database"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iancoleman/strcase"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// cursorTimeLayout is the layout MySQL compares datetime columns with.
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// Spec whitelists what a list route accepts. Sorts and Filters hold column names of Table, which are also the
+// names used in the query string. Rows are always ordered by the sort column then by id, so that pages are stable.
+type Spec struct {
+	Table string
+	// Columns selected, Table.* when empty.
+	Columns     string
+	Sorts       []string
+	Filters     []string
+	DefaultSort string
+	// DefaultLimit overrides the default page size, for short reference lists.
+	DefaultLimit int
+	// Deleted lists the soft deleted rows of Table instead of the live ones.
+	Deleted bool
+}
+
+// Query is a list request parsed against a Spec:
+//
+//	?limit=20&page=2                  offset pagination, page starts at 1
+//	?limit=20&cursor=<next_cursor>    cursor pagination, from the next_cursor of the previous page
+//	&sort=-created_at                 sort column, descending when prefixed with -
+//	&filter[status]=pending           equality filters, combined with AND
+type Query struct {
+	spec    Spec
+	Limit   int
+	Page    int
+	Sort    string
+	Desc    bool
+	Filters map[string]string
+	cursor  *cursor
+}
+
+// Page is the envelope of every list. NextCursor is empty on the last page; Page is only set with offset
+// pagination.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Page       int    `json:"page,omitempty"`
+	NextCursor string `json:"next_cursor"`
+}
+
+type cursor struct {
+	Sort  string `json:"s"`
+	Value any    `json:"v"`
+	Id    uint   `json:"id"`
+}
+
+// Parse reads the pagination, sort and filter parameters of the request. Any name outside of spec is an error.
+func Parse(ctx *gin.Context, spec Spec) (q Query, err error) {
+	q.spec = spec
+
+	limit := spec.DefaultLimit
+	if limit == 0 {
+		limit = defaultLimit
+	}
+
+	q.Limit, err = strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(limit)))
+	if err != nil || q.Limit < 1 {
+		return q, errors.New("invalid limit")
+	}
+	if q.Limit > maxLimit {
+		q.Limit = maxLimit
+	}
+
+	sortBy := ctx.DefaultQuery("sort", spec.DefaultSort)
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	q.Sort, q.Desc = strings.TrimPrefix(sortBy, "-"), strings.HasPrefix(sortBy, "-")
+	if q.Sort != "id" && !slices.Contains(spec.Sorts, q.Sort) {
+		return q, fmt.Errorf("cannot sort by %s", q.Sort)
+	}
+
+	q.Filters = ctx.QueryMap("filter")
+	for name := range q.Filters {
+		if !slices.Contains(spec.Filters, name) {
+			return q, fmt.Errorf("cannot filter by %s", name)
+		}
+	}
+
+	rawCursor, hasCursor := ctx.GetQuery("cursor")
+	rawPage, hasPage := ctx.GetQuery("page")
+	if hasCursor && hasPage {
+		return q, errors.New("page and cursor are exclusive")
+	}
+
+	if hasCursor {
+		q.cursor, err = decodeCursor(rawCursor)
+		if err != nil || q.cursor.Sort != sortBy {
+			return q, errors.New("invalid cursor")
+		}
+		return q, nil
+	}
+
+	q.Page = 1
+	if hasPage {
+		q.Page, err = strconv.Atoi(rawPage)
+		if err != nil || q.Page < 1 {
+			return q, errors.New("invalid page")
+		}
+	}
+	return q, nil
+}
+
+// List runs the query on db over from, a table with its joins, restricted by where and its args. where is written by
+// the caller and may be empty; the filters, the sort and the cursor only ever use whitelisted columns.
+func List[T any](db *database.DB, q Query, from, where string, args ...any) (page Page[T], err error) {
+	conditions, args := q.conditions(where, args)
+
+	err = db.Get(&page.Total, `SELECT COUNT(*) FROM `+from+clause(conditions), args...)
+	if err != nil {
+		return page, err
+	}
+
+	if q.cursor != nil {
+		condition, cursorArgs := q.after(*q.cursor)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+
+	direction := "ASC"
+	if q.Desc {
+		direction = "DESC"
+	}
+
+	columns := q.spec.Columns
+	if columns == "" {
+		columns = q.spec.Table + ".*"
+	}
+
+	statement := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, %s %s LIMIT %d", columns, from, clause(conditions),
+		q.column(q.Sort), direction, q.column("id"), direction, q.Limit+1)
+	if q.cursor == nil {
+		statement += fmt.Sprintf(" OFFSET %d", (q.Page-1)*q.Limit)
+		page.Page = q.Page
+	}
+
+	page.Items = []T{}
+	err = db.Select(&page.Items, statement, args...)
+	if err != nil {
+		return page, err
+	}
+
+	page.Limit = q.Limit
+	if len(page.Items) > q.Limit {
+		page.Items = page.Items[:q.Limit]
+		page.NextCursor, err = q.encodeCursor(page.Items[q.Limit-1])
+		if err != nil {
+			return page, err
+		}
+	}
+	return page, nil
+}
+
+func (q Query) column(name string) string {
+	return q.spec.Table + "." + name
+}
+
+// conditions returns where along with the soft delete and the filter conditions, and their args.
+func (q Query) conditions(where string, args []any) (conditions []string, all []any) {
+	all = append(all, args...)
+
+	if where != "" {
+		conditions = append(conditions, "("+where+")")
+	}
+
+	if q.spec.Deleted {
+		conditions = append(conditions, q.spec.Table+"."+database.DeletedClause)
+	} else {
+		conditions = append(conditions, database.NotDeleted(q.spec.Table))
+	}
+
+	names := make([]string, 0, len(q.Filters))
+	for name := range q.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		conditions = append(conditions, q.column(name)+" = ?")
+		all = append(all, filterValue(q.Filters[name]))
+	}
+	return conditions, all
+}
+
+// after returns the condition selecting the rows which come after c in the order of the query. MySQL sorts NULL
+// before any value, so the rows with a NULL sort column come first in ascending order and last in descending order.
+func (q Query) after(c cursor) (condition string, args []any) {
+	column, id := q.column(q.Sort), q.column("id")
+
+	operator := ">"
+	if q.Desc {
+		operator = "<"
+	}
+
+	if c.Value == nil {
+		if q.Desc {
+			return fmt.Sprintf("(%s IS NULL AND %s < ?)", column, id), []any{c.Id}
+		}
+		return fmt.Sprintf("(%s IS NOT NULL OR (%s IS NULL AND %s > ?))", column, column, id), []any{c.Id}
+	}
+
+	condition = fmt.Sprintf("%s %s ? OR (%s = ? AND %s %s ?)", column, operator, column, id, operator)
+	if q.Desc {
+		condition += fmt.Sprintf(" OR %s IS NULL", column)
+	}
+	return "(" + condition + ")", []any{c.Value, c.Value, c.Id}
+}
+
+func clause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// filterValue binds true and false as booleans, MySQL comparing them as strings to boolean columns otherwise.
+func filterValue(value string) any {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return value
+}
+
+// encodeCursor returns the cursor pointing after item, from its sort column and its id.
+func (q Query) encodeCursor(item any) (encoded string, err error) {
+	v := reflect.Indirect(reflect.ValueOf(item))
+	if v.Kind() != reflect.Struct {
+		return "", errors.New("cursor pagination needs struct rows")
+	}
+
+	c := cursor{Sort: q.Sort}
+	if q.Desc {
+		c.Sort = "-" + q.Sort
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		column := strcase.ToSnake(v.Type().Field(i).Name)
+		field := reflect.Indirect(v.Field(i))
+
+		if column == "id" {
+			c.Id = uint(field.Uint())
+		}
+		if column == q.Sort && field.IsValid() {
+			c.Value = field.Interface()
+			if t, ok := c.Value.(time.Time); ok {
+				c.Value = t.Format(cursorTimeLayout)
+			}
+		}
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(encoded string) (c *cursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	c = &cursor{}
+	err = decoder.Decode(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if number, ok := c.Value.(json.Number); ok {
+		c.Value = number.String()
+	}
+	return c, nil
+}
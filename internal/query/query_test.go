@@ -0,0 +1,216 @@
+package query
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testSpec = Spec{
+	Table:       "post",
+	Sorts:       []string{"created_at", "title"},
+	Filters:     []string{"status", "is_public"},
+	DefaultSort: "-created_at",
+}
+
+type testRow struct {
+	Id        uint
+	CreatedAt time.Time
+	Title     string
+}
+
+// parse runs Parse on the query string rawQuery.
+func parse(t *testing.T, spec Spec, rawQuery string) (Query, error) {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/?"+rawQuery, nil)
+	return Parse(ctx, spec)
+}
+
+func TestParseDefaults(t *testing.T) {
+	q, err := parse(t, testSpec, "")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if q.Limit != defaultLimit || q.Page != 1 || q.Sort != "created_at" || !q.Desc || q.cursor != nil {
+		t.Errorf("query = %+v, want the default limit, page 1, sorted by -created_at", q)
+	}
+
+	q, err = parse(t, Spec{Table: "post", DefaultLimit: 5}, "")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if q.Limit != 5 || q.Sort != "id" || q.Desc {
+		t.Errorf("query = %+v, want the limit of the spec, sorted by id", q)
+	}
+}
+
+func TestParseReadsTheParameters(t *testing.T) {
+	q, err := parse(t, testSpec, "limit=500&page=3&sort=title&filter[status]=draft&filter[is_public]=true")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if q.Limit != maxLimit {
+		t.Errorf("limit = %d, want it capped at %d", q.Limit, maxLimit)
+	}
+	if q.Page != 3 || q.Sort != "title" || q.Desc {
+		t.Errorf("query = %+v, want page 3 sorted by title", q)
+	}
+	if want := map[string]string{"status": "draft", "is_public": "true"}; !reflect.DeepEqual(q.Filters, want) {
+		t.Errorf("filters = %v, want %v", q.Filters, want)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, rawQuery := range []string{
+		"limit=0",
+		"limit=ten",
+		"page=0",
+		"sort=password",
+		"sort=-password",
+		"filter[user_id]=1",
+		"page=2&cursor=abc",
+		"cursor=not-a-cursor",
+	} {
+		_, err := parse(t, testSpec, rawQuery)
+		if err == nil {
+			t.Errorf("parse %q succeeded", rawQuery)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	q, err := parse(t, testSpec, "sort=-created_at")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	createdAt := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	encoded, err := q.encodeCursor(testRow{Id: 42, CreatedAt: createdAt, Title: "hello"})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	next, err := parse(t, testSpec, "sort=-created_at&cursor="+encoded)
+	if err != nil {
+		t.Fatalf("parse with cursor: %v", err)
+	}
+	if next.cursor == nil || next.cursor.Id != 42 || next.cursor.Value != createdAt.Format(cursorTimeLayout) {
+		t.Errorf("cursor = %+v, want id 42 at %s", next.cursor, createdAt.Format(cursorTimeLayout))
+	}
+
+	// A cursor only goes on with the sort it was made for.
+	_, err = parse(t, testSpec, "sort=created_at&cursor="+encoded)
+	if err == nil {
+		t.Error("parse accepted a cursor of another sort")
+	}
+}
+
+func TestCursorKeepsNumbersExact(t *testing.T) {
+	q, err := parse(t, Spec{Table: "post", Sorts: []string{"id"}}, "sort=id")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	encoded, err := q.encodeCursor(struct{ Id uint }{Id: 9007199254740993})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	c, err := decodeCursor(encoded)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if c.Id != 9007199254740993 || c.Value != "9007199254740993" {
+		t.Errorf("cursor = %+v, want id and value 9007199254740993, not rounded through a float", c)
+	}
+}
+
+func TestCursorOverNullSortValues(t *testing.T) {
+	q, err := parse(t, testSpec, "sort=title")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	encoded, err := q.encodeCursor(struct {
+		Id    uint
+		Title *string
+	}{Id: 3})
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	c, err := decodeCursor(encoded)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if c.Value != nil || c.Id != 3 {
+		t.Fatalf("cursor = %+v, want a NULL value at id 3", c)
+	}
+
+	// NULL comes first in ascending order: the rest of the NULL rows, then every other one.
+	condition, args := q.after(*c)
+	if want := "(post.title IS NOT NULL OR (post.title IS NULL AND post.id > ?))"; condition != want {
+		t.Errorf("ascending after NULL = %s, want %s", condition, want)
+	}
+	if !reflect.DeepEqual(args, []any{uint(3)}) {
+		t.Errorf("args = %v, want [3]", args)
+	}
+
+	// And last in descending order: only the rest of the NULL rows.
+	q.Desc = true
+	condition, _ = q.after(*c)
+	if want := "(post.title IS NULL AND post.id < ?)"; condition != want {
+		t.Errorf("descending after NULL = %s, want %s", condition, want)
+	}
+
+	// A value followed by NULL rows in descending order keeps them.
+	condition, args = q.after(cursor{Value: "b", Id: 3})
+	if want := "(post.title < ? OR (post.title = ? AND post.id < ?) OR post.title IS NULL)"; condition != want {
+		t.Errorf("descending after a value = %s, want %s", condition, want)
+	}
+	if !reflect.DeepEqual(args, []any{"b", "b", uint(3)}) {
+		t.Errorf("args = %v, want [b b 3]", args)
+	}
+
+	q.Desc = false
+	condition, _ = q.after(cursor{Value: "b", Id: 3})
+	if want := "(post.title > ? OR (post.title = ? AND post.id > ?))"; condition != want {
+		t.Errorf("ascending after a value = %s, want %s", condition, want)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	q, err := parse(t, testSpec, "filter[status]=draft&filter[is_public]=false")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	conditions, args := q.conditions("post.user_id = ?", []any{7})
+
+	where := strings.Join(conditions, " AND ")
+	if !strings.HasPrefix(where, "(post.user_id = ?) AND (post.deleted_at IS NULL") {
+		t.Errorf("where = %s, want the caller condition then the soft delete one", where)
+	}
+	if !strings.HasSuffix(where, "post.is_public = ? AND post.status = ?") {
+		t.Errorf("where = %s, want the filters in name order", where)
+	}
+	if want := []any{7, false, "draft"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	q.spec.Deleted = true
+	conditions, _ = q.conditions("", nil)
+	if strings.Contains(strings.Join(conditions, " AND "), "IS NULL") {
+		t.Errorf("conditions = %v, want the soft deleted rows", conditions)
+	}
+}
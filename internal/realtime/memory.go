@@ -0,0 +1,145 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistorySize      = 100
+	defaultSubscriberBuffer = 32
+	defaultTopicTtl         = 10 * time.Minute
+)
+
+// MemoryBackend is the in-process Backend. It keeps the last historySize events of every topic for Replay, and
+// forgets a topic nobody listens to once nothing was published on it for ttl.
+//
+// Event ids are the time of publication in microseconds, bumped when needed to keep increasing within a topic. They
+// keep increasing across restarts and expirations, so a client resuming with an older id does not miss new events.
+type MemoryBackend struct {
+	mu          sync.Mutex
+	historySize int
+	bufferSize  int
+	ttl         time.Duration
+	lastSweep   time.Time
+	topics      map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	lastId          uint64
+	lastPublishedAt time.Time
+	history         []Event
+	subscribers     map[chan Event]struct{}
+}
+
+func NewMemoryBackend(historySize, bufferSize int, ttl time.Duration) *MemoryBackend {
+	return &MemoryBackend{
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		ttl:         ttl,
+		lastSweep:   time.Now(),
+		topics:      map[string]*memoryTopic{},
+	}
+}
+
+func (b *MemoryBackend) Publish(event Event) (Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep()
+
+	t := b.topic(event.Topic)
+	t.lastId = max(t.lastId+1, uint64(time.Now().UnixMicro()))
+	t.lastPublishedAt = time.Now()
+	event.Id = t.lastId
+
+	t.history = append(t.history, event)
+	if len(t.history) > b.historySize {
+		t.history = t.history[len(t.history)-b.historySize:]
+	}
+
+	for subscriber := range t.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// A subscriber that cannot keep up is dropped; it resumes from its last event once reconnected.
+			delete(t.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+	return event, nil
+}
+
+func (b *MemoryBackend) Subscribe(topic string) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscriber := make(chan Event, b.bufferSize)
+	b.topic(topic).subscribers[subscriber] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			t := b.topics[topic]
+			if _, ok := t.subscribers[subscriber]; ok {
+				delete(t.subscribers, subscriber)
+				close(subscriber)
+			}
+			b.release(topic)
+		})
+	}
+
+	return subscriber, unsubscribe
+}
+
+func (b *MemoryBackend) Replay(topic string, afterId uint64) ([]Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []Event
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return events, nil
+	}
+
+	for _, event := range t.history {
+		if event.Id > afterId {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (b *MemoryBackend) topic(name string) *memoryTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{subscribers: map[chan Event]struct{}{}}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// release forgets a topic nobody listens to once its history is of no use anymore: it is empty, or older than ttl.
+func (b *MemoryBackend) release(name string) {
+	t, ok := b.topics[name]
+	if ok && len(t.subscribers) == 0 && (len(t.history) == 0 || time.Since(t.lastPublishedAt) > b.ttl) {
+		delete(b.topics, name)
+	}
+}
+
+// sweep releases the expired topics, at most once per ttl.
+func (b *MemoryBackend) sweep() {
+	if time.Since(b.lastSweep) < b.ttl {
+		return
+	}
+	b.lastSweep = time.Now()
+
+	for name := range b.topics {
+		b.release(name)
+	}
+}
@@ -0,0 +1,77 @@
+package realtime
+
+import (
+	"fmt"
+	"time"
+)
+
+// Event types pushed to the clients.
+const (
+	EventNotification = "notification"
+	EventPlanning     = "planning"
+	EventQrLogin      = "qr_login"
+)
+
+// Event is published on a topic and delivered to every subscriber of that topic. Ids increase within a topic, even
+// across restarts, so a client can resume after the last event it received.
+type Event struct {
+	Id        uint64    `json:"id"`
+	Topic     string    `json:"-"`
+	Type      string    `json:"type"`
+	Data      any       `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Backend distributes events between publishers and subscribers. MemoryBackend only reaches the subscribers of
+// the current process; a backend built on a shared broker lets several API instances share the same topics.
+type Backend interface {
+	// Publish assigns an id to the event and delivers it.
+	Publish(event Event) (Event, error)
+	// Subscribe returns the events published on topic from now on. The channel is closed when unsubscribe is called,
+	// or when the subscriber falls too far behind, in which case it should resume with Replay.
+	Subscribe(topic string) (events <-chan Event, unsubscribe func())
+	// Replay returns the events of topic published after afterId that are still retained.
+	Replay(topic string, afterId uint64) ([]Event, error)
+}
+
+// Broker publishes and streams events through its Backend.
+type Broker struct {
+	Backend Backend
+}
+
+// New returns a broker over a MemoryBackend, which fits a single API instance.
+func New() *Broker {
+	return &Broker{Backend: NewMemoryBackend(defaultHistorySize, defaultSubscriberBuffer, defaultTopicTtl)}
+}
+
+// UserTopic is the topic of every event meant for a user, whatever the device.
+func UserTopic(userId uint) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+// QrLoginTopic is the topic the device waiting for a QR login approval listens to.
+func QrLoginTopic(xid string) string {
+	return "qr:" + xid
+}
+
+// Publish sends data to every subscriber of topic.
+func (b *Broker) Publish(topic, kind string, data any) (err error) {
+	_, err = b.Backend.Publish(Event{
+		Topic:     topic,
+		Type:      kind,
+		Data:      data,
+		CreatedAt: time.Now().UTC(),
+	})
+	return err
+}
+
+// PublishToUsers sends data to every user of userIds.
+func (b *Broker) PublishToUsers(userIds []uint, kind string, data any) (err error) {
+	for _, userId := range userIds {
+		err = b.Publish(UserTopic(userId), kind, data)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
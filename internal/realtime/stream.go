@@ -0,0 +1,81 @@
+package realtime
+
+import (
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// Stream sends the events of topic to the client as server-sent events until it disconnects. The events following
+// the Last-Event-ID header, or the last_event_id query parameter, are replayed first. A comment line is written
+// every heartbeatInterval so that proxies keep the connection open. alive is checked along with each heartbeat: the
+// stream ends as soon as it returns false, once the session it was opened with is revoked or expired.
+func (b *Broker) Stream(ctx *gin.Context, topic string, alive func() bool) {
+	lastEventId, _ := strconv.ParseUint(ctx.GetHeader("Last-Event-ID"), 10, 64)
+	if lastEventId == 0 {
+		lastEventId, _ = strconv.ParseUint(ctx.Query("last_event_id"), 10, 64)
+	}
+
+	// Subscribing before replaying guarantees no event is lost in between; duplicates are skipped by id.
+	events, unsubscribe := b.Backend.Subscribe(topic)
+	defer unsubscribe()
+
+	missed, err := b.Backend.Replay(topic, lastEventId)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	for _, event := range missed {
+		writeEvent(ctx, event)
+		lastEventId = event.Id
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !alive() {
+				return
+			}
+			_, err = ctx.Writer.WriteString(": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+			ctx.Writer.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Id <= lastEventId {
+				continue
+			}
+			writeEvent(ctx, event)
+			lastEventId = event.Id
+			ctx.Writer.Flush()
+		}
+	}
+}
+
+func writeEvent(ctx *gin.Context, event Event) {
+	ctx.Render(-1, sse.Event{
+		Id:    strconv.FormatUint(event.Id, 10),
+		Event: event.Type,
+		Data:  event,
+	})
+}
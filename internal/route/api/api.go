@@ -2,350 +2,821 @@ package api
 
 import (
 	"net/http"
+	"peec/internal/app"
 	"peec/internal/authentication"
 	"peec/internal/route/docs"
 	"peec/pkg/address"
+	"peec/pkg/code"
 	"peec/pkg/education"
 	"peec/pkg/mark"
 	"peec/pkg/media"
 	cvtype "peec/pkg/media/cv"
 	"peec/pkg/media/profile"
 	"peec/pkg/media/video"
+	"peec/pkg/notification"
+	"peec/pkg/phone"
 	"peec/pkg/planning"
 	"peec/pkg/post"
 	"peec/pkg/user"
+	"peec/pkg/user/authorization"
+	"peec/pkg/user/lockout"
+	"peec/pkg/user/password"
+	"peec/pkg/user/twofactor"
+	"peec/pkg/webhook"
 )
 
-var Routes = []docs.RouteDocumentation{
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/upload",
-		Handler:      media.Upload,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodHead,
-		RelativePath: "/public",
-		DocRoot:      "public",
-		NeedToken:    false,
-	},
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/register/:as",
-		Handler:      user.Register,
-		NeedToken:    false,
-	},
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/register/:as/:email",
-		Handler:      user.RegisterByEmail,
-		NeedToken:    false,
-	},
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/code/send",
-		Handler:      user.SendUserEmailValidationCode,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/code/verification/:code",
-		Handler:      user.VerifyUserEmailValidationCode,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/code",
-		Handler:      user.GetCode,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/login",
-		Handler:      user.Login,
-		NeedToken:    false,
-	},
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/password",
-		Handler:      user.NewPassword,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/password/history",
-		Handler:      user.GetPasswordHistory,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/profile",
-		Handler:      user.MyProfile,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/profile/active",
-		Handler:      user.ActivateUser,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/profile",
-		Handler:      user.UpdMyProfile,
-		NeedToken:    true,
-	},
-	// Address route
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/address",
-		Handler:      address.NewAddress,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/address",
-		Handler:      address.UpdateUserAddress,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/address",
-		Handler:      address.GetUserAddress,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodDelete,
-		RelativePath: "/address",
-		Handler:      address.RemoveUserAddress,
-		NeedToken:    true,
-	},
-	//Profile image routes
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/profile/image",
-		Handler:      profile.Upload,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/profile/image",
-		Handler:      profile.UpdateProfileImage,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/profile/image",
-		Handler:      profile.GetProfileImage,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/profile/thumb",
-		Handler:      profile.GetProfileThumb,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodDelete,
-		RelativePath: "/profile/image",
-		Handler:      profile.RemoveProfileImage,
-		NeedToken:    true,
-	},
-	//cv_type  routes
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/profile/cv",
-		Handler:      cvtype.UploadCv,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/profile/cv",
-		Handler:      cvtype.UpdateProfileCv,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/profile/cv",
-		Handler:      cvtype.GetProfileCv,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/profile/cv/thumb",
-		Handler:      cvtype.GetProfileCvThumb,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodDelete,
-		RelativePath: "/profile/cv",
-		Handler:      cvtype.RemoveProfileCv,
-		NeedToken:    true,
-	},
-	//videos  routes
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/profile/video",
-		Handler:      video.UploadVideo,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/profile/video",
-		Handler:      video.UpdateProfileVideo,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/profile/video",
-		Handler:      video.GetProfileVideo,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodDelete,
-		RelativePath: "/profile/video",
-		Handler:      video.RemoveProfileVideo,
-		NeedToken:    true,
-	},
-	//Qr code authentication
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/generate-qr",
-		Handler:      authentication.GenerateQrCode,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/login/with-qr/:xid",
-		Handler:      authentication.LoginWithQr,
-		NeedToken:    false,
-	},
-	//Calendar planning routes
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/calendar",
-		Handler:      planning.CreateUserPlannings,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/calendar",
-		Handler:      planning.GetUserPlannings,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodDelete,
-		RelativePath: "/calendar",
-		Handler:      planning.RemoveUserPlannings,
-		NeedToken:    true,
-	},
-	//Calendar user planning routes
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/calendar/:calendar_id/:actor",
-		Handler:      planning.AddUserIntoPlanning,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/calendar/:calendar_id/actor",
-		Handler:      planning.GetPlanningActors,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodDelete,
-		RelativePath: "/calendar/:calendar_id/actor",
-		Handler:      planning.RemoveUserFromPlanning,
-		NeedToken:    true,
-	},
-	//Education Routes
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/education",
-		Handler:      education.GetEducation,
-		NeedToken:    false,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/education/:edu",
-		Handler:      education.GetSubjects,
-		NeedToken:    false,
-	},
-	//Education Level Routes'
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/user/education/",
-		Handler:      education.SetUserEducationLevel,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/user/education",
-		Handler:      education.GetUserEducationLevel,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodPut,
-		RelativePath: "/user/education/",
-		Handler:      education.UpdateUserEducationLevel,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/user/subject",
-		Handler:      education.GetUserSubjects,
-		NeedToken:    true,
-	},
+// Services holds the services the routes are bound to.
+type Services struct {
+	*app.App
+	Auth           *authentication.Service
+	Authorizations *authorization.Service
+	Codes          *code.Service
+	Lockouts       *lockout.Service
+	Passwords      *password.Service
+	TwoFactor      *twofactor.Service
+	Users          *user.Service
+	Phones         *phone.Service
+	Notifications  *notification.Service
+	Addresses      *address.Service
+	Educations     *education.Service
+	Marks          *mark.Service
+	Media          *media.Service
+	Cvs            *cvtype.Service
+	Profiles       *profile.Service
+	Videos         *video.Service
+	Plannings      *planning.Service
+	Posts          *post.Service
+	Webhooks       *webhook.Service
+}
+
+// New builds every service of the application, each one receiving the services it relies on.
+func New(a *app.App) *Services {
+	s := &Services{App: a}
+
+	s.Authorizations = authorization.NewService(a)
+	s.Auth = authentication.NewService(a, s.Authorizations)
+	s.Codes = code.NewService(a)
+	s.Lockouts = lockout.NewService(a)
+	s.Passwords = password.NewService(a)
+	s.TwoFactor = twofactor.NewService(a)
+	s.Users = user.NewService(a, s.Auth, s.Codes, s.Lockouts, s.Passwords, s.TwoFactor)
+	s.Phones = phone.NewService(a, s.Codes)
+	s.Notifications = notification.NewService(a, s.Auth, s.Phones, s.Users)
+	s.Addresses = address.NewService(a)
+	s.Educations = education.NewService(a, s.Authorizations)
+	s.Marks = mark.NewService(a, s.Notifications)
+	s.Media = media.NewService(a)
+	s.Cvs = cvtype.NewService(a)
+	s.Profiles = profile.NewService(a)
+	s.Videos = video.NewService(a)
+	s.Plannings = planning.NewService(a, s.Authorizations, s.Notifications, s.Users)
+	s.Posts = post.NewService(a, s.Notifications, s.Users)
+	s.Webhooks = webhook.NewService(a)
+
+	return s
+}
+
+// Routes returns the routes of the API, bound to the handlers of the services.
+func (s *Services) Routes() []docs.RouteDocumentation {
+	return []docs.RouteDocumentation{
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/upload",
+			Handler:      s.Media.Upload,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodHead,
+			RelativePath: "/public",
+			DocRoot:      s.Config.Uploads().Directory,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/register/:as",
+			Handler:      s.Users.Register,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/register/:as/:email",
+			Handler:      s.Users.RegisterByEmail,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/code/send",
+			Handler:      s.Users.SendUserEmailValidationCode,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/code/verification/:code",
+			Handler:      s.Users.VerifyUserEmailValidationCode,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/code",
+			Handler:      s.Users.GetCode,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/login",
+			Handler:      s.Users.Login,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/login/2fa",
+			Handler:      s.Users.LoginTwoFactor,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/token/refresh",
+			Handler:      s.Auth.RefreshAccessToken,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/logout",
+			Handler:      s.Auth.Logout,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/session",
+			Handler:      s.Auth.GetSessions,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/session/:xid",
+			Handler:      s.Auth.RevokeSession,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/session",
+			Handler:      s.Auth.RevokeOtherSessions,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/role/:role",
+			Handler:      s.Auth.SwitchRole,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/2fa/enroll",
+			Handler:      s.TwoFactor.Enroll,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/2fa/activate",
+			Handler:      s.TwoFactor.Activate,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/2fa/recovery",
+			Handler:      s.TwoFactor.RegenerateRecoveryCodes,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/2fa",
+			Handler:      s.TwoFactor.Disable,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/password",
+			Handler:      s.Users.NewPassword,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/password/reset",
+			Handler:      s.Users.RequestPasswordReset,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/password/reset/confirm",
+			Handler:      s.Users.ConfirmPasswordReset,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/password/history",
+			Handler:      s.Users.GetPasswordHistory,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/profile",
+			Handler:      s.Users.MyProfile,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/profile/active",
+			Handler:      s.Users.ActivateUser,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/profile",
+			Handler:      s.Users.UpdMyProfile,
+			NeedToken:    true,
+		},
+		// Admin routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/user/:user_id/unlock",
+			Handler:      s.Lockouts.UnlockUser,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/ip/unlock",
+			Handler:      s.Lockouts.UnlockIp,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/admin/lockout",
+			Handler:      s.Lockouts.GetLockoutEvents,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/admin/user/:user_id",
+			Handler:      s.Users.DeleteUser,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/admin/user/deleted",
+			Handler:      s.Users.GetDeletedUsers,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/user/:user_id/restore",
+			Handler:      s.Users.RestoreUser,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/admin/post/deleted",
+			Handler:      s.Posts.GetDeletedPosts,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/post/:post_id/restore",
+			Handler:      s.Posts.RestorePost,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/admin/media/deleted",
+			Handler:      s.Media.GetDeletedMedia,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/media/:media_id/restore",
+			Handler:      s.Media.RestoreMedia,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/admin/outbox/dead",
+			Handler:      s.Outbox.GetDeadEvents,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/outbox/:event_id/retry",
+			Handler:      s.Outbox.RetryEvent,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/webhook",
+			Handler:      s.Webhooks.NewWebhook,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/admin/webhook",
+			Handler:      s.Webhooks.GetWebhooks,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/admin/webhook/:webhook_id",
+			Handler:      s.Webhooks.UpdateWebhook,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/admin/webhook/:webhook_id",
+			Handler:      s.Webhooks.RemoveWebhook,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/admin/webhook/:webhook_id/delivery",
+			Handler:      s.Webhooks.GetDeliveries,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/admin/webhook/delivery/:delivery_id/redeliver",
+			Handler:      s.Webhooks.Redeliver,
+			NeedToken:    true,
+			Roles:        []string{authorization.AdminRole},
+		},
+		// Address route
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/address",
+			Handler:      s.Addresses.NewAddress,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/address",
+			Handler:      s.Addresses.UpdateUserAddress,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/address",
+			Handler:      s.Addresses.GetUserAddress,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/address",
+			Handler:      s.Addresses.RemoveUserAddress,
+			NeedToken:    true,
+		},
+		// Phone routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/phone",
+			Handler:      s.Phones.NewPhoneNumber,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/phone",
+			Handler:      s.Phones.GetUserPhoneNumber,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/phone/:phone_id",
+			Handler:      s.Phones.UpdateUserPhoneNumber,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/phone/:phone_id",
+			Handler:      s.Phones.RemoveUserPhoneNumber,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/phone/:phone_id/primary",
+			Handler:      s.Phones.SetPrimaryPhoneNumber,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/phone/:phone_id/verification",
+			Handler:      s.Phones.SendPhoneVerificationCode,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/phone/:phone_id/verification/confirm",
+			Handler:      s.Phones.VerifyPhoneNumber,
+			NeedToken:    true,
+		},
+		// Emergency contact routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/emergency-contact",
+			Handler:      s.Phones.NewEmergencyContact,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/emergency-contact",
+			Handler:      s.Phones.GetMyEmergencyContacts,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/emergency-contact/access",
+			Handler:      s.Phones.GetEmergencyContactAccessLog,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/emergency-contact/:contact_id",
+			Handler:      s.Phones.UpdateEmergencyContact,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/emergency-contact/:contact_id",
+			Handler:      s.Phones.RemoveEmergencyContact,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/student/:user_id/emergency-contact",
+			Handler:      s.Phones.GetStudentEmergencyContacts,
+			NeedToken:    true,
+			Roles:        []string{authorization.TutorRole, authorization.ParentRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/student/:user_id/emergency-contact",
+			Handler:      s.Phones.NewEmergencyContact,
+			NeedToken:    true,
+			Roles:        []string{authorization.ParentRole},
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/student/:user_id/emergency-contact/:contact_id",
+			Handler:      s.Phones.UpdateEmergencyContact,
+			NeedToken:    true,
+			Roles:        []string{authorization.ParentRole},
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/student/:user_id/emergency-contact/:contact_id",
+			Handler:      s.Phones.RemoveEmergencyContact,
+			NeedToken:    true,
+			Roles:        []string{authorization.ParentRole},
+		},
+		// Parent link routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/student/:user_id/parent",
+			Handler:      s.Phones.RequestParentLink,
+			NeedToken:    true,
+			Roles:        []string{authorization.ParentRole},
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/parent/:user_id/accept",
+			Handler:      s.Phones.AcceptParentLink,
+			NeedToken:    true,
+			Roles:        []string{authorization.StudentRole},
+		},
+		//Profile image routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/profile/image",
+			Handler:      s.Profiles.Upload,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/profile/image",
+			Handler:      s.Profiles.UpdateProfileImage,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/profile/image",
+			Handler:      s.Profiles.GetProfileImage,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/profile/thumb",
+			Handler:      s.Profiles.GetProfileThumb,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/profile/image",
+			Handler:      s.Profiles.RemoveProfileImage,
+			NeedToken:    true,
+		},
+		//cv_type  routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/profile/cv",
+			Handler:      s.Cvs.UploadCv,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/profile/cv",
+			Handler:      s.Cvs.UpdateProfileCv,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/profile/cv",
+			Handler:      s.Cvs.GetProfileCv,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/profile/cv/thumb",
+			Handler:      s.Cvs.GetProfileCvThumb,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/profile/cv",
+			Handler:      s.Cvs.RemoveProfileCv,
+			NeedToken:    true,
+		},
+		//videos  routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/profile/video",
+			Handler:      s.Videos.UploadVideo,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/profile/video",
+			Handler:      s.Videos.UpdateProfileVideo,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/profile/video",
+			Handler:      s.Videos.GetProfileVideo,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/profile/video",
+			Handler:      s.Videos.RemoveProfileVideo,
+			NeedToken:    true,
+		},
+		//Qr code authentication
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/qr/login",
+			Handler:      s.Auth.RequestQrLogin,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/qr/login/:xid/approve",
+			Handler:      s.Auth.ApproveQrLogin,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/qr/login/:xid",
+			Handler:      s.Auth.PollQrLogin,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/qr/login/:xid/events",
+			Handler:      s.Auth.QrLoginEvents,
+			NeedToken:    false,
+		},
+		//Calendar planning routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/calendar",
+			Handler:      s.Plannings.CreateUserPlannings,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/calendar",
+			Handler:      s.Plannings.GetUserPlannings,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/calendar",
+			Handler:      s.Plannings.RemoveUserPlannings,
+			NeedToken:    true,
+		},
+		//Calendar user planning routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/calendar/:calendar_id/:actor",
+			Handler:      s.Plannings.AddUserIntoPlanning,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/calendar/:calendar_id/accept",
+			Handler:      s.Plannings.AcceptPlanning,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/calendar/:calendar_id/actor",
+			Handler:      s.Plannings.GetPlanningActors,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/calendar/:calendar_id/actor",
+			Handler:      s.Plannings.RemoveUserFromPlanning,
+			NeedToken:    true,
+		},
+		//Education Routes
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/education",
+			Handler:      s.Educations.GetEducation,
+			NeedToken:    false,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/education/:edu",
+			Handler:      s.Educations.GetSubjects,
+			NeedToken:    false,
+		},
+		//Education Level Routes'
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/user/education/",
+			Handler:      s.Educations.SetUserEducationLevel,
+			NeedToken:    true,
+			Roles:        []string{authorization.StudentRole, authorization.ProfessorRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/user/education",
+			Handler:      s.Educations.GetUserEducationLevel,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/user/education/",
+			Handler:      s.Educations.UpdateUserEducationLevel,
+			NeedToken:    true,
+			Roles:        []string{authorization.StudentRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/user/subject",
+			Handler:      s.Educations.GetUserSubjects,
+			NeedToken:    true,
+			Roles:        []string{authorization.StudentRole, authorization.ProfessorRole},
+		},
+
+		//user_mark Routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/user_mark",
+			Handler:      s.Marks.RateUser,
+			NeedToken:    true,
+			Roles:        []string{authorization.TutorRole, authorization.ProfessorRole, authorization.AdminRole},
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/user_mark/:userId",
+			Handler:      s.Marks.GetUserAverageMark,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/user_mark/comment",
+			Handler:      s.Marks.GetUserMarkComment,
+			NeedToken:    true,
+			Roles:        []string{authorization.TutorRole, authorization.ProfessorRole, authorization.AdminRole},
+		},
 
-	//user_mark Routes
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/user_mark",
-		Handler:      mark.RateUser,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/user_mark/:userId",
-		Handler:      mark.GetUserAverageMark,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/user_mark/comment",
-		Handler:      mark.GetUserMarkComment,
-		NeedToken:    true,
-	},
+		// post Routes
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/post",
+			Handler:      s.Posts.CreatePost,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/post",
+			Handler:      s.Posts.DeletePost,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/posts",
+			Handler:      s.Posts.GetPosts,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/post/:postId",
+			Handler:      s.Posts.GetSinglePost,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/post",
+			Handler:      s.Posts.GetUserPosts,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPost,
+			RelativePath: "/follow/:user_id",
+			Handler:      s.Posts.FollowUser,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodDelete,
+			RelativePath: "/follow/:user_id",
+			Handler:      s.Posts.UnfollowUser,
+			NeedToken:    true,
+		},
 
-	// post Routes
-	{
-		HttpMethod:   http.MethodPost,
-		RelativePath: "/post",
-		Handler:      post.CreatePost,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodDelete,
-		RelativePath: "/post",
-		Handler:      post.DeletePost,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/posts",
-		Handler:      post.GetPosts,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/post/:postId",
-		Handler:      post.GetSinglePost,
-		NeedToken:    true,
-	},
-	{
-		HttpMethod:   http.MethodGet,
-		RelativePath: "/post",
-		Handler:      post.GetUserPosts,
-		NeedToken:    true,
-	},
+		// Notification routes
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/events",
+			Handler:      s.Notifications.Events,
+			NeedToken:    true,
+			Stream:       true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/notification",
+			Handler:      s.Notifications.GetNotifications,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/notification/unread/count",
+			Handler:      s.Notifications.GetUnreadCount,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/notification/read",
+			Handler:      s.Notifications.MarkAllAsRead,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/notification/:notification_id/read",
+			Handler:      s.Notifications.MarkAsRead,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodGet,
+			RelativePath: "/notification/settings",
+			Handler:      s.Notifications.GetSettings,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/notification/settings",
+			Handler:      s.Notifications.UpdateSettings,
+			NeedToken:    true,
+		},
+		{
+			HttpMethod:   http.MethodPut,
+			RelativePath: "/notification/settings/:type",
+			Handler:      s.Notifications.UpdatePreference,
+			NeedToken:    true,
+		},
+	}
 }
@@ -3,6 +3,7 @@ package docs
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"peec/internal/authentication"
 )
 
 type RootDocumentation struct {
@@ -14,6 +15,8 @@ type RouteDocumentation struct {
 	HttpMethod   string          `json:"http_method"`
 	RelativePath string          `json:"relative_path"`
 	NeedToken    bool            `json:"need_token"`
+	Stream       bool            `json:"stream,omitempty"`
+	Roles        []string        `json:"roles,omitempty"`
 	Handler      gin.HandlerFunc `json:"-"`
 	DocRoot      string          `json:"-"`
 }
@@ -33,20 +36,22 @@ func ParseDocumentation(documents []RootDocumentation) []RootDocumentation {
 	return newDocuments
 }
 
-func GenerateDocumentation(group *gin.RouterGroup, documents []RouteDocumentation) (err error) {
+func GenerateDocumentation(group *gin.RouterGroup, auth *authentication.Service, documents []RouteDocumentation) (err error) {
 	for i := 0; i < len(documents); i++ {
+		handlers := routeHandlers(auth, documents[i])
+
 		switch documents[i].HttpMethod {
 		case http.MethodGet:
-			group.GET(documents[i].RelativePath, documents[i].Handler)
+			group.GET(documents[i].RelativePath, handlers...)
 			break
 		case http.MethodPost:
-			group.POST(documents[i].RelativePath, documents[i].Handler)
+			group.POST(documents[i].RelativePath, handlers...)
 			break
 		case http.MethodDelete:
-			group.DELETE(documents[i].RelativePath, documents[i].Handler)
+			group.DELETE(documents[i].RelativePath, handlers...)
 			break
 		case http.MethodPut:
-			group.PUT(documents[i].RelativePath, documents[i].Handler)
+			group.PUT(documents[i].RelativePath, handlers...)
 			break
 		case http.MethodHead:
 			group.Static(documents[i].RelativePath, documents[i].DocRoot)
@@ -56,3 +61,19 @@ func GenerateDocumentation(group *gin.RouterGroup, documents []RouteDocumentatio
 
 	return err
 }
+
+func routeHandlers(auth *authentication.Service, document RouteDocumentation) (handlers []gin.HandlerFunc) {
+	if document.NeedToken || len(document.Roles) > 0 {
+		if document.Stream {
+			handlers = append(handlers, auth.RequireStreamToken())
+		} else {
+			handlers = append(handlers, auth.RequireToken())
+		}
+	}
+
+	if len(document.Roles) > 0 {
+		handlers = append(handlers, authentication.RequireRoles(document.Roles))
+	}
+
+	return append(handlers, document.Handler)
+}
@@ -5,9 +5,11 @@ import (
 	"peec/internal/route/docs"
 )
 
-var RootRoutesGroup = []docs.RootDocumentation{
-	{
-		Group: "/api",
-		Paths: api.Routes,
-	},
+func rootRoutesGroup(services *api.Services) []docs.RootDocumentation {
+	return []docs.RootDocumentation{
+		{
+			Group: "/api",
+			Paths: services.Routes(),
+		},
+	}
 }
@@ -0,0 +1,63 @@
+package route
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redactedParameters are the query parameters carrying credentials, for the clients which cannot set headers, such
+// as an EventSource. Their values never reach the access log.
+var redactedParameters = []string{"access_token", "secret"}
+
+// logFormatter is the default format of gin, with the credentials of the query string redacted.
+func logFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		redactQuery(param.Path),
+		param.ErrorMessage,
+	)
+}
+
+// redactQuery replaces the values of redactedParameters in the query string of path.
+func redactQuery(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return base + "?REDACTED"
+	}
+
+	redacted := false
+	for _, name := range redactedParameters {
+		if values.Has(name) {
+			values.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return path
+	}
+	return base + "?" + values.Encode()
+}
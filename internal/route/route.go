@@ -4,24 +4,24 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"peec/internal/configuration"
+	"peec/internal/app"
+	"peec/internal/route/api"
 	"peec/internal/route/docs"
 	"time"
 )
 
-var engine *gin.Engine
-
-func init() {
-	if configuration.App.IsProd() {
+// New returns the engine serving the routes of every service of a.
+func New(a *app.App) (engine *gin.Engine, err error) {
+	if a.Config.IsProd() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	engine = gin.Default()
+	engine = gin.New()
 
 	// Global middleware
 	// Logger middleware will write the logs to gin.DefaultWriter even if you set with GIN_MODE=release.
-	// By default, gin.DefaultWriter = os.Stdout
-	//engine.Use(gin.Logger())
+	// By default, gin.DefaultWriter = os.Stdout. Credentials given in the query string are redacted.
+	engine.Use(gin.LoggerWithFormatter(logFormatter))
 
 	// Recovery middleware recovers from any panics and writes a 500 if there was one.
 
@@ -38,34 +38,37 @@ func init() {
 	engine.Use(cors.New(config))
 	engine.Use(gin.Recovery())
 
+	err = attach(engine, api.New(a))
+	return engine, err
 }
 
-func Serve() (err error) {
-	err = attach(engine)
-	if err != nil {
-		panic(err)
-	}
-
-	err = engine.Run(configuration.App.Host + ":" + configuration.App.Port)
+func Serve(a *app.App) (err error) {
+	engine, err := New(a)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	return err
+	return engine.Run(a.Config.Host + ":" + a.Config.Port)
 }
 
-func attach(g *gin.Engine) (err error) {
+func attach(g *gin.Engine, services *api.Services) (err error) {
+	root := rootRoutesGroup(services)
+
 	g.GET("/test", func(context *gin.Context) {
 		context.JSON(http.StatusOK, gin.H{
 			"status": "ok",
 		})
 	})
 
-	for i := 0; i < len(RootRoutesGroup); i++ {
-		group := g.Group(RootRoutesGroup[i].Group)
-		err = docs.GenerateDocumentation(group, RootRoutesGroup[i].Paths)
+	g.GET("/docs", func(context *gin.Context) {
+		context.JSON(http.StatusOK, docs.ParseDocumentation(root))
+	})
+
+	for i := 0; i < len(root); i++ {
+		group := g.Group(root[i].Group)
+		err = docs.GenerateDocumentation(group, services.Auth, root[i].Paths)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
 
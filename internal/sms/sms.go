@@ -0,0 +1,34 @@
+package sms
+
+import (
+	"fmt"
+	"log"
+	"peec/internal/configuration"
+)
+
+// Sender delivers text messages to E.164 phone numbers.
+type Sender interface {
+	Send(to, message string) error
+}
+
+// New returns the sender matching the configured driver. An unknown driver is an error, so that a misspelt
+// configuration fails at startup instead of silently dropping every message.
+func New(config configuration.Sms) (sender Sender, err error) {
+	switch config.Driver {
+	case configuration.SmsDriverLog:
+		return LogSender{From: config.Sender}, nil
+	default:
+		return nil, fmt.Errorf("unknown sms driver %q", config.Driver)
+	}
+}
+
+// LogSender prints text messages to the standard logger instead of sending them. It stands in for a real
+// provider in development and tests.
+type LogSender struct {
+	From string
+}
+
+func (s LogSender) Send(to, message string) error {
+	log.Printf("sms from %s to %s: %s", s.From, to, message)
+	return nil
+}
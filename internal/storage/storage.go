@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"peec/internal/configuration"
+)
+
+// ThumbDirectory holds the thumbnails, next to the files they are made from.
+const ThumbDirectory = "thumb/"
+
+// Storage keeps the uploaded files. Names are relative to the storage, such as <xid><extension> or
+// thumb/<xid><extension>.
+type Storage interface {
+	// Save writes the uploaded file under name.
+	Save(file *multipart.FileHeader, name string) error
+	// Path returns where name is written on the local disk.
+	Path(name string) string
+	// Remove deletes name, a missing file being no error.
+	Remove(name string) error
+}
+
+// New returns the storage of the configured directory.
+func New(config configuration.Storage) Storage {
+	return Local{Directory: config.Directory}
+}
+
+// Local stores the files under Directory, which the API serves under /public.
+type Local struct {
+	Directory string
+}
+
+func (l Local) Save(file *multipart.FileHeader, name string) (err error) {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	path := l.Path(name)
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func (l Local) Path(name string) string {
+	return filepath.Join(l.Directory, filepath.FromSlash(name))
+}
+
+func (l Local) Remove(name string) (err error) {
+	err = os.Remove(l.Path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -10,6 +10,7 @@ func Lambda(err error) string {
 }
 
 var UnAuthorizedError = "UnAuthorized"
+var ForbiddenError = "Forbidden"
 var ParamsError = "parse params error"
 
 var (
@@ -21,6 +22,7 @@ var (
 	DuplicateUserError    = "user already exist"
 	LinkUserError         = "cannot link user"
 	DuplicateAddressError = "address already taken"
+	InvalidRoleError      = "invalid role"
 )
 
 var (
@@ -31,5 +33,71 @@ var (
 )
 
 var (
-	NeedPasswordError = "password must be set"
+	NeedPasswordError         = "password must be set"
+	InvalidPasswordResetError = "invalid or expired password reset code"
+	InvalidVerificationError  = "invalid or expired verification code"
+)
+
+var (
+	InvalidRefreshTokenError = "invalid refresh token"
+	RefreshTokenReuseError   = "refresh token already used, session revoked"
+	UnknownSessionError      = "unknown session"
+	InvalidQrLoginError      = "invalid qr login request"
+	ExpiredQrLoginError      = "qr login request expired or already used"
+)
+
+var (
+	InvalidTwoFactorCodeError    = "invalid two factor code"
+	InvalidTwoFactorChallenge    = "invalid or expired two factor challenge"
+	TwoFactorAlreadyEnabledError = "two factor authentication already enabled"
+	TwoFactorNotEnrolledError    = "two factor authentication not enrolled"
+)
+
+var (
+	SendMailError = "cannot send email"
+)
+
+var (
+	InvalidPhoneError    = "invalid phone number, expected E.164 format"
+	DuplicatePhoneError  = "phone number already registered"
+	UnknownPhoneError    = "unknown phone number"
+	UnverifiedPhoneError = "phone number not verified"
+	SendSmsError         = "cannot send text message"
+)
+
+var (
+	InvalidEmergencyContactError = "emergency contact needs a name, a known relationship and a positive priority"
+	UnknownEmergencyContactError = "unknown emergency contact"
+)
+
+var (
+	UnknownNotificationTypeError = "unknown notification type"
+	InvalidTimezoneError         = "invalid timezone, expected an IANA name such as Europe/Paris"
+	InvalidQuietHoursError       = "quiet hours expect a start and an end formatted as HH:MM"
+)
+
+var (
+	UnknownOutboxEventError = "unknown dead outbox event"
+)
+
+var (
+	InvalidWebhookError         = "webhook needs an http or https url and known event types"
+	UnknownWebhookError         = "unknown webhook"
+	UnknownWebhookDeliveryError = "unknown webhook delivery"
+)
+
+var (
+	UnknownDeletedUserError  = "unknown deleted user"
+	UnknownDeletedPostError  = "unknown deleted post"
+	UnknownDeletedMediaError = "unknown deleted media"
+)
+
+var (
+	UnknownPlanningError           = "unknown calendar planning"
+	UnknownPlanningInvitationError = "no pending invitation to this calendar planning"
+)
+
+var (
+	UnknownStudentError    = "unknown student"
+	UnknownParentLinkError = "no pending parent link with this user"
 )
@@ -1,10 +1,27 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"golang.org/x/crypto/bcrypt"
+	"runtime"
+)
+
+// passwordCost is the bcrypt cost of the new hashes. The hashes made with a former cost keep it.
+const passwordCost = 12
+
+// hashSlots bounds the bcrypt computations running at once, so that a burst of logins or password changes queues
+// instead of taking every CPU.
+var hashSlots = make(chan struct{}, runtime.NumCPU())
+
+func acquireHashSlot() (release func()) {
+	hashSlots <- struct{}{}
+	return func() { <-hashSlots }
+}
 
 func CreateContentHash(password string) (hash string, err error) {
+	defer acquireHashSlot()()
+
 	labelHashedPwd := LabelHash(password)
-	bytes, err := bcrypt.GenerateFromPassword([]byte(labelHashedPwd), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(labelHashedPwd), passwordCost)
 	if err != nil {
 		return hash, err
 	}
@@ -12,6 +29,8 @@ func CreateContentHash(password string) (hash string, err error) {
 }
 
 func RevertContentHash(password, hash string) bool {
+	defer acquireHashSlot()()
+
 	labelHashedPwd := LabelHash(password)
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(labelHashedPwd))
 	return err == nil
@@ -33,7 +52,9 @@ func LabelHash(label string) string {
 }
 
 func HashPassword(password string) (hash string, err error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	defer acquireHashSlot()()
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	if err != nil {
 		return hash, err
 	}
@@ -42,10 +63,13 @@ func HashPassword(password string) (hash string, err error) {
 }
 
 func CheckPasswordHash(password, hash string) bool {
+	defer acquireHashSlot()()
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
+// PasswordHasValidLength reports whether the password fits in the 72 bytes bcrypt takes into account.
 func PasswordHasValidLength(password string) bool {
-	return len(password)*4 > 72
+	return len(password) <= 72
 }
@@ -1,14 +1,28 @@
 package utils
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
+
+// E.164: a "+", a country code not starting with 0, up to fifteen digits overall.
+var e164Pattern = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
 
 /*
- CHECK IF MOBILE PHONE NUMBER IS NUMERIC AND A LENGHT OF THIRTEEN
+CHECK IF MOBILE PHONE NUMBER IS A VALID E.164 NUMBER, OF ANY COUNTRY
 */
 func IsValidPhone(phone string) bool {
-	pattern := `^[+]+\d{12}$`
-
-	re := regexp.MustCompile(pattern)
+	return e164Pattern.MatchString(phone)
+}
 
-	return re.MatchString(phone)
-}
\ No newline at end of file
+// NormalizePhone removes the usual separators and turns the international "00" prefix into "+".
+// ok is false when the result is not a valid E.164 number.
+func NormalizePhone(phone string) (normalized string, ok bool) {
+	normalized = phoneSeparators.Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(normalized, "00") {
+		normalized = "+" + normalized[2:]
+	}
+	return normalized, IsValidPhone(normalized)
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	for _, test := range []struct {
+		phone      string
+		normalized string
+		ok         bool
+	}{
+		{"+33612345678", "+33612345678", true},
+		{" +33 6 12 34 56 78 ", "+33612345678", true},
+		{"+1 (415) 555-2671", "+14155552671", true},
+		{"0033.6.12.34.56.78", "+33612345678", true},
+		{"0612345678", "0612345678", false},
+		{"+0612345678", "+0612345678", false},
+		{"+33", "+33", false},
+		{"+3361234567890123", "+3361234567890123", false},
+		{"+33 6 12 AB 56 78", "+33612AB5678", false},
+		{"", "", false},
+	} {
+		normalized, ok := NormalizePhone(test.phone)
+		if normalized != test.normalized || ok != test.ok {
+			t.Errorf("NormalizePhone(%q) = %q, %v, want %q, %v", test.phone, normalized, ok, test.normalized, test.ok)
+		}
+	}
+}
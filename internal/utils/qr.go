@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/yeqown/go-qrcode/v2"
+	"github.com/yeqown/go-qrcode/writer/standard"
+)
+
+type bufferCloser struct {
+	*bytes.Buffer
+}
+
+func (bufferCloser) Close() error {
+	return nil
+}
+
+// QrCodeDataUri encodes content as a PNG QR code embedded in a data URI, so that short-lived secrets
+// never end up in the public directory.
+func QrCodeDataUri(content string) (uri string, err error) {
+	var buffer bytes.Buffer
+
+	qrc, err := qrcode.New(content)
+	if err != nil {
+		return uri, err
+	}
+
+	w := standard.NewWithWriter(bufferCloser{&buffer}, standard.WithBuiltinImageEncoder(standard.PNG_FORMAT))
+	err = qrc.Save(w)
+	if err != nil {
+		return uri, err
+	}
+
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), err
+}
@@ -9,6 +9,7 @@ import (
 	"image/color"
 	"mime/multipart"
 	"peec/database"
+	"peec/internal/storage"
 	"time"
 )
 
@@ -41,7 +42,7 @@ type UserMediaDetail struct {
 /*
 CREATE THUMBNAIL FOR UPLOADED IMAGE
 */
-func CreateThumb(mediaXid string, extension string, file multipart.File) (err error) {
+func CreateThumb(db *database.DB, store storage.Storage, mediaXid string, extension string, file multipart.File) (err error) {
 	var (
 		mediaThumb MediaThumb
 		thumbnail  image.Image
@@ -56,7 +57,7 @@ func CreateThumb(mediaXid string, extension string, file multipart.File) (err er
 
 	dst := imaging.New(200, 200, color.NRGBA{0, 0, 0, 0})
 	dst = imaging.Paste(dst, thumbnail, image.Pt(0, 0))
-	err = imaging.Save(dst, FILE_UPLOAD_DIR+THUMB_FILE_UPLOAD_DIR+mediaXid+extension)
+	err = imaging.Save(dst, store.Path(storage.ThumbDirectory+mediaXid+extension))
 	if err != nil {
 		return
 	}
@@ -65,7 +66,7 @@ func CreateThumb(mediaXid string, extension string, file multipart.File) (err er
 	mediaThumb.MediaXid = mediaXid
 	mediaThumb.Xid = "T_" + xid.New().String()
 
-	_, err = database.InsertOne(mediaThumb)
+	_, err = db.InsertOne(mediaThumb)
 	if err != nil {
 		return err
 	}
@@ -76,7 +77,7 @@ func CreateThumb(mediaXid string, extension string, file multipart.File) (err er
 /*
 CREATE THUMBNAIL FOR UPLOADED COVER LETTER
 */
-func CreateDocumentThumb(mediaXid string, extension string, file *multipart.FileHeader) (err error) {
+func CreateDocumentThumb(db *database.DB, store storage.Storage, mediaXid string, extension string, file *multipart.FileHeader) (err error) {
 	var (
 		mediaThumb MediaThumb
 		thumbnail  image.Image
@@ -111,7 +112,7 @@ func CreateDocumentThumb(mediaXid string, extension string, file *multipart.File
 
 	dst := imaging.New(800, 1100, color.NRGBA{0, 0, 0, 0})
 	dst = imaging.Paste(dst, thumbnail, image.Pt(0, 0))
-	err = imaging.Save(dst, FILE_UPLOAD_DIR+THUMB_FILE_UPLOAD_DIR+mediaXid+".jpg")
+	err = imaging.Save(dst, store.Path(storage.ThumbDirectory+mediaXid+".jpg"))
 	if err != nil {
 		return err
 	}
@@ -120,7 +121,7 @@ func CreateDocumentThumb(mediaXid string, extension string, file *multipart.File
 	mediaThumb.MediaXid = mediaXid
 	mediaThumb.Xid = "T_" + xid.New().String()
 
-	_, err = database.InsertOne(mediaThumb)
+	_, err = db.InsertOne(mediaThumb)
 	if err != nil {
 		return err
 	}
@@ -1,5 +0,0 @@
-package utils
-
-const FILE_UPLOAD_DIR = "public/"
-const THUMB_FILE_UPLOAD_DIR = "thumb/"
-const QR_CODE_UPLOAD_DIR = "qr/"
@@ -1,21 +1,106 @@
 package main
 
 import (
-	"github.com/jmoiron/sqlx"
+	"context"
+	"fmt"
+	"log"
+	"os"
 	"peec/database"
+	"peec/database/migrator"
+	"peec/internal/app"
+	"peec/internal/configuration"
 	"peec/internal/route"
+	"strconv"
 )
 
 func main() {
-	defer func(Client *sqlx.DB) {
-		err := Client.Close()
+	config, err := configuration.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	a, err := app.New(config)
+	if err != nil {
+		panic(err)
+	}
+	defer a.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if len(config.Command) > 0 {
+		err = migrate(ctx, a.DB, config.Command)
 		if err != nil {
-			return
+			log.Println("migrate:", err)
+			a.Close()
+			os.Exit(1)
 		}
-	}(database.Client)
+		return
+	}
+
+	err = migrator.CheckSchema(ctx, a.DB)
+	if err != nil {
+		panic(err)
+	}
+
+	go a.Outbox.Run(ctx)
 
-	err := route.Serve()
+	err = route.Serve(a)
 	if err != nil {
 		panic(err)
 	}
 }
+
+// migrate runs the command line: migrate up|down|status|to <version>|baseline <version>.
+func migrate(ctx context.Context, db *database.DB, command []string) (err error) {
+	var (
+		done    []migrator.Migration
+		version int
+	)
+
+	if command[0] != "migrate" || len(command) < 2 {
+		return fmt.Errorf("usage: migrate up|down|status|to <version>|baseline <version>")
+	}
+
+	switch command[1] {
+	case "up":
+		done, err = migrator.Up(ctx, db)
+	case "down":
+		done, err = migrator.Down(ctx, db)
+	case "to", "baseline":
+		if len(command) < 3 {
+			return fmt.Errorf("usage: migrate %s <version>", command[1])
+		}
+
+		version, err = strconv.Atoi(command[2])
+		if err != nil {
+			return fmt.Errorf("invalid version %s", command[2])
+		}
+
+		if command[1] == "baseline" {
+			return migrator.Baseline(ctx, db, version)
+		}
+		done, err = migrator.To(ctx, db, version)
+	case "status":
+		statuses, err := migrator.Status(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %s", command[1])
+	}
+
+	for _, migration := range done {
+		fmt.Printf("%04d_%s\n", migration.Version, migration.Name)
+	}
+	return err
+}
@@ -3,6 +3,7 @@ package address
 import (
 	"net/http"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
@@ -13,6 +14,16 @@ import (
 	"github.com/joinverse/xid"
 )
 
+// Service serves the addresses of the users.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the address service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
 type Address struct {
 	Id          uint       `json:"id"`
 	Country     string     `json:"country"`
@@ -37,7 +48,7 @@ type UserAddress struct {
 	AddressType string     `json:"address_type"`
 }
 
-func NewAddress(ctx *gin.Context) {
+func (s *Service) NewAddress(ctx *gin.Context) {
 
 	var (
 		tok         *authentication.Token
@@ -62,7 +73,7 @@ func NewAddress(ctx *gin.Context) {
 		return
 	}
 	// get user address
-	isUser, err := GetUserAddressWithId(userId)
+	isUser, err := s.GetUserAddressWithId(userId)
 	if isUser.AddressId > state.ZERO {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DuplicateAddressError,
@@ -71,7 +82,7 @@ func NewAddress(ctx *gin.Context) {
 	}
 	address.Xid = xid.New().String()
 
-	address.Id, err = database.InsertOne(address)
+	address.Id, err = s.DB.InsertOne(address)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -82,7 +93,7 @@ func NewAddress(ctx *gin.Context) {
 	// Link new address to the current user
 	userAddress.UserId = userId
 	userAddress.AddressId = address.Id
-	_, err = database.InsertOne(userAddress)
+	_, err = s.DB.InsertOne(userAddress)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.LinkUserError,
@@ -97,7 +108,7 @@ func NewAddress(ctx *gin.Context) {
 /*
 UPDATE ADDRESS OF A USER BY PROVIDING ID IN THE BODY
 */
-func UpdateUserAddress(ctx *gin.Context) {
+func (s *Service) UpdateUserAddress(ctx *gin.Context) {
 	var (
 		address Address
 		err     error
@@ -117,7 +128,7 @@ func UpdateUserAddress(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Update(address)
+	err = s.DB.Update(address)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbUpdateError,
@@ -132,7 +143,7 @@ func UpdateUserAddress(ctx *gin.Context) {
 /*
 GET USER ADDRESS  BASED ON user_id PROVIDED IN PARAMS
 */
-func GetUserAddress(ctx *gin.Context) {
+func (s *Service) GetUserAddress(ctx *gin.Context) {
 	var (
 		tok *authentication.Token
 
@@ -151,10 +162,10 @@ func GetUserAddress(ctx *gin.Context) {
 
 	userId = uint(tok.UserId)
 
-	err = database.Get(&address, `SELECT address.*
+	err = s.DB.Get(&address, `SELECT address.*
     FROM address JOIN user_address 
     ON address.id = user_address.address_id 
-    WHERE user_address.user_id = ?`, userId)
+    WHERE user_address.user_id = ? AND `+database.NotDeleted("address")+` AND `+database.NotDeleted("user_address"), userId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -169,7 +180,7 @@ func GetUserAddress(ctx *gin.Context) {
 REMOVE USER ADDRESS  BASED ON user_id PROVIDED IN PARAMS
 */
 
-func RemoveUserAddress(ctx *gin.Context) {
+func (s *Service) RemoveUserAddress(ctx *gin.Context) {
 	var (
 		tok *authentication.Token
 
@@ -188,10 +199,10 @@ func RemoveUserAddress(ctx *gin.Context) {
 	}
 	userId = uint(tok.UserId)
 
-	err = database.Get(&address, `SELECT address.*
+	err = s.DB.Get(&address, `SELECT address.*
     FROM address JOIN user_address 
     ON address.id = user_address.address_id 
-    WHERE user_address.user_id = ?`, userId)
+    WHERE user_address.user_id = ? AND `+database.NotDeleted("address")+` AND `+database.NotDeleted("user_address"), userId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -199,7 +210,7 @@ func RemoveUserAddress(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Delete(address)
+	err = s.DB.Delete(address)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -208,14 +219,14 @@ func RemoveUserAddress(ctx *gin.Context) {
 	}
 	// and remove user_address
 
-	err = database.Get(&userAddress, `SELECT * FROM user_address where user_id = ?`, userId)
+	err = s.DB.Get(&userAddress, `SELECT * FROM user_address where user_id = ? AND `+database.NotDeleted("user_address"), userId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
 		})
 		return
 	}
-	err = database.Delete(userAddress)
+	err = s.DB.HardDelete(userAddress)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -229,8 +240,8 @@ func RemoveUserAddress(ctx *gin.Context) {
 GET USER_ADDRESS WITH USER_ID
 */
 
-func GetUserAddressWithId(userId uint) (userAddress UserAddress, err error) {
-	err = database.Get(&userAddress, "SELECT * FROM user_address Where user_id = ?", userId)
+func (s *Service) GetUserAddressWithId(userId uint) (userAddress UserAddress, err error) {
+	err = s.DB.Get(&userAddress, `SELECT * FROM user_address Where user_id = ? AND `+database.NotDeleted("user_address"), userId)
 	if err != nil {
 		return userAddress, err
 	}
@@ -1,11 +1,38 @@
 package code
 
 import (
-	"math/rand"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
 	"peec/database"
+	"peec/internal/app"
+	"peec/internal/utils/state"
 	"time"
 )
 
+// Service issues and checks the one time codes.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the code service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
+const (
+	PurposeEmailVerification = 0
+	PurposePasswordReset     = 1
+	PurposePhoneVerification = 2
+)
+
+const (
+	codeDigits      = 6
+	codeMax         = 1000000
+	codeMaxAttempts = 5
+)
+
 type Code struct {
 	Id               uint       `json:"id"`
 	CreatedAt        time.Time  `json:"created_at"`
@@ -13,28 +40,140 @@ type Code struct {
 	DeletedAt        *time.Time `json:"deleted_at"`
 	UserId           uint       `json:"user_id"`
 	VerificationCode int        `json:"value"`
+	Purpose          int        `json:"purpose"`
+	Reference        uint       `json:"reference"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	Attempts         int        `json:"attempts"`
+	IsUsed           bool       `json:"is_used"`
+	Ip               string     `json:"ip"`
+}
+
+type issuedCodes struct {
+	ForUser int
+	ForIp   int
+}
+
+// String returns the code as shown to the user, left padded with zeros to its fixed length.
+func (code Code) String() string {
+	return fmt.Sprintf("%0*d", codeDigits, code.VerificationCode)
+}
+
+// NewUserVerificationCode issues a six digits single use code validating the email of the user.
+// Any verification code previously issued to the user is invalidated.
+func (s *Service) NewUserVerificationCode(userId uint) (code Code, err error) {
+	return s.newCode(userId, PurposeEmailVerification, 0, state.EMPTY, s.Config.VerificationCodeLifeTime())
+}
+
+// ConsumeUserVerificationCode checks the code against the last verification code issued to the user and marks it as used.
+func (s *Service) ConsumeUserVerificationCode(userId uint, verificationCode int) (err error) {
+	return s.consumeCode(userId, PurposeEmailVerification, 0, verificationCode)
+}
+
+// GetPendingCode returns the last code issued to the user for purpose which is neither used nor expired.
+func (s *Service) GetPendingCode(userId uint, purpose int) (code Code, err error) {
+	err = s.DB.Get(&code, `SELECT * FROM code
+			WHERE user_id = ? AND purpose = ? AND is_used = false AND expires_at > UTC_TIMESTAMP() AND `+database.NotDeleted("code")+`
+			ORDER BY created_at DESC, id DESC LIMIT 1`, userId, purpose)
+	if err != nil {
+		return code, err
+	}
+	return code, err
 }
 
-func NewUserVerificationCode(userId uint) (err error) {
-	var code Code
-	code.VerificationCode = rand.Intn(9999)
+// NewPasswordResetCode issues a six digits single use code valid for the configured duration, requested from ip.
+// Any reset code previously issued to the user is invalidated.
+func (s *Service) NewPasswordResetCode(userId uint, ip string) (code Code, err error) {
+	return s.newCode(userId, PurposePasswordReset, 0, ip, s.Config.PasswordResetCodeLifeTime())
+}
+
+// CountPasswordResetCodes returns how many reset codes were issued over the last window minutes to the user, and
+// to the ip address.
+func (s *Service) CountPasswordResetCodes(userId uint, ip string, window int) (forUser, forIp int, err error) {
+	var issued issuedCodes
+
+	err = s.DB.Get(&issued, `SELECT COALESCE(SUM(user_id = ?), 0) AS for_user, COALESCE(SUM(ip = ?), 0) AS for_ip FROM code
+			WHERE purpose = ? AND (user_id = ? OR ip = ?) AND created_at > NOW() - INTERVAL ? MINUTE`,
+		userId, ip, PurposePasswordReset, userId, ip, window)
+	if err != nil {
+		return 0, 0, err
+	}
+	return issued.ForUser, issued.ForIp, err
+}
+
+// ConsumePasswordResetCode checks the code against the last reset code issued to the user and marks it as used.
+func (s *Service) ConsumePasswordResetCode(userId uint, verificationCode int) (err error) {
+	return s.consumeCode(userId, PurposePasswordReset, 0, verificationCode)
+}
+
+// NewPhoneVerificationCode issues a six digits single use code validating the phone number phoneId of the user.
+// Any phone verification code previously issued to the user is invalidated.
+func (s *Service) NewPhoneVerificationCode(userId, phoneId uint) (code Code, err error) {
+	return s.newCode(userId, PurposePhoneVerification, phoneId, state.EMPTY, s.Config.VerificationCodeLifeTime())
+}
+
+// ConsumePhoneVerificationCode checks the code against the last phone verification code issued to the user for phoneId
+// and marks it as used.
+func (s *Service) ConsumePhoneVerificationCode(userId, phoneId uint, verificationCode int) (err error) {
+	return s.consumeCode(userId, PurposePhoneVerification, phoneId, verificationCode)
+}
+
+// newCode issues a code for purpose. reference identifies what the code verifies when the user may own several of them,
+// like phone numbers, and is zero otherwise. ip is the address the code was requested from, when it is rate limited.
+func (s *Service) newCode(userId uint, purpose int, reference uint, ip string, lifeTime time.Duration) (code Code, err error) {
+	value, err := rand.Int(rand.Reader, big.NewInt(codeMax))
+	if err != nil {
+		return code, err
+	}
+
+	err = s.DB.Exec(`UPDATE code SET is_used = true WHERE user_id = ? AND purpose = ? AND is_used = false`, userId, purpose)
+	if err != nil {
+		return code, err
+	}
+
 	code.UserId = userId
+	code.Purpose = purpose
+	code.Reference = reference
+	code.Ip = ip
+	code.VerificationCode = int(value.Int64())
+	code.ExpiresAt = time.Now().UTC().Add(lifeTime)
 
-	_, err = database.InsertOne(code)
+	code.Id, err = s.DB.InsertOne(code)
 	if err != nil {
-		return err
+		return code, err
 	}
 
-	return err
+	return code, err
 }
 
-func IsUserVerificationCodeValid(userId uint, verificationCode int) (err error) {
-	var code Code
-	var query = `SELECT * FROM code WHERE user_id = ? AND verification_code = ? ORDER BY created_at desc LIMIT 1`
-	err = database.Get(&code, query, userId, verificationCode)
+// consumeCode marks the pending code as used when it matches. The code is invalidated after too many wrong attempts.
+func (s *Service) consumeCode(userId uint, purpose int, reference uint, verificationCode int) (err error) {
+	code, err := s.GetPendingCode(userId, purpose)
+	if err != nil || code.Reference != reference {
+		return errors.New("no pending code")
+	}
+
+	if code.VerificationCode != verificationCode {
+		err = s.DB.Exec(`UPDATE code SET attempts = attempts + 1, is_used = attempts >= ? WHERE id = ?`,
+			codeMaxAttempts, code.Id)
+		if err != nil {
+			return err
+		}
+		return errors.New("invalid code")
+	}
+
+	result, err := s.DB.Client.Exec(`UPDATE code SET is_used = true WHERE id = ? AND is_used = false`, code.Id)
 	if err != nil {
 		return err
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected != 1 {
+		return errors.New("code already used")
+	}
+
 	return err
 }
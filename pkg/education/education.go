@@ -1,11 +1,12 @@
 package education
 
 import (
-	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
+	"peec/internal/query"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
@@ -14,6 +15,17 @@ import (
 	"time"
 )
 
+// Service serves the education records of the users.
+type Service struct {
+	*app.App
+	authorizations *authorization.Service
+}
+
+// NewService returns the education service.
+func NewService(a *app.App, authorizations *authorization.Service) *Service {
+	return &Service{App: a, authorizations: authorizations}
+}
+
 type Education struct {
 	Id        uint       `json:"id"`
 	CreatedAt time.Time  `json:"created_at"`
@@ -40,10 +52,26 @@ type UserEducationLevelSubject struct {
 	SubjectId uint       `json:"subject_id"`
 }
 
-func GetSubjects(ctx *gin.Context) {
+var educationSpec = query.Spec{
+	Table:        "education",
+	Sorts:        []string{"created_at", "name"},
+	DefaultSort:  "created_at",
+	DefaultLimit: 100,
+}
+
+var subjectSpec = query.Spec{
+	Table:        "subject",
+	Sorts:        []string{"created_at", "name"},
+	Filters:      []string{"education_level_id"},
+	DefaultSort:  "name",
+	DefaultLimit: 100,
+}
+
+func (s *Service) GetSubjects(ctx *gin.Context) {
 	var (
 		err      error
-		subjects []Subject
+		q        query.Query
+		subjects query.Page[Subject]
 		eduId    int
 	)
 
@@ -54,7 +82,15 @@ func GetSubjects(ctx *gin.Context) {
 		})
 	}
 
-	err = database.Select(&subjects, `SELECT * FROM subject WHERE education_level_id = ?`, eduId)
+	q, err = query.Parse(ctx, subjectSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	subjects, err = query.List[Subject](s.DB, q, "subject", "subject.education_level_id = ?", eduId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -66,13 +102,22 @@ func GetSubjects(ctx *gin.Context) {
 	return
 }
 
-func GetEducation(ctx *gin.Context) {
+func (s *Service) GetEducation(ctx *gin.Context) {
 	var (
 		err  error
-		edus []Education
+		q    query.Query
+		edus query.Page[Education]
 	)
 
-	err = database.Select(&edus, `SELECT * FROM education WHERE id > 0 ORDER BY  created_at`)
+	q, err = query.Parse(ctx, educationSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	edus, err = query.List[Education](s.DB, q, "education", "education.id > 0")
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -86,7 +131,7 @@ func GetEducation(ctx *gin.Context) {
 
 // User educationLevel
 
-func SetUserEducationLevel(ctx *gin.Context) {
+func (s *Service) SetUserEducationLevel(ctx *gin.Context) {
 	var (
 		tok                       *authentication.Token
 		userEducationLevelSubject UserEducationLevelSubject
@@ -107,15 +152,6 @@ func SetUserEducationLevel(ctx *gin.Context) {
 		return
 	}
 
-	if !authorization.IsUserStudent(tok.UserId) {
-		if !authorization.IsUserProfessor(tok.UserId) {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-				Message: errx.Lambda(errors.New("not as student or professor")),
-			})
-			return
-		}
-	}
-
 	err = ctx.ShouldBindJSON(&subject)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
@@ -127,7 +163,7 @@ func SetUserEducationLevel(ctx *gin.Context) {
 	userEducationLevelSubject.SubjectId = uint(subject.Id)
 	userEducationLevelSubject.UserId = tok.UserId
 
-	_, err = database.InsertOne(userEducationLevelSubject)
+	_, err = s.DB.InsertOne(userEducationLevelSubject)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -135,7 +171,7 @@ func SetUserEducationLevel(ctx *gin.Context) {
 		return
 	}
 
-	userLevel, err := GetUserLevel(tok.UserId)
+	userLevel, err := s.GetUserLevel(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{Message: errx.DbGetError})
 		return
@@ -144,7 +180,7 @@ func SetUserEducationLevel(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, userLevel)
 }
 
-func GetUserEducationLevel(ctx *gin.Context) {
+func (s *Service) GetUserEducationLevel(ctx *gin.Context) {
 	var (
 		err error
 		tok *authentication.Token
@@ -158,7 +194,7 @@ func GetUserEducationLevel(ctx *gin.Context) {
 		return
 	}
 
-	userLevel, err := GetUserLevel(tok.UserId)
+	userLevel, err := s.GetUserLevel(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -170,7 +206,7 @@ func GetUserEducationLevel(ctx *gin.Context) {
 
 }
 
-func UpdateUserEducationLevel(ctx *gin.Context) {
+func (s *Service) UpdateUserEducationLevel(ctx *gin.Context) {
 	var (
 		tok                              *authentication.Token
 		currentUserEducationLevelSubject UserEducationLevelSubject
@@ -193,13 +229,6 @@ func UpdateUserEducationLevel(ctx *gin.Context) {
 		return
 	}
 
-	if !authorization.IsUserStudent(tok.UserId) {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Not a student",
-		})
-		return
-	}
-
 	err = ctx.ShouldBindJSON(&subject)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
@@ -208,8 +237,8 @@ func UpdateUserEducationLevel(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Get(&currentUserEducationLevelSubject, `SELECT user_education_level_subject.* FROM user_education_level_subject
-			WHERE user_education_level_subject.user_id = ?`, tok.UserId)
+	err = s.DB.Get(&currentUserEducationLevelSubject, `SELECT user_education_level_subject.* FROM user_education_level_subject
+			WHERE user_education_level_subject.user_id = ? AND `+database.NotDeleted("user_education_level_subject"), tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -217,7 +246,7 @@ func UpdateUserEducationLevel(ctx *gin.Context) {
 		return
 	}
 
-	err = RemoveUserEducationLevelSubject(currentUserEducationLevelSubject)
+	err = s.RemoveUserEducationLevelSubject(currentUserEducationLevelSubject)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -227,7 +256,7 @@ func UpdateUserEducationLevel(ctx *gin.Context) {
 
 	userEducationLevelSubject.SubjectId = subject.Id
 	userEducationLevelSubject.UserId = tok.UserId
-	_, err = database.InsertOne(userEducationLevelSubject)
+	_, err = s.DB.InsertOne(userEducationLevelSubject)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -235,7 +264,7 @@ func UpdateUserEducationLevel(ctx *gin.Context) {
 		return
 	}
 
-	userLevel, err := GetUserLevel(tok.UserId)
+	userLevel, err := s.GetUserLevel(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{Message: errx.DbGetError})
 		return
@@ -246,9 +275,10 @@ func UpdateUserEducationLevel(ctx *gin.Context) {
 
 // User education subjects
 
-func GetUserSubjects(ctx *gin.Context) {
+func (s *Service) GetUserSubjects(ctx *gin.Context) {
 	var (
-		subjects []Subject
+		q        query.Query
+		subjects query.Page[Subject]
 		tok      *authentication.Token
 		err      error
 	)
@@ -260,36 +290,31 @@ func GetUserSubjects(ctx *gin.Context) {
 		return
 	}
 
-	if authorization.IsUserParent(tok.UserId) || authorization.IsUserTutor(tok.UserId) {
+	q, err = query.Parse(ctx, subjectSpec)
+	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
+			Message: errx.Lambda(err),
 		})
 		return
 	}
 
-	if authorization.IsUserStudent(tok.UserId) {
-		err = database.GetMany(&subjects, `SELECT subject.* 
-											FROM subject
-											WHERE subject.education_level_id = (SELECT education.id FROM education  JOIN subject ON education.id  =  subject.education_level_id JOIN user_education_level_subject ON subject.id = user_education_level_subject.subject_id
-                                   			WHERE user_education_level_subject.user_id = ?)`, tok.UserId)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-				Message: errx.DbGetError,
-			})
-			return
-		}
+	// A professor lists the subjects taught, a student the subjects of its education level.
+	from, where := "subject", `subject.education_level_id = (SELECT education.id FROM education  JOIN subject ON education.id  =  subject.education_level_id JOIN user_education_level_subject ON subject.id = user_education_level_subject.subject_id
+                                   			WHERE user_education_level_subject.user_id = ?)`
+	if s.authorizations.IsUserProfessor(tok.UserId) {
+		from, where = `subject
+			JOIN user_education_level_subject  ON subject.id = user_education_level_subject.subject_id`, `user_education_level_subject.user_id = ? AND `+database.NotDeleted("user_education_level_subject")
+	} else if !s.authorizations.IsUserStudent(tok.UserId) {
+		ctx.AbortWithStatusJSON(http.StatusOK, query.Page[Subject]{Items: []Subject{}, Limit: q.Limit, Page: q.Page})
+		return
 	}
 
-	if authorization.IsUserProfessor(tok.UserId) {
-		err = database.GetMany(&subjects, `SELECT subject.* FROM subject
-			JOIN user_education_level_subject  ON subject.id = user_education_level_subject.subject_id
-			WHERE user_education_level_subject.user_id = ?`, tok.UserId)
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-				Message: errx.DbGetError,
-			})
-			return
-		}
+	subjects, err = query.List[Subject](s.DB, q, from, where, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
 	}
 
 	ctx.AbortWithStatusJSON(http.StatusOK, subjects)
@@ -299,13 +324,14 @@ func GetUserSubjects(ctx *gin.Context) {
 	UTILS
 */
 
-func GetUserLevel(userId uint) (educationLevel Education, err error) {
+func (s *Service) GetUserLevel(userId uint) (educationLevel Education, err error) {
 
-	err = database.Get(&educationLevel,
+	err = s.DB.Get(&educationLevel,
 		`SELECT education.* FROM education
 				JOIN subject ON education.id  =  subject.education_level_id
 				JOIN user_education_level_subject ON subject.id = user_education_level_subject.subject_id
-			WHERE user_education_level_subject.user_id = ?`, userId)
+			WHERE user_education_level_subject.user_id = ? AND `+database.NotDeleted("user_education_level_subject")+`
+				AND `+database.NotDeleted("subject")+` AND `+database.NotDeleted("education"), userId)
 	if err != nil {
 		return educationLevel, err
 	}
@@ -313,8 +339,8 @@ func GetUserLevel(userId uint) (educationLevel Education, err error) {
 	return educationLevel, err
 }
 
-func RemoveUserEducationLevelSubject(userEducationLevelSubject UserEducationLevelSubject) (err error) {
-	err = database.Delete(userEducationLevelSubject)
+func (s *Service) RemoveUserEducationLevelSubject(userEducationLevelSubject UserEducationLevelSubject) (err error) {
+	err = s.DB.HardDelete(userEducationLevelSubject)
 	if err != nil {
 		return err
 	}
@@ -1,31 +1,58 @@
 package mark
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 	"net/http"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
+	"peec/internal/outbox"
+	"peec/internal/query"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
-	"peec/pkg/user/authorization"
+	"peec/pkg/notification"
 	"strconv"
 	"time"
 )
 
+// Service serves the marks users give each other.
+type Service struct {
+	*app.App
+	notifications *notification.Service
+}
+
+// NewService returns the mark service, subscribing the rating notification to the outbox.
+func NewService(a *app.App, notifications *notification.Service) *Service {
+	s := &Service{App: a, notifications: notifications}
+	s.Outbox.Subscribe("mark.rating_notification", outbox.EventUserRated, s.notifyRatedUser)
+	return s
+}
+
 type UserMark struct {
-	Id            uint       `json:"id"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
-	DeletedAt     *time.Time `json:"deleted_at"`
-	UserId        uint       `json:"user_id"`
-	AuthorId      uint       `json:"author_id"`
-	AuthorComment string     `json:"author_comment"`
-	AuthorMark    uint       `json:"author_mark"`
+	Id                    uint       `json:"id"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	DeletedAt             *time.Time `json:"deleted_at"`
+	UserId                uint       `json:"user_id"`
+	AuthorId              uint       `json:"author_id"`
+	AuthorAuthorizationId uint       `json:"author_authorization_id"`
+	AuthorComment         string     `json:"author_comment"`
+	AuthorMark            uint       `json:"author_mark"`
 }
 
-func RateUser(ctx *gin.Context) {
+var markSpec = query.Spec{
+	Table:       "user_mark",
+	Sorts:       []string{"created_at", "author_mark"},
+	Filters:     []string{"user_id", "author_mark"},
+	DefaultSort: "-created_at",
+}
+
+func (s *Service) RateUser(ctx *gin.Context) {
 	var (
 		tok         *authentication.Token
 		studentMark UserMark
@@ -39,20 +66,6 @@ func RateUser(ctx *gin.Context) {
 		return
 	}
 
-	if authorization.IsUserStudent(tok.UserId) {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
-		})
-		return
-	}
-
-	if authorization.IsUserParent(tok.UserId) {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
-		})
-		return
-	}
-
 	err = ctx.ShouldBindJSON(&studentMark)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
@@ -69,7 +82,8 @@ func RateUser(ctx *gin.Context) {
 	}
 
 	studentMark.AuthorId = tok.UserId
-	err = SetUserMark(studentMark)
+	studentMark.AuthorAuthorizationId = tok.AuthorizationId
+	studentMark.Id, err = s.SetUserMark(ctx.Request.Context(), studentMark)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -80,7 +94,7 @@ func RateUser(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, studentMark)
 }
 
-func GetUserAverageMark(ctx *gin.Context) {
+func (s *Service) GetUserAverageMark(ctx *gin.Context) {
 	var (
 		userMarks []UserMark
 		err       error
@@ -95,7 +109,7 @@ func GetUserAverageMark(ctx *gin.Context) {
 		return
 	}
 
-	err = database.GetMany(&userMarks, `SELECT user_mark.* FROM user_mark WHERE user_id = ?`, userId)
+	err = s.DB.GetMany(&userMarks, `SELECT user_mark.* FROM user_mark WHERE user_id = ?`, userId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -120,11 +134,13 @@ func GetUserAverageMark(ctx *gin.Context) {
 	})
 }
 
-func GetUserMarkComment(ctx *gin.Context) {
+// GetUserMarkComment lists the marks given by the user, most recent first. See query.Query for the parameters.
+func (s *Service) GetUserMarkComment(ctx *gin.Context) {
 	var (
 		tok  *authentication.Token
 		err  error
-		mark []UserMark
+		q    query.Query
+		mark query.Page[UserMark]
 	)
 	tok, err = authentication.GetTokenDataFromContext(ctx)
 	if err != nil {
@@ -134,17 +150,15 @@ func GetUserMarkComment(ctx *gin.Context) {
 		return
 	}
 
-	if authorization.IsUserStudent(tok.UserId) || authorization.IsUserParent(tok.UserId) {
+	q, err = query.Parse(ctx, markSpec)
+	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
+			Message: errx.Lambda(err),
 		})
 		return
 	}
 
-	err = database.GetMany(&mark,
-		`SELECT user_mark.* 
-			FROM user_mark
-			WHERE user_mark.author_id= ?;`, tok.UserId)
+	mark, err = query.List[UserMark](s.DB, q, "user_mark", "user_mark.author_authorization_id = ?", tok.AuthorizationId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -160,10 +174,38 @@ func GetUserMarkComment(ctx *gin.Context) {
 	UTILS
 */
 
-func SetUserMark(userMark UserMark) (err error) {
-	_, err = database.InsertOne(userMark)
+// SetUserMark inserts the mark along with the event notifying the rated user.
+func (s *Service) SetUserMark(ctx context.Context, userMark UserMark) (id uint, err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		id, err = database.InsertOneTx(tx, userMark)
+		if err != nil {
+			return err
+		}
+
+		err = s.Outbox.Enqueue(tx, outbox.EventUserRated, outbox.UserRated{
+			UserMarkId: id,
+			UserId:     userMark.UserId,
+			AuthorId:   userMark.AuthorId,
+			Mark:       userMark.AuthorMark,
+		})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return id, err
+}
+
+// notifyRatedUser is the outbox handler telling a user about a new mark.
+func (s *Service) notifyRatedUser(event outbox.OutboxEvent) (err error) {
+	var rated outbox.UserRated
+
+	err = event.Decode(&rated)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return s.notifications.Notify(event.Id, rated.UserId, rated.AuthorId, notification.TypeUserMark, rated.UserMarkId,
+		fmt.Sprintf("You received a %d star mark", rated.Mark))
 }
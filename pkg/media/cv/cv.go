@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"path/filepath"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
-	"peec/internal/configuration"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
@@ -18,6 +18,16 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Service serves the CVs and the cover letters of the users.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the CV service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
 const (
 	TypeCv = utils.CV
 )
@@ -43,7 +53,7 @@ type UserMediaDetail struct {
 	DocumentXid  string     `json:"document_xid"`
 }
 
-func UploadCv(ctx *gin.Context) {
+func (s *Service) UploadCv(ctx *gin.Context) {
 	var (
 		media Media
 		tok   *authentication.Token
@@ -92,14 +102,14 @@ func UploadCv(ctx *gin.Context) {
 	media.Extension = filepath.Ext(file.Filename)
 	media.Xid = xid.New().String()
 
-	err = ctx.SaveUploadedFile(file, utils.FILE_UPLOAD_DIR+media.Xid+media.Extension)
+	err = s.Storage.Save(file, media.Xid+media.Extension)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
 		})
 		return
 	}
-	err = utils.CreateDocumentThumb(media.Xid, media.Extension, file)
+	err = utils.CreateDocumentThumb(s.DB, s.Storage, media.Xid, media.Extension, file)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: "Failed to create thumb for the document",
@@ -108,7 +118,7 @@ func UploadCv(ctx *gin.Context) {
 		return
 	}
 
-	_, err = database.InsertOne(media)
+	_, err = s.DB.InsertOne(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -116,7 +126,7 @@ func UploadCv(ctx *gin.Context) {
 		return
 	}
 
-	err = SetUserMediaDetail(tok.UserId, media.Xid)
+	err = s.SetUserMediaDetail(tok.UserId, media.Xid)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -126,7 +136,7 @@ func UploadCv(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, media)
 }
 
-func GetProfileCv(ctx *gin.Context) {
+func (s *Service) GetProfileCv(ctx *gin.Context) {
 	var (
 		err   error
 		media Media
@@ -141,11 +151,11 @@ func GetProfileCv(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Get(&media, `SELECT media.*
+	err = s.DB.Get(&media, `SELECT media.*
 FROM media
          JOIN user_media_detail ON media.xid = user_media_detail.document_xid
          JOIN user ON user.id = user_media_detail.owner_id
-WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ?`, tok.UserId, TypeCv)
+WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail")+` AND `+database.NotDeleted("user"), tok.UserId, TypeCv)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -153,13 +163,13 @@ WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ?`, t
 		return
 	}
 
-	networkLink := "http://" + configuration.App.Host + ":" + configuration.App.Port + "/api/public/" + media.Xid + media.Extension
+	networkLink := "http://" + s.Config.Host + ":" + s.Config.Port + "/api/public/" + media.Xid + media.Extension
 
 	ctx.JSON(http.StatusOK, networkLink)
 	return
 }
 
-func GetProfileCvThumb(ctx *gin.Context) {
+func (s *Service) GetProfileCvThumb(ctx *gin.Context) {
 	var (
 		err        error
 		mediaThumb utils.MediaThumb
@@ -174,7 +184,7 @@ func GetProfileCvThumb(ctx *gin.Context) {
 		return
 	}
 
-	mediaThumb, err = GetCurrentUserCvThumb(tok.UserId)
+	mediaThumb, err = s.GetCurrentUserCvThumb(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -182,13 +192,13 @@ func GetProfileCvThumb(ctx *gin.Context) {
 		return
 	}
 
-	networkLink := "http://" + configuration.App.Host + ":" + configuration.App.Port + "/api/public/thumb/" + mediaThumb.MediaXid + mediaThumb.Extension
+	networkLink := "http://" + s.Config.Host + ":" + s.Config.Port + "/api/public/thumb/" + mediaThumb.MediaXid + mediaThumb.Extension
 
 	ctx.JSON(http.StatusOK, networkLink)
 	return
 }
 
-func UpdateProfileCv(ctx *gin.Context) {
+func (s *Service) UpdateProfileCv(ctx *gin.Context) {
 	var (
 		media Media
 		tok   *authentication.Token
@@ -218,7 +228,7 @@ func UpdateProfileCv(ctx *gin.Context) {
 		return
 	}
 
-	oldMedia, err := GetCurrentUserCv(tok.UserId)
+	oldMedia, err := s.GetCurrentUserCv(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -230,14 +240,14 @@ func UpdateProfileCv(ctx *gin.Context) {
 	media.Extension = filepath.Ext(file.Filename)
 	media.Xid = oldMedia.Xid
 
-	err = RemoveCurrentUserCv(oldMedia)
+	err = s.RemoveCurrentUserCv(oldMedia)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
 		})
 	}
 
-	_, err = database.InsertOne(media)
+	_, err = s.DB.InsertOne(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -246,7 +256,7 @@ func UpdateProfileCv(ctx *gin.Context) {
 	ctx.AbortWithStatus(http.StatusOK)
 }
 
-func RemoveProfileCv(ctx *gin.Context) {
+func (s *Service) RemoveProfileCv(ctx *gin.Context) {
 	var (
 		media media.Media
 		tok   *authentication.Token
@@ -267,7 +277,7 @@ func RemoveProfileCv(ctx *gin.Context) {
 		})
 		return
 	}
-	media, err = GetCurrentUserCv(tok.UserId)
+	media, err = s.GetCurrentUserCv(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.UnAuthorizedError,
@@ -275,7 +285,7 @@ func RemoveProfileCv(ctx *gin.Context) {
 		return
 	}
 
-	err = RemoveCurrentUserCv(media)
+	err = s.RemoveCurrentUserCv(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -283,7 +293,7 @@ func RemoveProfileCv(ctx *gin.Context) {
 		return
 	}
 
-	userMediaDetail, err := GetUserMediaDetail(tok.UserId)
+	userMediaDetail, err := s.GetUserMediaDetail(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -291,7 +301,7 @@ func RemoveProfileCv(ctx *gin.Context) {
 		return
 	}
 
-	err = RemoveUserMediaDetail(userMediaDetail)
+	err = s.RemoveUserMediaDetail(userMediaDetail)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -321,62 +331,62 @@ func DetectMimeType(file *multipart.FileHeader) (mType *mimetype.MIME, err error
 	return mType, nil
 }
 
-func SetUserMediaDetail(userId uint, documentXid string) (err error) {
+func (s *Service) SetUserMediaDetail(userId uint, documentXid string) (err error) {
 	var (
 		userMediaDetail UserMediaDetail
 	)
 	userMediaDetail.OwnerId = userId
 	userMediaDetail.DocumentType = TypeCv
 	userMediaDetail.DocumentXid = documentXid
-	_, err = database.InsertOne(userMediaDetail)
+	_, err = s.DB.InsertOne(userMediaDetail)
 	if err != nil {
 		return err
 	}
 	return
 }
 
-func GetUserMediaDetail(userId uint) (userMediaDetail UserMediaDetail, err error) {
-	err = database.Get(&userMediaDetail, `SELECT user_media_detail.* FROM  user_media_detail WHERE user_media_detail.owner_id =? `, userId)
+func (s *Service) GetUserMediaDetail(userId uint) (userMediaDetail UserMediaDetail, err error) {
+	err = s.DB.Get(&userMediaDetail, `SELECT user_media_detail.* FROM  user_media_detail WHERE user_media_detail.owner_id =? AND `+database.NotDeleted("user_media_detail"), userId)
 	if err != nil {
 		return userMediaDetail, err
 	}
 	return userMediaDetail, err
 }
 
-func GetCurrentUserCv(userId uint) (media media.Media, err error) {
-	err = database.Get(&media, `SELECT media.*
+func (s *Service) GetCurrentUserCv(userId uint) (media media.Media, err error) {
+	err = s.DB.Get(&media, `SELECT media.*
 FROM media
          JOIN user_media_detail ON media.xid = user_media_detail.document_xid
          JOIN user ON user.id = user_media_detail.owner_id
-WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ?`, userId, TypeCv)
+WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail")+` AND `+database.NotDeleted("user"), userId, TypeCv)
 	if err != nil {
 		return media, err
 	}
 	return media, err
 }
 
-func GetCurrentUserCvThumb(userId uint) (media utils.MediaThumb, err error) {
-	err = database.Get(&media, `SELECT media_thumb.*
+func (s *Service) GetCurrentUserCvThumb(userId uint) (media utils.MediaThumb, err error) {
+	err = s.DB.Get(&media, `SELECT media_thumb.*
 FROM media_thumb
          JOIN media ON media.xid = media_thumb.media_xid
          JOIN user_media_detail ON media.xid = user_media_detail.document_xid
-WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ?`, userId, TypeCv)
+WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail"), userId, TypeCv)
 	if err != nil {
 		return media, err
 	}
 	return media, err
 }
 
-func RemoveUserMediaDetail(userMediaDetail UserMediaDetail) (err error) {
-	err = database.Delete(userMediaDetail)
+func (s *Service) RemoveUserMediaDetail(userMediaDetail UserMediaDetail) (err error) {
+	err = s.DB.Delete(userMediaDetail)
 	if err != nil {
 		return err
 	}
 	return
 }
 
-func RemoveCurrentUserCv(media media.Media) (err error) {
-	err = database.Delete(media)
+func (s *Service) RemoveCurrentUserCv(media media.Media) (err error) {
+	err = s.DB.Delete(media)
 	if err != nil {
 		return err
 	}
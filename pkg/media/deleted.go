@@ -0,0 +1,93 @@
+package media
+
+import (
+	"context"
+	"net/http"
+	"peec/database"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var deletedMediaSpec = query.Spec{
+	Table:       "media",
+	Sorts:       []string{"created_at", "deleted_at"},
+	Filters:     []string{"xid"},
+	DefaultSort: "-deleted_at",
+	Deleted:     true,
+}
+
+// GetDeletedMedia lists the soft deleted media, last deleted first.
+func (s *Service) GetDeletedMedia(ctx *gin.Context) {
+	var (
+		err   error
+		q     query.Query
+		media query.Page[Media]
+	)
+
+	q, err = query.Parse(ctx, deletedMediaSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	media, err = query.List[Media](s.DB, q, "media", "")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, media)
+}
+
+// RestoreMedia brings a soft deleted media back, along with the details linking it to its owner. A restored profile
+// image is not made the current one again.
+func (s *Service) RestoreMedia(ctx *gin.Context) {
+	var media Media
+
+	mediaId, err := strconv.Atoi(ctx.Param("media_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = s.DB.Get(&media, `SELECT * FROM media WHERE id = ? AND `+database.DeletedClause, mediaId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownDeletedMediaError,
+		})
+		return
+	}
+
+	err = s.restoreMedia(ctx.Request.Context(), media)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	media.DeletedAt = nil
+	ctx.JSON(http.StatusOK, media)
+}
+
+func (s *Service) restoreMedia(ctx context.Context, media Media) (err error) {
+	return s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		err = database.ExecTx(tx, `UPDATE media SET deleted_at = NULL WHERE id = ?`, media.Id)
+		if err != nil {
+			return err
+		}
+
+		return database.ExecTx(tx, `UPDATE user_media_detail SET deleted_at = NULL WHERE document_xid = ?`, media.Xid)
+	})
+}
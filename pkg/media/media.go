@@ -4,7 +4,7 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	"net/http"
 	"path/filepath"
-	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
@@ -15,6 +15,16 @@ import (
 	"github.com/joinverse/xid"
 )
 
+// Service serves the uploaded media, kept in the storage of the application.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the media service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
 const (
 	CV               = 0
 	CoverLetter      = 1
@@ -42,7 +52,7 @@ type UserMediaDetail struct {
 	DocumentType uint       `json:"document_type"`
 }
 
-func Upload(ctx *gin.Context) {
+func (s *Service) Upload(ctx *gin.Context) {
 	var (
 		media        Media
 		documentType uint
@@ -90,7 +100,7 @@ func Upload(ctx *gin.Context) {
 	media.Extension = filepath.Ext(file.Filename)
 	media.Xid = xid.New().String()
 
-	err = ctx.SaveUploadedFile(file, utils.FILE_UPLOAD_DIR+media.Xid+media.Extension)
+	err = s.Storage.Save(file, media.Xid+media.Extension)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -107,7 +117,7 @@ func Upload(ctx *gin.Context) {
 	}
 
 	defer openedFile.Close()
-	err = utils.CreateThumb(media.Xid, media.Extension, openedFile)
+	err = utils.CreateThumb(s.DB, s.Storage, media.Xid, media.Extension, openedFile)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -115,7 +125,7 @@ func Upload(ctx *gin.Context) {
 		return
 	}
 
-	_, err = database.InsertOne(media)
+	_, err = s.DB.InsertOne(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -131,7 +141,7 @@ func Upload(ctx *gin.Context) {
 	if utils.IsValidVideo(mType.String()) {
 
 	}
-	err = SetUserMediaDetail(documentType, tok.UserId)
+	err = s.SetUserMediaDetail(documentType, tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -141,14 +151,14 @@ func Upload(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, media)
 }
 
-func SetUserMediaDetail(documentType uint, userId uint) (err error) {
+func (s *Service) SetUserMediaDetail(documentType uint, userId uint) (err error) {
 	var (
 		userMediaDetail UserMediaDetail
 	)
 
 	userMediaDetail.OwnerId = userId
 	userMediaDetail.DocumentType = documentType
-	_, err = database.InsertOne(userMediaDetail)
+	_, err = s.DB.InsertOne(userMediaDetail)
 	if err != nil {
 		return err
 	}
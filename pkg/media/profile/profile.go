@@ -5,11 +5,11 @@ import (
 	"github.com/joinverse/xid"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
-	"peec/internal/configuration"
+	"peec/internal/storage"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
@@ -20,6 +20,16 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Service serves the profile images of the users.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the profile image service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
 const (
 	UserProfileImage = 3
 )
@@ -34,7 +44,7 @@ type Media struct {
 	Xid       string     `json:"xid"`
 }
 
-func Upload(ctx *gin.Context) {
+func (s *Service) Upload(ctx *gin.Context) {
 	var (
 		media Media
 		tok   *authentication.Token
@@ -83,7 +93,7 @@ func Upload(ctx *gin.Context) {
 	media.Extension = filepath.Ext(file.Filename)
 	media.Xid = xid.New().String()
 
-	err = ctx.SaveUploadedFile(file, utils.FILE_UPLOAD_DIR+media.Xid+media.Extension)
+	err = s.Storage.Save(file, media.Xid+media.Extension)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -109,7 +119,7 @@ func Upload(ctx *gin.Context) {
 		}
 	}(openedFile)
 
-	err = utils.CreateThumb(media.Xid, media.Extension, openedFile)
+	err = utils.CreateThumb(s.DB, s.Storage, media.Xid, media.Extension, openedFile)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -117,7 +127,7 @@ func Upload(ctx *gin.Context) {
 		return
 	}
 
-	_, err = database.InsertOne(media)
+	_, err = s.DB.InsertOne(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -125,7 +135,7 @@ func Upload(ctx *gin.Context) {
 		return
 	}
 
-	err = UpdateUserProfileImageXid(tok.UserId, media.Xid)
+	err = s.UpdateUserProfileImageXid(tok.UserId, media.Xid)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -133,7 +143,7 @@ func Upload(ctx *gin.Context) {
 		return
 	}
 
-	err = SetUserMediaDetail(tok.UserId)
+	err = s.SetUserMediaDetail(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -143,7 +153,7 @@ func Upload(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, media)
 }
 
-func GetProfileImage(ctx *gin.Context) {
+func (s *Service) GetProfileImage(ctx *gin.Context) {
 	var (
 		err   error
 		media Media
@@ -158,11 +168,11 @@ func GetProfileImage(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Get(&media, `SELECT media.*
+	err = s.DB.Get(&media, `SELECT media.*
 FROM media
          JOIN user ON user.profile_image_xid = media.xid
          JOIN user_media_detail ON user.id = user_media_detail.owner_id
-WHERE user_media_detail.owner_id = ? AND document_type = ?`, tok.UserId, UserProfileImage)
+WHERE user_media_detail.owner_id = ? AND document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail")+` AND `+database.NotDeleted("user"), tok.UserId, UserProfileImage)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -170,13 +180,13 @@ WHERE user_media_detail.owner_id = ? AND document_type = ?`, tok.UserId, UserPro
 		return
 	}
 
-	networkLink := "http://" + configuration.App.Host + ":" + configuration.App.Port + "/api/public/" + media.Xid + media.Extension
+	networkLink := "http://" + s.Config.Host + ":" + s.Config.Port + "/api/public/" + media.Xid + media.Extension
 
 	ctx.JSON(http.StatusOK, networkLink)
 	return
 }
 
-func GetProfileThumb(ctx *gin.Context) {
+func (s *Service) GetProfileThumb(ctx *gin.Context) {
 	var (
 		err        error
 		mediaThumb utils.MediaThumb
@@ -191,7 +201,7 @@ func GetProfileThumb(ctx *gin.Context) {
 		return
 	}
 
-	mediaThumb, err = GetCurrentUserProfileThumb(tok.UserId)
+	mediaThumb, err = s.GetCurrentUserProfileThumb(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -199,13 +209,13 @@ func GetProfileThumb(ctx *gin.Context) {
 		return
 	}
 
-	networkLink := "http://" + configuration.App.Host + ":" + configuration.App.Port + "/api/public/thumb/" + mediaThumb.MediaXid + mediaThumb.Extension
+	networkLink := "http://" + s.Config.Host + ":" + s.Config.Port + "/api/public/thumb/" + mediaThumb.MediaXid + mediaThumb.Extension
 
 	ctx.JSON(http.StatusOK, networkLink)
 	return
 }
 
-func UpdateProfileImage(ctx *gin.Context) {
+func (s *Service) UpdateProfileImage(ctx *gin.Context) {
 	var (
 		media Media
 		tok   *authentication.Token
@@ -235,7 +245,7 @@ func UpdateProfileImage(ctx *gin.Context) {
 		return
 	}
 
-	oldMedia, err := GetCurrentUserProfile(tok.UserId)
+	oldMedia, err := s.GetCurrentUserProfile(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -247,14 +257,14 @@ func UpdateProfileImage(ctx *gin.Context) {
 	media.Extension = filepath.Ext(file.Filename)
 	media.Xid = oldMedia.Xid
 
-	err = RemoveCurrentUserProfile(oldMedia)
+	err = s.RemoveCurrentUserProfile(oldMedia)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
 		})
 	}
 
-	_, err = database.InsertOne(media)
+	_, err = s.DB.InsertOne(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -263,7 +273,7 @@ func UpdateProfileImage(ctx *gin.Context) {
 	ctx.AbortWithStatus(http.StatusOK)
 }
 
-func RemoveProfileImage(ctx *gin.Context) {
+func (s *Service) RemoveProfileImage(ctx *gin.Context) {
 	var (
 		media media.Media
 		tok   *authentication.Token
@@ -284,7 +294,7 @@ func RemoveProfileImage(ctx *gin.Context) {
 		})
 		return
 	}
-	media, err = GetCurrentUserProfile(tok.UserId)
+	media, err = s.GetCurrentUserProfile(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.UnAuthorizedError,
@@ -292,7 +302,7 @@ func RemoveProfileImage(ctx *gin.Context) {
 		return
 	}
 
-	err = UpdateUserProfileImageXid(tok.UserId, "")
+	err = s.UpdateUserProfileImageXid(tok.UserId, "")
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -300,14 +310,14 @@ func RemoveProfileImage(ctx *gin.Context) {
 		return
 	}
 
-	err = RemoveCurrentUserProfile(media)
+	err = s.RemoveCurrentUserProfile(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
 		})
 		return
 	}
-	err = RemoveUserMediaDetail(tok.UserId)
+	err = s.RemoveUserMediaDetail(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -322,13 +332,13 @@ func RemoveProfileImage(ctx *gin.Context) {
 	UTILS
 */
 
-func UpdateUserProfileImageXid(userId uint, xid string) (err error) {
+func (s *Service) UpdateUserProfileImageXid(userId uint, xid string) (err error) {
 	var (
 		usr user.User
 	)
-	usr, err = GetCurrentUser(userId)
+	usr, err = s.GetCurrentUser(userId)
 	usr.ProfileImageXid = xid
-	err = database.Update(usr)
+	err = s.DB.Update(usr)
 	if err != nil {
 		return err
 	}
@@ -349,91 +359,82 @@ func DetectMimeType(file *multipart.FileHeader) (mType *mimetype.MIME, err error
 	return mType, nil
 }
 
-func SetUserMediaDetail(userId uint) (err error) {
+func (s *Service) SetUserMediaDetail(userId uint) (err error) {
 	var (
 		userMediaDetail utils.UserMediaDetail
 	)
 
 	userMediaDetail.OwnerId = userId
 	userMediaDetail.DocumentType = UserProfileImage
-	_, err = database.InsertOne(userMediaDetail)
+	_, err = s.DB.InsertOne(userMediaDetail)
 	if err != nil {
 		return err
 	}
 	return
 }
 
-func GetCurrentUserProfile(userId uint) (media media.Media, err error) {
-	err = database.Get(&media, `SELECT media.*
+func (s *Service) GetCurrentUserProfile(userId uint) (media media.Media, err error) {
+	err = s.DB.Get(&media, `SELECT media.*
 FROM media
          JOIN user ON user.profile_image_xid = media.xid
          JOIN user_media_detail ON user.id = user_media_detail.owner_id
-WHERE user_media_detail.owner_id = ? AND document_type = ?`, userId, UserProfileImage)
+WHERE user_media_detail.owner_id = ? AND document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail")+` AND `+database.NotDeleted("user"), userId, UserProfileImage)
 	if err != nil {
 		return media, err
 	}
 	return media, err
 }
 
-func GetCurrentUser(userId uint) (user user.User, err error) {
-	err = database.Get(&user, `SELECT * FROM user WHERE user.id = ?`, userId)
+func (s *Service) GetCurrentUser(userId uint) (user user.User, err error) {
+	err = s.DB.Get(&user, `SELECT * FROM user WHERE user.id = ? AND `+database.NotDeleted("user"), userId)
 	if err != nil {
 		return user, err
 	}
 	return user, err
 }
 
-func GetCurrentUserProfileThumb(userId uint) (media utils.MediaThumb, err error) {
-	err = database.Get(&media, `SELECT media_thumb.*
+func (s *Service) GetCurrentUserProfileThumb(userId uint) (media utils.MediaThumb, err error) {
+	err = s.DB.Get(&media, `SELECT media_thumb.*
 				FROM media_thumb
 						 JOIN media ON  media.xid = media_thumb.media_xid
 						 JOIN user ON user.profile_image_xid = media.xid
 						 JOIN user_media_detail ON user.id = user_media_detail.owner_id
-				WHERE user_media_detail.owner_id = ? and document_type = ?`, userId, UserProfileImage)
+				WHERE user_media_detail.owner_id = ? and document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail")+` AND `+database.NotDeleted("user"), userId, UserProfileImage)
 	if err != nil {
 		return media, err
 	}
 	return media, err
 }
 
-func GetUserMediaDetail(userId uint) (userMediaDetail utils.UserMediaDetail, err error) {
-	err = database.Get(&userMediaDetail, `SELECT user_media_detail.* FROM  user_media_detail WHERE user_media_detail.owner_id =? `, userId)
+func (s *Service) GetUserMediaDetail(userId uint) (userMediaDetail utils.UserMediaDetail, err error) {
+	err = s.DB.Get(&userMediaDetail, `SELECT user_media_detail.* FROM  user_media_detail WHERE user_media_detail.owner_id =? AND `+database.NotDeleted("user_media_detail"), userId)
 	if err != nil {
 		return userMediaDetail, err
 	}
 	return userMediaDetail, err
 }
 
-func RemoveUserMediaDetail(userId uint) (err error) {
-	userMediaDetail, err := GetUserMediaDetail(userId)
+func (s *Service) RemoveUserMediaDetail(userId uint) (err error) {
+	userMediaDetail, err := s.GetUserMediaDetail(userId)
 	if err != nil {
 		return err
 	}
-	err = database.Delete(userMediaDetail)
+	err = s.DB.Delete(userMediaDetail)
 	if err != nil {
 		return err
 	}
 	return
 }
 
-func RemoveCurrentUserProfile(media media.Media) (err error) {
-	err = database.Delete(media)
+func (s *Service) RemoveCurrentUserProfile(media media.Media) (err error) {
+	err = s.DB.Delete(media)
 	if err != nil {
 		return err
 	}
 
-	filePath := utils.FILE_UPLOAD_DIR + utils.THUMB_FILE_UPLOAD_DIR + media.Xid + media.Extension
-	err = ClearMediaFile(filePath)
+	err = s.Storage.Remove(storage.ThumbDirectory + media.Xid + media.Extension)
 	if err != nil {
 		return err
 	}
 	return
 }
-
-func ClearMediaFile(filePath string) error {
-	err := os.Remove(filePath)
-	if err != nil {
-		return err
-	}
-	return nil
-}
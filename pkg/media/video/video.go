@@ -8,8 +8,8 @@ import (
 	"net/http"
 	"path/filepath"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
-	"peec/internal/configuration"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
@@ -17,6 +17,16 @@ import (
 	"time"
 )
 
+// Service serves the video presentations of the users.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the video service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
 const (
 	Presentation = utils.VideoPresentation
 )
@@ -42,7 +52,7 @@ type UserMediaDetail struct {
 	DocumentXid  string     `json:"document_xid"`
 }
 
-func UploadVideo(ctx *gin.Context) {
+func (s *Service) UploadVideo(ctx *gin.Context) {
 	var (
 		media Media
 		tok   *authentication.Token
@@ -91,7 +101,7 @@ func UploadVideo(ctx *gin.Context) {
 	media.Extension = filepath.Ext(file.Filename)
 	media.Xid = xid.New().String()
 
-	err = ctx.SaveUploadedFile(file, utils.FILE_UPLOAD_DIR+media.Xid+media.Extension)
+	err = s.Storage.Save(file, media.Xid+media.Extension)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -99,7 +109,7 @@ func UploadVideo(ctx *gin.Context) {
 		return
 	}
 
-	_, err = database.InsertOne(media)
+	_, err = s.DB.InsertOne(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -107,7 +117,7 @@ func UploadVideo(ctx *gin.Context) {
 		return
 	}
 
-	err = SetUserMediaDetail(tok.UserId, media.Xid)
+	err = s.SetUserMediaDetail(tok.UserId, media.Xid)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -117,7 +127,7 @@ func UploadVideo(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, media)
 }
 
-func GetProfileVideo(ctx *gin.Context) {
+func (s *Service) GetProfileVideo(ctx *gin.Context) {
 	var (
 		err   error
 		media Media
@@ -132,11 +142,11 @@ func GetProfileVideo(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Get(&media, `SELECT media.*
+	err = s.DB.Get(&media, `SELECT media.*
 FROM media
          JOIN user_media_detail ON media.xid = user_media_detail.document_xid
          JOIN user ON user.id = user_media_detail.owner_id
-WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ?`, tok.UserId, Presentation)
+WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail")+` AND `+database.NotDeleted("user"), tok.UserId, Presentation)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -144,13 +154,13 @@ WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ?`, t
 		return
 	}
 
-	networkLink := "http://" + configuration.App.Host + ":" + configuration.App.Port + "/api/public/" + media.Xid + media.Extension
+	networkLink := "http://" + s.Config.Host + ":" + s.Config.Port + "/api/public/" + media.Xid + media.Extension
 
 	ctx.JSON(http.StatusOK, networkLink)
 	return
 }
 
-func UpdateProfileVideo(ctx *gin.Context) {
+func (s *Service) UpdateProfileVideo(ctx *gin.Context) {
 	var (
 		media Media
 		tok   *authentication.Token
@@ -180,7 +190,7 @@ func UpdateProfileVideo(ctx *gin.Context) {
 		return
 	}
 
-	oldMedia, err := GetCurrentUserVideo(tok.UserId)
+	oldMedia, err := s.GetCurrentUserVideo(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -192,14 +202,14 @@ func UpdateProfileVideo(ctx *gin.Context) {
 	media.Extension = filepath.Ext(file.Filename)
 	media.Xid = oldMedia.Xid
 
-	err = RemoveCurrentUserVideo(oldMedia)
+	err = s.RemoveCurrentUserVideo(oldMedia)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
 		})
 	}
 
-	_, err = database.InsertOne(media)
+	_, err = s.DB.InsertOne(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -208,7 +218,7 @@ func UpdateProfileVideo(ctx *gin.Context) {
 	ctx.AbortWithStatus(http.StatusOK)
 }
 
-func RemoveProfileVideo(ctx *gin.Context) {
+func (s *Service) RemoveProfileVideo(ctx *gin.Context) {
 	var (
 		media media.Media
 		tok   *authentication.Token
@@ -230,7 +240,7 @@ func RemoveProfileVideo(ctx *gin.Context) {
 		return
 	}
 
-	media, err = GetCurrentUserVideo(tok.UserId)
+	media, err = s.GetCurrentUserVideo(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.UnAuthorizedError,
@@ -238,7 +248,7 @@ func RemoveProfileVideo(ctx *gin.Context) {
 		return
 	}
 
-	err = RemoveCurrentUserVideo(media)
+	err = s.RemoveCurrentUserVideo(media)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -246,7 +256,7 @@ func RemoveProfileVideo(ctx *gin.Context) {
 		return
 	}
 
-	userMediaDetail, err := GetUserMediaDetail(tok.UserId)
+	userMediaDetail, err := s.GetUserMediaDetail(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -254,7 +264,7 @@ func RemoveProfileVideo(ctx *gin.Context) {
 		return
 	}
 
-	err = RemoveUserMediaDetail(userMediaDetail)
+	err = s.RemoveUserMediaDetail(userMediaDetail)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -284,50 +294,50 @@ func DetectMimeType(file *multipart.FileHeader) (mType *mimetype.MIME, err error
 	return mType, nil
 }
 
-func SetUserMediaDetail(userId uint, documentXid string) (err error) {
+func (s *Service) SetUserMediaDetail(userId uint, documentXid string) (err error) {
 	var (
 		userMediaDetail UserMediaDetail
 	)
 	userMediaDetail.OwnerId = userId
 	userMediaDetail.DocumentType = Presentation
 	userMediaDetail.DocumentXid = documentXid
-	_, err = database.InsertOne(userMediaDetail)
+	_, err = s.DB.InsertOne(userMediaDetail)
 	if err != nil {
 		return err
 	}
 	return
 }
 
-func GetUserMediaDetail(userId uint) (userMediaDetail UserMediaDetail, err error) {
-	err = database.Get(&userMediaDetail, `SELECT user_media_detail.* FROM  user_media_detail WHERE user_media_detail.owner_id =? `, userId)
+func (s *Service) GetUserMediaDetail(userId uint) (userMediaDetail UserMediaDetail, err error) {
+	err = s.DB.Get(&userMediaDetail, `SELECT user_media_detail.* FROM  user_media_detail WHERE user_media_detail.owner_id =? AND `+database.NotDeleted("user_media_detail"), userId)
 	if err != nil {
 		return userMediaDetail, err
 	}
 	return userMediaDetail, err
 }
 
-func GetCurrentUserVideo(userId uint) (media media.Media, err error) {
-	err = database.Get(&media, `SELECT media.*
+func (s *Service) GetCurrentUserVideo(userId uint) (media media.Media, err error) {
+	err = s.DB.Get(&media, `SELECT media.*
 FROM media
          JOIN user_media_detail ON media.xid = user_media_detail.document_xid
          JOIN user ON user.id = user_media_detail.owner_id
-WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ?`, userId, Presentation)
+WHERE user_media_detail.owner_id = ? AND user_media_detail.document_type = ? AND `+database.NotDeleted("media")+` AND `+database.NotDeleted("user_media_detail")+` AND `+database.NotDeleted("user"), userId, Presentation)
 	if err != nil {
 		return media, err
 	}
 	return media, err
 }
 
-func RemoveUserMediaDetail(userMediaDetail UserMediaDetail) (err error) {
-	err = database.Delete(userMediaDetail)
+func (s *Service) RemoveUserMediaDetail(userMediaDetail UserMediaDetail) (err error) {
+	err = s.DB.Delete(userMediaDetail)
 	if err != nil {
 		return err
 	}
 	return
 }
 
-func RemoveCurrentUserVideo(media media.Media) (err error) {
-	err = database.Delete(media)
+func (s *Service) RemoveCurrentUserVideo(media media.Media) (err error) {
+	err = s.DB.Delete(media)
 	if err != nil {
 		return err
 	}
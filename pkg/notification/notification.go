@@ -0,0 +1,436 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"peec/database"
+	"peec/internal/app"
+	"peec/internal/authentication"
+	"peec/internal/mailer"
+	"peec/internal/outbox"
+	"peec/internal/query"
+	"peec/internal/realtime"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"peec/pkg/phone"
+	"peec/pkg/user"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Service stores the notifications and delivers them over the channels the users chose.
+type Service struct {
+	*app.App
+	auth          *authentication.Service
+	phones        *phone.Service
+	users         *user.Service
+	mailRenderers map[string]MailRenderer
+}
+
+// NewService returns the notification service, texting the primary number from phones. auth checks the sessions of
+// the event streams.
+func NewService(a *app.App, auth *authentication.Service, phones *phone.Service, users *user.Service) *Service {
+	return &Service{App: a, auth: auth, phones: phones, users: users, mailRenderers: map[string]MailRenderer{}}
+}
+
+// Channels a notification goes out on.
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+	ChannelSms   = "sms"
+)
+
+// NotificationDelivery records that the notification of an outbox event went out to a user on a channel.
+type NotificationDelivery struct {
+	Id        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	EventId   uint       `json:"event_id"`
+	UserId    uint       `json:"user_id"`
+	Channel   string     `json:"channel"`
+}
+
+// Notification types. ReferenceId points to the calendar planning, the user mark, the message or the post concerned.
+const (
+	TypePlanningInvitation = "planning_invitation"
+	TypeUserMark           = "user_mark"
+	TypeMessage            = "message"
+	TypePostPublished      = "post_published"
+)
+
+// Notification is shown in the notification center of UserId. ActorId is the user who triggered it, zero for the system.
+type Notification struct {
+	Id          uint       `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	UserId      uint       `json:"user_id"`
+	ActorId     uint       `json:"actor_id"`
+	Type        string     `json:"type"`
+	ReferenceId uint       `json:"reference_id"`
+	Message     string     `json:"message"`
+	IsRead      bool       `json:"is_read"`
+	ReadAt      *time.Time `json:"read_at"`
+}
+
+// MailRenderer builds the email of a notification type in place of the generic notification email.
+// Recipients are left to the dispatcher.
+type MailRenderer func(notification Notification) (mailer.Message, error)
+
+var notificationSpec = query.Spec{
+	Table:       "notification",
+	Sorts:       []string{"created_at"},
+	Filters:     []string{"type", "is_read", "actor_id"},
+	DefaultSort: "-created_at",
+}
+
+/*
+
+	ROUTES
+
+*/
+
+// GetNotifications lists the notifications of the user, most recent first. See query.Query for the parameters;
+// unread=true is kept as a shortcut for filter[is_read]=false.
+func (s *Service) GetNotifications(ctx *gin.Context) {
+	var (
+		tok    *authentication.Token
+		err    error
+		q      query.Query
+		result query.Page[Notification]
+		where  string
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, notificationSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	where = `notification.user_id = ?`
+	if ctx.Query("unread") == "true" {
+		where += ` AND notification.is_read = false`
+	}
+
+	result, err = query.List[Notification](s.DB, q, "notification", where, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (s *Service) GetUnreadCount(ctx *gin.Context) {
+	var (
+		tok   *authentication.Token
+		err   error
+		count int
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	count, err = s.CountUnread(tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"unread": count,
+	})
+}
+
+func (s *Service) MarkAsRead(ctx *gin.Context) {
+	var (
+		tok *authentication.Token
+		err error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	notificationId, err := strconv.Atoi(ctx.Param("notification_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = s.DB.Exec(`UPDATE notification SET is_read = true, read_at = UTC_TIMESTAMP(), updated_at = CURRENT_TIMESTAMP
+			WHERE id = ? AND user_id = ? AND is_read = false`, notificationId, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+func (s *Service) MarkAllAsRead(ctx *gin.Context) {
+	var (
+		tok *authentication.Token
+		err error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = s.DB.Exec(`UPDATE notification SET is_read = true, read_at = UTC_TIMESTAMP(), updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND is_read = false`, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+
+	SERVICE
+
+*/
+
+// Notify delivers a notification to userId on the channels chosen in the preferences of the user: stored and pushed
+// to the connected devices in-app, then emailed and texted outside of the quiet hours. Users are never notified of
+// their own actions.
+//
+// eventId is the outbox event the notification comes from. Each channel the notification went out on is recorded
+// for the event and the user, so that a retried event skips them; 0 records nothing. During the quiet hours, Notify
+// returns an outbox.Deferred error once the in-app notification went out, so the event comes back for the email and
+// the text message when the quiet hours end.
+func (s *Service) Notify(eventId, userId, actorId uint, kind string, referenceId uint, message string) (err error) {
+	if userId == state.ZERO || userId == actorId {
+		return nil
+	}
+
+	preference, err := s.GetPreference(userId, kind)
+	if err != nil {
+		return err
+	}
+
+	notification := Notification{
+		UserId:      userId,
+		ActorId:     actorId,
+		Type:        kind,
+		ReferenceId: referenceId,
+		Message:     message,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	delivered, err := s.deliveredChannels(eventId, userId)
+	if err != nil {
+		return err
+	}
+
+	if preference.InApp && !delivered[ChannelInApp] {
+		err = s.DB.WithTx(context.Background(), func(tx *sqlx.Tx) error {
+			notification.Id, err = database.InsertOneTx(tx, notification)
+			if err != nil {
+				return err
+			}
+			return recordDelivery(tx, eventId, userId, ChannelInApp)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = s.Realtime.Publish(realtime.UserTopic(userId), realtime.EventNotification, notification)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !(preference.Email && !delivered[ChannelEmail]) && !(preference.Sms && !delivered[ChannelSms]) {
+		return nil
+	}
+
+	setting, err := s.GetSetting(userId)
+	if err != nil {
+		return err
+	}
+
+	if setting.IsQuiet(notification.CreatedAt) {
+		return outbox.Defer(setting.QuietHoursEndAfter(notification.CreatedAt))
+	}
+
+	if preference.Email && !delivered[ChannelEmail] {
+		err = s.sendEmail(notification)
+		if err != nil {
+			return err
+		}
+
+		err = s.DB.WithTx(context.Background(), func(tx *sqlx.Tx) error {
+			return recordDelivery(tx, eventId, userId, ChannelEmail)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if preference.Sms && !delivered[ChannelSms] {
+		err = s.sendSms(notification)
+		if err != nil {
+			return err
+		}
+
+		err = s.DB.WithTx(context.Background(), func(tx *sqlx.Tx) error {
+			return recordDelivery(tx, eventId, userId, ChannelSms)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NotifyMany stores the same notification for every user of userIds. A retried event only notifies the users, and
+// uses the channels, it did not reach before. Users in their quiet hours do not hold back the others: the event is
+// deferred to the earliest end of their quiet hours once everybody else got notified.
+func (s *Service) NotifyMany(eventId uint, userIds []uint, actorId uint, kind string, referenceId uint, message string) (err error) {
+	var deferred *outbox.Deferred
+
+	for _, userId := range userIds {
+		err = s.Notify(eventId, userId, actorId, kind, referenceId, message)
+
+		var quiet *outbox.Deferred
+		if errors.As(err, &quiet) {
+			if deferred == nil || quiet.Until.Before(deferred.Until) {
+				deferred = quiet
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if deferred != nil {
+		return deferred
+	}
+	return nil
+}
+
+// deliveredChannels returns the channels the notification of eventId already went out on for userId.
+func (s *Service) deliveredChannels(eventId, userId uint) (delivered map[string]bool, err error) {
+	var channels []string
+
+	delivered = map[string]bool{}
+	if eventId == state.ZERO {
+		return delivered, nil
+	}
+
+	err = s.DB.Select(&channels, `SELECT channel FROM notification_delivery WHERE event_id = ? AND user_id = ? AND `+database.NotDeleted("notification_delivery"), eventId, userId)
+	if err != nil {
+		return delivered, err
+	}
+
+	for _, channel := range channels {
+		delivered[channel] = true
+	}
+	return delivered, err
+}
+
+func recordDelivery(tx *sqlx.Tx, eventId, userId uint, channel string) (err error) {
+	if eventId == state.ZERO {
+		return nil
+	}
+
+	_, err = database.InsertOneTx(tx, NotificationDelivery{EventId: eventId, UserId: userId, Channel: channel})
+	return err
+}
+
+// RegisterMail replaces the generic email of a notification type. It is meant to be called by the constructors of
+// the other services.
+func (s *Service) RegisterMail(kind string, renderer MailRenderer) {
+	s.mailRenderers[kind] = renderer
+}
+
+func (s *Service) CountUnread(userId uint) (count int, err error) {
+	err = s.DB.Get(&count, `SELECT COUNT(*) FROM notification WHERE user_id = ? AND is_read = false AND `+database.NotDeleted("notification"), userId)
+	if err != nil {
+		return count, err
+	}
+	return count, err
+}
+
+func (s *Service) sendEmail(notification Notification) (err error) {
+	var msg mailer.Message
+
+	recipient, err := s.users.GetUserWithId(notification.UserId)
+	if err != nil {
+		return err
+	}
+
+	if renderer, ok := s.mailRenderers[notification.Type]; ok {
+		msg, err = renderer(notification)
+	} else {
+		msg, err = mailer.Render(mailer.TemplateNotification, mailer.NotificationData{
+			Name:    recipient.Name,
+			Message: notification.Message,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	msg.To = []string{recipient.Email}
+	return s.Mailer.Send(msg)
+}
+
+// sendSms texts the primary number of the user. Users without a verified number simply get nothing.
+func (s *Service) sendSms(notification Notification) (err error) {
+	primary, err := s.phones.GetPrimaryPhoneNumber(notification.UserId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.Sms.Send(primary.MobilePhoneNumber, notification.Message)
+}
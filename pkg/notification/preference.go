@@ -0,0 +1,368 @@
+package notification
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"peec/database"
+	"peec/internal/authentication"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"slices"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTimezone  = "UTC"
+	quietHoursLayout = "15:04"
+)
+
+// Types lists the notification types a user can configure.
+var Types = []string{TypePlanningInvitation, TypeUserMark, TypeMessage, TypePostPublished}
+
+// NotificationPreference is the choice of channels of a user for one notification type. Types the user never
+// configured use defaultPreference.
+type NotificationPreference struct {
+	Id        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	UserId    uint       `json:"user_id"`
+	Type      string     `json:"type"`
+	InApp     bool       `json:"in_app"`
+	Email     bool       `json:"email"`
+	Sms       bool       `json:"sms"`
+}
+
+// NotificationSetting holds the quiet hours of a user, read in Timezone. No email nor text message is sent during
+// quiet hours; in-app notifications are still stored. Empty bounds disable quiet hours, and an end before the start
+// spans midnight.
+type NotificationSetting struct {
+	Id              uint       `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at"`
+	UserId          uint       `json:"user_id"`
+	Timezone        string     `json:"timezone"`
+	QuietHoursStart string     `json:"quiet_hours_start"`
+	QuietHoursEnd   string     `json:"quiet_hours_end"`
+}
+
+type Settings struct {
+	Timezone        string                   `json:"timezone"`
+	QuietHoursStart string                   `json:"quiet_hours_start"`
+	QuietHoursEnd   string                   `json:"quiet_hours_end"`
+	Preferences     []NotificationPreference `json:"preferences"`
+}
+
+type PreferenceRequest struct {
+	InApp bool `json:"in_app"`
+	Email bool `json:"email"`
+	Sms   bool `json:"sms"`
+}
+
+type SettingsRequest struct {
+	Timezone        string `json:"timezone"`
+	QuietHoursStart string `json:"quiet_hours_start"`
+	QuietHoursEnd   string `json:"quiet_hours_end"`
+}
+
+/*
+
+	ROUTES
+
+*/
+
+// GetSettings returns the quiet hours of the user and the channels chosen for every notification type.
+func (s *Service) GetSettings(ctx *gin.Context) {
+	var (
+		tok      *authentication.Token
+		err      error
+		setting  NotificationSetting
+		settings Settings
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	setting, err = s.GetSetting(tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	settings.Timezone = setting.Timezone
+	settings.QuietHoursStart = setting.QuietHoursStart
+	settings.QuietHoursEnd = setting.QuietHoursEnd
+
+	for _, kind := range Types {
+		preference, err := s.GetPreference(tok.UserId, kind)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbGetError,
+			})
+			return
+		}
+		settings.Preferences = append(settings.Preferences, preference)
+	}
+
+	ctx.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings sets the timezone and the quiet hours of the user.
+func (s *Service) UpdateSettings(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		err     error
+		request SettingsRequest
+		setting NotificationSetting
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	if request.Timezone == state.EMPTY {
+		request.Timezone = defaultTimezone
+	}
+
+	_, err = time.LoadLocation(request.Timezone)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidTimezoneError,
+		})
+		return
+	}
+
+	if !isValidQuietHours(request.QuietHoursStart, request.QuietHoursEnd) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidQuietHoursError,
+		})
+		return
+	}
+
+	setting, err = s.GetSetting(tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	setting.Timezone = request.Timezone
+	setting.QuietHoursStart = request.QuietHoursStart
+	setting.QuietHoursEnd = request.QuietHoursEnd
+
+	if setting.Id > 0 {
+		err = s.DB.Update(setting)
+	} else {
+		setting.Id, err = s.DB.InsertOne(setting)
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, setting)
+}
+
+// UpdatePreference sets the channels the user wants for one notification type.
+func (s *Service) UpdatePreference(ctx *gin.Context) {
+	var (
+		tok        *authentication.Token
+		err        error
+		request    PreferenceRequest
+		preference NotificationPreference
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	kind := ctx.Param("type")
+	if !slices.Contains(Types, kind) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnknownNotificationTypeError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	preference, err = s.GetPreference(tok.UserId, kind)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	preference.InApp = request.InApp
+	preference.Email = request.Email
+	preference.Sms = request.Sms
+
+	if preference.Id > 0 {
+		err = s.DB.Update(preference)
+	} else {
+		preference.Id, err = s.DB.InsertOne(preference)
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, preference)
+}
+
+/*
+
+	UTILS
+
+*/
+
+// defaultPreference keeps every notification in-app. Invitations and messages are also emailed, text messages
+// are always opt-in.
+func defaultPreference(userId uint, kind string) NotificationPreference {
+	return NotificationPreference{
+		UserId: userId,
+		Type:   kind,
+		InApp:  true,
+		Email:  kind == TypePlanningInvitation || kind == TypeMessage,
+	}
+}
+
+// GetPreference returns the stored preference of the user for kind, or the default one.
+func (s *Service) GetPreference(userId uint, kind string) (preference NotificationPreference, err error) {
+	err = s.DB.Get(&preference, `SELECT * FROM notification_preference WHERE user_id = ? AND type = ? AND `+database.NotDeleted("notification_preference"), userId, kind)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultPreference(userId, kind), nil
+	}
+	if err != nil {
+		return preference, err
+	}
+	return preference, err
+}
+
+// GetSetting returns the stored quiet hours of the user, or none in UTC.
+func (s *Service) GetSetting(userId uint) (setting NotificationSetting, err error) {
+	err = s.DB.Get(&setting, `SELECT * FROM notification_setting WHERE user_id = ? AND `+database.NotDeleted("notification_setting"), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationSetting{UserId: userId, Timezone: defaultTimezone}, nil
+	}
+	if err != nil {
+		return setting, err
+	}
+	return setting, err
+}
+
+// IsQuiet tells whether t falls within the quiet hours of the setting, in its timezone.
+func (setting NotificationSetting) IsQuiet(t time.Time) bool {
+	location, start, end, ok := setting.quietHours()
+	if !ok {
+		return false
+	}
+
+	local := t.In(location)
+	now := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// QuietHoursEndAfter returns the first end of the quiet hours of the setting after t, or t itself without quiet hours.
+func (setting NotificationSetting) QuietHoursEndAfter(t time.Time) time.Time {
+	location, _, end, ok := setting.quietHours()
+	if !ok {
+		return t
+	}
+
+	local := t.In(location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, location)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// quietHours parses the bounds of the quiet hours of the setting. ok is false when there are none.
+func (setting NotificationSetting) quietHours() (location *time.Location, start, end time.Time, ok bool) {
+	if setting.QuietHoursStart == state.EMPTY || setting.QuietHoursEnd == state.EMPTY {
+		return nil, start, end, false
+	}
+
+	location, err := time.LoadLocation(setting.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	start, err = time.Parse(quietHoursLayout, setting.QuietHoursStart)
+	if err != nil {
+		return nil, start, end, false
+	}
+
+	end, err = time.Parse(quietHoursLayout, setting.QuietHoursEnd)
+	if err != nil {
+		return nil, start, end, false
+	}
+	return location, start, end, true
+}
+
+// isValidQuietHours accepts either no quiet hours at all, or two distinct HH:MM bounds.
+func isValidQuietHours(start, end string) bool {
+	if start == state.EMPTY && end == state.EMPTY {
+		return true
+	}
+
+	_, err := time.Parse(quietHoursLayout, start)
+	if err != nil {
+		return false
+	}
+
+	_, err = time.Parse(quietHoursLayout, end)
+	if err != nil {
+		return false
+	}
+
+	return start != end
+}
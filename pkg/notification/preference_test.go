@@ -0,0 +1,82 @@
+package notification
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestIsQuiet(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	night := NotificationSetting{Timezone: "Europe/Paris", QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+	lunch := NotificationSetting{Timezone: "Europe/Paris", QuietHoursStart: "12:00", QuietHoursEnd: "14:00"}
+
+	for _, test := range []struct {
+		setting NotificationSetting
+		at      string
+		want    bool
+	}{
+		{night, "21:59", false},
+		{night, "22:00", true},
+		{night, "03:00", true},
+		{night, "06:59", true},
+		{night, "07:00", false},
+		{lunch, "11:59", false},
+		{lunch, "12:00", true},
+		{lunch, "14:00", false},
+		{NotificationSetting{Timezone: "Europe/Paris"}, "03:00", false},
+		{NotificationSetting{Timezone: "Europe/Paris", QuietHoursStart: "late", QuietHoursEnd: "07:00"}, "03:00", false},
+	} {
+		clock, err := time.Parse(quietHoursLayout, test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := time.Date(2024, 6, 1, clock.Hour(), clock.Minute(), 0, 0, paris)
+
+		if got := test.setting.IsQuiet(at); got != test.want {
+			t.Errorf("%s-%s IsQuiet(%s) = %v, want %v", test.setting.QuietHoursStart, test.setting.QuietHoursEnd, test.at, got, test.want)
+		}
+	}
+}
+
+func TestIsQuietUsesTheTimezoneOfTheSetting(t *testing.T) {
+	setting := NotificationSetting{Timezone: "Europe/Paris", QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+
+	// 21:30 UTC is 23:30 in Paris in the summer.
+	if !setting.IsQuiet(time.Date(2024, 6, 1, 21, 30, 0, 0, time.UTC)) {
+		t.Error("21:30 UTC is not quiet for 22:00-07:00 in Paris")
+	}
+
+	setting.Timezone = "Nowhere/Else"
+	if setting.IsQuiet(time.Date(2024, 6, 1, 21, 30, 0, 0, time.UTC)) {
+		t.Error("an unknown timezone does not fall back on UTC")
+	}
+}
+
+func TestQuietHoursEndAfter(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setting := NotificationSetting{Timezone: "Europe/Paris", QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}
+
+	for at, want := range map[time.Time]time.Time{
+		time.Date(2024, 6, 1, 23, 0, 0, 0, paris): time.Date(2024, 6, 2, 7, 0, 0, 0, paris),
+		time.Date(2024, 6, 2, 3, 0, 0, 0, paris):  time.Date(2024, 6, 2, 7, 0, 0, 0, paris),
+		time.Date(2024, 6, 2, 7, 0, 0, 0, paris):  time.Date(2024, 6, 3, 7, 0, 0, 0, paris),
+	} {
+		if got := setting.QuietHoursEndAfter(at); !got.Equal(want) {
+			t.Errorf("QuietHoursEndAfter(%s) = %s, want %s", at, got, want)
+		}
+	}
+
+	now := time.Now()
+	if got := (NotificationSetting{}).QuietHoursEndAfter(now); !got.Equal(now) {
+		t.Errorf("QuietHoursEndAfter without quiet hours = %s, want %s", got, now)
+	}
+}
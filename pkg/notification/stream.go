@@ -0,0 +1,28 @@
+package notification
+
+import (
+	"net/http"
+	"peec/internal/authentication"
+	"peec/internal/realtime"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Events streams, as server-sent events, everything published for the user: notifications and planning changes. The
+// stream closes once the access token expires or its session ends, by logout or revocation.
+func (s *Service) Events(ctx *gin.Context) {
+	tok, err := authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	s.Realtime.Stream(ctx, realtime.UserTopic(tok.UserId), func() bool {
+		return tok.ExpiresAt != nil && tok.ExpiresAt.After(time.Now()) && s.auth.IsSessionActive(tok.ID)
+	})
+}
@@ -0,0 +1,588 @@
+package phone
+
+import (
+	"net/http"
+	"peec/database"
+	"peec/internal/authentication"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"peec/pkg/user/authorization"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	RelationshipParent      = "parent"
+	RelationshipGuardian    = "guardian"
+	RelationshipGrandparent = "grandparent"
+	RelationshipSibling     = "sibling"
+	RelationshipRelative    = "relative"
+	RelationshipNeighbour   = "neighbour"
+	RelationshipOther       = "other"
+)
+
+var relationships = map[string]bool{
+	RelationshipParent:      true,
+	RelationshipGuardian:    true,
+	RelationshipGrandparent: true,
+	RelationshipSibling:     true,
+	RelationshipRelative:    true,
+	RelationshipNeighbour:   true,
+	RelationshipOther:       true,
+}
+
+// EmergencyContact is a person to call about the user. Its number is an urgency PhoneNumber of the user,
+// shared by every contact having the same number. Contacts are called by ascending Priority.
+type EmergencyContact struct {
+	Id                uint       `json:"id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	DeletedAt         *time.Time `json:"deleted_at"`
+	UserId            uint       `json:"user_id"`
+	PhoneNumberId     uint       `json:"phone_number_id"`
+	Name              string     `json:"name"`
+	Relationship      string     `json:"relationship"`
+	Priority          int        `json:"priority"`
+	MobilePhoneNumber string     `json:"mobile_phone_number" q:"_"`
+}
+
+// EmergencyContactAccess records every read of an emergency contact: who read it, acting as which role, and when.
+type EmergencyContactAccess struct {
+	Id                    uint       `json:"id"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+	DeletedAt             *time.Time `json:"deleted_at"`
+	EmergencyContactId    uint       `json:"emergency_contact_id"`
+	UserId                uint       `json:"user_id"`
+	ViewerId              uint       `json:"viewer_id"`
+	ViewerAuthorizationId uint       `json:"viewer_authorization_id"`
+	Ip                    string     `json:"ip"`
+}
+
+var emergencyContactSpec = query.Spec{
+	Table:       "emergency_contact",
+	Columns:     "emergency_contact.*, phone_number.mobile_phone_number",
+	Sorts:       []string{"priority", "name", "created_at"},
+	Filters:     []string{"relationship"},
+	DefaultSort: "priority",
+}
+
+var accessSpec = query.Spec{
+	Table:       "emergency_contact_access",
+	Sorts:       []string{"created_at"},
+	Filters:     []string{"emergency_contact_id", "viewer_id", "viewer_authorization_id"},
+	DefaultSort: "-created_at",
+}
+
+type EmergencyContactRequest struct {
+	Name              string `json:"name"`
+	Relationship      string `json:"relationship"`
+	Priority          int    `json:"priority"`
+	MobilePhoneNumber string `json:"mobile_phone_number"`
+}
+
+/*
+
+	ROUTES Handlers
+
+*/
+
+/*
+ADD AN EMERGENCY CONTACT TO THE CURRENT USER, OR TO THE STUDENT OF :user_id FOR A LINKED PARENT
+*/
+func (s *Service) NewEmergencyContact(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		request EmergencyContactRequest
+		contact EmergencyContact
+		err     error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	ownerId, allowed := s.contactOwner(ctx, tok)
+	if !allowed {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
+	}
+
+	contact.UserId = ownerId
+	message := applyEmergencyContactRequest(&contact, request)
+	if message != state.EMPTY {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: message,
+		})
+		return
+	}
+
+	err = s.DB.WithTx(ctx.Request.Context(), func(tx *sqlx.Tx) error {
+		contact.PhoneNumberId, err = getOrCreateUrgencyPhoneNumber(tx, ownerId, contact.MobilePhoneNumber)
+		if err != nil {
+			return err
+		}
+
+		contact.Id, err = database.InsertOneTx(tx, contact)
+		return err
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, contact)
+}
+
+/*
+GET THE EMERGENCY CONTACTS OF THE CURRENT USER, BY PRIORITY
+*/
+func (s *Service) GetMyEmergencyContacts(ctx *gin.Context) {
+	var (
+		tok      *authentication.Token
+		q        query.Query
+		contacts query.Page[EmergencyContact]
+		err      error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, emergencyContactSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	contacts, err = s.GetUserEmergencyContacts(q, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	err = s.LogEmergencyContactAccess(contacts.Items, tok, ctx.ClientIP())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, contacts)
+}
+
+/*
+GET THE EMERGENCY CONTACTS OF A STUDENT. A LINKED PARENT MAY READ THEM, AND SO MAY ANYONE WHO TAKES PART IN A CALENDAR
+PLANNING ALONG WITH THE STUDENT, AS LONG AS BOTH ACCEPTED IT
+*/
+func (s *Service) GetStudentEmergencyContacts(ctx *gin.Context) {
+	var (
+		tok      *authentication.Token
+		q        query.Query
+		contacts query.Page[EmergencyContact]
+		err      error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	studentId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	allowed := authentication.IsParent(ctx) && s.IsParentOfStudent(tok.UserId, uint(studentId))
+	if !allowed {
+		allowed = s.IsPlanningSharedWithStudent(tok.AuthorizationId, uint(studentId))
+	}
+
+	if !allowed {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, emergencyContactSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	contacts, err = s.GetUserEmergencyContacts(q, uint(studentId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	err = s.LogEmergencyContactAccess(contacts.Items, tok, ctx.ClientIP())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, contacts)
+}
+
+/*
+UPDATE AN EMERGENCY CONTACT OF THE CURRENT USER, OR OF THE STUDENT OF :user_id FOR A LINKED PARENT
+*/
+func (s *Service) UpdateEmergencyContact(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		request EmergencyContactRequest
+		contact EmergencyContact
+		err     error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	contactId, err := strconv.Atoi(ctx.Param("contact_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	ownerId, allowed := s.contactOwner(ctx, tok)
+	if !allowed {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
+	}
+
+	contact, err = s.GetUserEmergencyContact(ownerId, uint(contactId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownEmergencyContactError,
+		})
+		return
+	}
+
+	previousPhoneNumberId := contact.PhoneNumberId
+
+	message := applyEmergencyContactRequest(&contact, request)
+	if message != state.EMPTY {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: message,
+		})
+		return
+	}
+
+	err = s.DB.WithTx(ctx.Request.Context(), func(tx *sqlx.Tx) error {
+		contact.PhoneNumberId, err = getOrCreateUrgencyPhoneNumber(tx, ownerId, contact.MobilePhoneNumber)
+		if err != nil {
+			return err
+		}
+
+		err = database.UpdateTx(tx, contact)
+		if err != nil {
+			return err
+		}
+
+		return removeUnusedUrgencyPhoneNumber(tx, previousPhoneNumberId)
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, contact)
+}
+
+/*
+REMOVE AN EMERGENCY CONTACT OF THE CURRENT USER, OR OF THE STUDENT OF :user_id FOR A LINKED PARENT. THE CONTACT IS SOFT DELETED, SO THAT THE ACCESS LOG STILL POINTS TO IT
+*/
+func (s *Service) RemoveEmergencyContact(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		contact EmergencyContact
+		err     error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	contactId, err := strconv.Atoi(ctx.Param("contact_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	ownerId, allowed := s.contactOwner(ctx, tok)
+	if !allowed {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
+	}
+
+	contact, err = s.GetUserEmergencyContact(ownerId, uint(contactId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownEmergencyContactError,
+		})
+		return
+	}
+
+	err = s.DB.WithTx(ctx.Request.Context(), func(tx *sqlx.Tx) error {
+		err = database.DeleteTx(tx, contact)
+		if err != nil {
+			return err
+		}
+
+		return removeUnusedUrgencyPhoneNumber(tx, contact.PhoneNumberId)
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbDeleteError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+GET WHO READ THE EMERGENCY CONTACTS OF THE CURRENT USER, MOST RECENT FIRST
+*/
+func (s *Service) GetEmergencyContactAccessLog(ctx *gin.Context) {
+	var (
+		tok      *authentication.Token
+		q        query.Query
+		accesses query.Page[EmergencyContactAccess]
+		err      error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, accessSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	accesses, err = query.List[EmergencyContactAccess](s.DB, q, "emergency_contact_access", "emergency_contact_access.user_id = ?", tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, accesses)
+}
+
+/*
+UTILS
+*/
+
+func (s *Service) GetUserEmergencyContacts(q query.Query, userId uint) (contacts query.Page[EmergencyContact], err error) {
+	contacts, err = query.List[EmergencyContact](s.DB, q,
+		`emergency_contact JOIN phone_number ON phone_number.id = emergency_contact.phone_number_id`,
+		`emergency_contact.user_id = ? AND `+database.NotDeleted("phone_number"), userId)
+	if err != nil {
+		return contacts, err
+	}
+	return contacts, err
+}
+
+func (s *Service) GetUserEmergencyContact(userId, contactId uint) (contact EmergencyContact, err error) {
+	err = s.DB.Get(&contact, `SELECT emergency_contact.*, phone_number.mobile_phone_number
+			FROM emergency_contact JOIN phone_number ON phone_number.id = emergency_contact.phone_number_id
+			WHERE emergency_contact.id = ? AND emergency_contact.user_id = ? AND `+database.NotDeleted("emergency_contact")+`
+				AND `+database.NotDeleted("phone_number"), contactId, userId)
+	if err != nil {
+		return contact, err
+	}
+	return contact, err
+}
+
+// LogEmergencyContactAccess records that the holder of tok read contacts.
+func (s *Service) LogEmergencyContactAccess(contacts []EmergencyContact, tok *authentication.Token, ip string) (err error) {
+	for _, contact := range contacts {
+		_, err = s.DB.InsertOne(EmergencyContactAccess{
+			EmergencyContactId:    contact.Id,
+			UserId:                contact.UserId,
+			ViewerId:              tok.UserId,
+			ViewerAuthorizationId: tok.AuthorizationId,
+			Ip:                    ip,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// IsPlanningSharedWithStudent reports whether the authorization and a student authorization of studentId both
+// accepted to take part in the same live calendar planning. Being invited is not enough: both have to accept.
+func (s *Service) IsPlanningSharedWithStudent(authorizationId, studentId uint) bool {
+	var count int
+
+	err := s.DB.Get(&count, `SELECT COUNT(*) FROM calendar_planning
+			JOIN calendar_planning_actor viewer ON viewer.calendar_planning_id = calendar_planning.id
+			JOIN calendar_planning_actor student ON student.calendar_planning_id = calendar_planning.id
+			JOIN authorization ON authorization.id = student.authorization_id
+			WHERE viewer.authorization_id = ? AND authorization.user_id = ? AND authorization.level = ?
+				AND viewer.accepted_at IS NOT NULL AND student.accepted_at IS NOT NULL
+				AND `+database.NotDeleted("calendar_planning")+` AND `+database.NotDeleted("viewer")+`
+				AND `+database.NotDeleted("student")+` AND `+database.NotDeleted("authorization"),
+		authorizationId, studentId, authorization.StudentAuthorizationLevel)
+	if err != nil {
+		return false
+	}
+	return count > state.ZERO
+}
+
+// contactOwner returns whose emergency contacts the request manages: the current user, or the student of the :user_id
+// parameter when the current user is a parent linked to them.
+func (s *Service) contactOwner(ctx *gin.Context, tok *authentication.Token) (userId uint, allowed bool) {
+	if ctx.Param("user_id") == state.EMPTY {
+		return tok.UserId, true
+	}
+
+	studentId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		return 0, false
+	}
+
+	if !authentication.IsParent(ctx) || !s.IsParentOfStudent(tok.UserId, uint(studentId)) {
+		return 0, false
+	}
+	return uint(studentId), true
+}
+
+// applyEmergencyContactRequest validates the request into contact. It returns the error message to send back, if any.
+func applyEmergencyContactRequest(contact *EmergencyContact, request EmergencyContactRequest) (message string) {
+	var ok bool
+
+	contact.Name = strings.TrimSpace(request.Name)
+	if contact.Name == state.EMPTY {
+		return errx.InvalidEmergencyContactError
+	}
+
+	contact.Relationship = strings.ToLower(strings.TrimSpace(request.Relationship))
+	if !relationships[contact.Relationship] {
+		return errx.InvalidEmergencyContactError
+	}
+
+	contact.Priority = request.Priority
+	if contact.Priority <= state.ZERO {
+		return errx.InvalidEmergencyContactError
+	}
+
+	contact.MobilePhoneNumber, ok = utils.NormalizePhone(request.MobilePhoneNumber)
+	if !ok {
+		return errx.InvalidPhoneError
+	}
+
+	return state.EMPTY
+}
+
+func getOrCreateUrgencyPhoneNumber(tx *sqlx.Tx, userId uint, number string) (phoneId uint, err error) {
+	var phone PhoneNumber
+
+	err = database.GetTx(tx, &phone, `SELECT * FROM phone_number WHERE user_id = ? AND mobile_phone_number = ? AND is_urgency = true
+			AND `+database.NotDeleted("phone_number"),
+		userId, number)
+	if err == nil {
+		return phone.Id, err
+	}
+
+	phone.UserId = userId
+	phone.MobilePhoneNumber = number
+	phone.IsUrgency = true
+
+	return database.InsertOneTx(tx, phone)
+}
+
+// removeUnusedUrgencyPhoneNumber deletes the urgency number once no live contact uses it. It is deleted for good,
+// so that adding the same number again doesn't run into the unique index of phone_number.
+func removeUnusedUrgencyPhoneNumber(tx *sqlx.Tx, phoneId uint) (err error) {
+	err = database.ExecTx(tx, `DELETE FROM phone_number WHERE id = ? AND is_urgency = true
+			AND NOT EXISTS (SELECT 1 FROM emergency_contact WHERE emergency_contact.phone_number_id = phone_number.id
+				AND `+database.NotDeleted("emergency_contact")+`)`, phoneId)
+	if err != nil {
+		return err
+	}
+	return err
+}
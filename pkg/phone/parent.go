@@ -0,0 +1,155 @@
+package phone
+
+import (
+	"net/http"
+	"peec/database"
+	"peec/internal/authentication"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"peec/pkg/user/authorization"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StudentParent links a parent to a student. The parent asks for the link, which only counts once the student
+// accepted it: from then on the parent manages the emergency contacts of the student.
+type StudentParent struct {
+	Id         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+	ParentId   uint       `json:"parent_id"`
+	StudentId  uint       `json:"student_id"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+}
+
+/*
+
+	ROUTES Handlers
+
+*/
+
+/*
+ASK A STUDENT TO BE LINKED AS ONE OF ITS PARENTS. ASKING AGAIN IS A NO-OP
+*/
+func (s *Service) RequestParentLink(ctx *gin.Context) {
+	var (
+		tok  *authentication.Token
+		link StudentParent
+		err  error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	studentId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	if !s.isStudent(uint(studentId)) {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownStudentError,
+		})
+		return
+	}
+
+	link.ParentId = tok.UserId
+	link.StudentId = uint(studentId)
+
+	link.Id, err = s.DB.InsertOne(link)
+	if err != nil && !database.IsDuplicate(err) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+ACCEPT THE LINK A PARENT ASKED FOR
+*/
+func (s *Service) AcceptParentLink(ctx *gin.Context) {
+	var (
+		tok *authentication.Token
+		err error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	parentId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	result, err := s.DB.Client.Exec(`UPDATE student_parent SET accepted_at = UTC_TIMESTAMP(), updated_at = CURRENT_TIMESTAMP
+			WHERE parent_id = ? AND student_id = ? AND accepted_at IS NULL AND `+database.NotDeleted("student_parent"),
+		parentId, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected != 1 {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownParentLinkError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+UTILS
+*/
+
+// IsParentOfStudent reports whether studentId accepted parentId as one of its parents.
+func (s *Service) IsParentOfStudent(parentId, studentId uint) bool {
+	var count int
+
+	err := s.DB.Get(&count, `SELECT COUNT(*) FROM student_parent
+			WHERE parent_id = ? AND student_id = ? AND accepted_at IS NOT NULL AND `+database.NotDeleted("student_parent"),
+		parentId, studentId)
+	if err != nil {
+		return false
+	}
+	return count > state.ZERO
+}
+
+func (s *Service) isStudent(userId uint) bool {
+	var count int
+
+	err := s.DB.Get(&count, `SELECT COUNT(*) FROM authorization
+			WHERE user_id = ? AND level = ? AND `+database.NotDeleted("authorization"),
+		userId, authorization.StudentAuthorizationLevel)
+	if err != nil {
+		return false
+	}
+	return count > state.ZERO
+}
@@ -1,27 +1,60 @@
 package phone
 
 import (
+	"fmt"
 	"net/http"
 	"peec/database"
+	"peec/internal/app"
+	"peec/internal/authentication"
+	"peec/internal/query"
 	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/pkg/code"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Service serves the phone numbers and the emergency contacts of the users.
+type Service struct {
+	*app.App
+	codes *code.Service
+}
+
+// NewService returns the phone service, verifying numbers with codes.
+func NewService(a *app.App, codes *code.Service) *Service {
+	return &Service{App: a, codes: codes}
+}
+
+// PhoneNumber belongs to a single user, who may own several. Numbers are stored in E.164 format.
+// The primary number is the one text messages are sent to. IsUrgency marks the number of one of the user's
+// emergency contacts rather than one of their own; those are only managed through EmergencyContact.
 type PhoneNumber struct {
 	Id                uint       `json:"id"`
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 	DeletedAt         *time.Time `json:"deleted_at"`
+	UserId            uint       `json:"user_id"`
 	MobilePhoneNumber string     `json:"mobile_phone_number"`
 	IsUrgency         bool       `json:"is_urgency"`
+	IsPrimary         bool       `json:"is_primary"`
+	IsVerified        bool       `json:"is_verified"`
+}
+
+var phoneSpec = query.Spec{
+	Table:       "phone_number",
+	Sorts:       []string{"created_at", "is_primary"},
+	Filters:     []string{"is_primary", "is_verified"},
+	DefaultSort: "-is_primary",
+}
+
+type PhoneNumberRequest struct {
+	MobilePhoneNumber string `json:"mobile_phone_number"`
 }
 
-type UserPhoneNumber struct {
-	UserId        uint `json:"user_id"`
-	PhoneNumberId uint `json:"phone_number_id"`
+type VerificationRequest struct {
+	Code string `json:"code"`
 }
 
 /*
@@ -31,51 +64,66 @@ type UserPhoneNumber struct {
 */
 
 /*
-ADD NEW PHONE NUMBER TO A USER BY PORVIDING user.id IN THE BODY
+ADD NEW PHONE NUMBER TO THE CURRENT USER. THE FIRST NUMBER BECOMES THE PRIMARY ONE
 */
-func NewPhoneNumber(ctx *gin.Context) {
+func (s *Service) NewPhoneNumber(ctx *gin.Context) {
 	var (
-		userPhoneNumber UserPhoneNumber
-		newPhone        PhoneNumber
-		err             error
+		tok      *authentication.Token
+		request  PhoneNumberRequest
+		newPhone PhoneNumber
+		phones   []PhoneNumber
+		ok       bool
+		err      error
 	)
 
-	userId, err := strconv.Atoi(ctx.Param("user_id"))
+	tok, err = authentication.GetTokenDataFromContext(ctx)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Failed to retrieve params",
+			Message: errx.UnAuthorizedError,
 		})
+		return
 	}
 
-	err = ctx.ShouldBindJSON(&newPhone)
+	err = ctx.ShouldBindJSON(&request)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Failed to get phone number form body",
+			Message: errx.ParseError,
 		})
 		return
 	}
 
-	if !utils.IsValidPhone(newPhone.MobilePhoneNumber) {
+	newPhone.MobilePhoneNumber, ok = utils.NormalizePhone(request.MobilePhoneNumber)
+	if !ok {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Invalid format of phone number",
+			Message: errx.InvalidPhoneError,
 		})
 		return
 	}
 
-	newPhone.Id, err = database.InsertOne(newPhone)
+	phones, err = s.GetUserPhoneNumbers(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Phone number already exist in the database",
+			Message: errx.DbGetError,
 		})
 		return
 	}
-	// Link phone to user.
-	userPhoneNumber.UserId = uint(userId)
-	userPhoneNumber.PhoneNumberId = newPhone.Id
-	_, err = database.InsertOne(userPhoneNumber)
+
+	for _, phone := range phones {
+		if phone.MobilePhoneNumber == newPhone.MobilePhoneNumber {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DuplicatePhoneError,
+			})
+			return
+		}
+	}
+
+	newPhone.UserId = tok.UserId
+	newPhone.IsPrimary = len(phones) == 0
+
+	newPhone.Id, err = s.DB.InsertOne(newPhone)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Failed to link phone number to user",
+			Message: errx.DbInsertError,
 		})
 		return
 	}
@@ -85,70 +133,350 @@ func NewPhoneNumber(ctx *gin.Context) {
 }
 
 /*
-UPDATE PHONE NUMBER OF A USER BY PORVIDING user.id in params AND LIST OF USER PHONE NUMBER
+UPDATE A PHONE NUMBER OF THE CURRENT USER. A CHANGED NUMBER MUST BE VERIFIED AGAIN
 */
-func UpdateUserPhoneNumber(ctx *gin.Context) {
+func (s *Service) UpdateUserPhoneNumber(ctx *gin.Context) {
 	var (
-		newPhone PhoneNumber
-		err      error
+		tok     *authentication.Token
+		request PhoneNumberRequest
+		phone   PhoneNumber
+		number  string
+		ok      bool
+		err     error
 	)
 
-	err = ctx.ShouldBindJSON(&newPhone)
+	tok, err = authentication.GetTokenDataFromContext(ctx)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+			Message: errx.UnAuthorizedError,
 		})
 		return
 	}
-	if newPhone.Id == 0 {
+
+	phoneId, err := strconv.Atoi(ctx.Param("phone_id"))
+	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "phone id is required for the operation",
+			Message: errx.ParamsError,
 		})
 		return
 	}
-	if !utils.IsValidPhone(newPhone.MobilePhoneNumber) {
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Invalid format of phone number",
+			Message: errx.ParseError,
 		})
 		return
 	}
-	err = database.Update(newPhone)
+
+	number, ok = utils.NormalizePhone(request.MobilePhoneNumber)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidPhoneError,
+		})
+		return
+	}
+
+	phone, err = s.GetUserPhoneNumberById(tok.UserId, uint(phoneId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPhoneError,
+		})
+		return
+	}
+
+	if phone.MobilePhoneNumber != number {
+		phone.MobilePhoneNumber = number
+		phone.IsVerified = false
+	}
+
+	err = s.DB.Update(phone)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Failed to update mobile phone number",
+			Message: errx.DbUpdateError,
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, newPhone)
+	ctx.JSON(http.StatusOK, phone)
 	return
 }
 
 /*
-GET USER PHONE NUMBER BASED ON user_id PROVIDED IN PARAMS
+GET EVERY PHONE NUMBER OF THE CURRENT USER, PRIMARY FIRST
 */
-
-func GetUserPhoneNumber(ctx *gin.Context) {
+func (s *Service) GetUserPhoneNumber(ctx *gin.Context) {
 	var (
-		userId int
-		phone  PhoneNumber
+		tok    *authentication.Token
+		q      query.Query
+		phones query.Page[PhoneNumber]
 		err    error
 	)
 
-	userId, err = strconv.Atoi(ctx.Param("user_id"))
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, phoneSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	phones, err = query.List[PhoneNumber](s.DB, q, "phone_number", "phone_number.user_id = ? AND phone_number.is_urgency = false", tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, phones)
+}
+
+/*
+REMOVE A PHONE NUMBER OF THE CURRENT USER. THE OLDEST REMAINING VERIFIED NUMBER BECOMES PRIMARY IF NEEDED,
+OTHERWISE THE USER IS LEFT WITHOUT ONE
+*/
+func (s *Service) RemoveUserPhoneNumber(ctx *gin.Context) {
+	var (
+		tok   *authentication.Token
+		phone PhoneNumber
+		err   error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	phoneId, err := strconv.Atoi(ctx.Param("phone_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	phone, err = s.GetUserPhoneNumberById(tok.UserId, uint(phoneId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPhoneError,
+		})
+		return
+	}
+
+	err = s.DB.HardDelete(phone)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbDeleteError,
+		})
+		return
+	}
+
+	if phone.IsPrimary {
+		err = s.DB.Exec(`UPDATE phone_number SET is_primary = true WHERE user_id = ? AND is_verified = true AND is_urgency = false ORDER BY id LIMIT 1`, tok.UserId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbUpdateError,
+			})
+			return
+		}
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+SET THE PRIMARY PHONE NUMBER OF THE CURRENT USER. ONLY A VERIFIED NUMBER CAN BE PRIMARY
+*/
+func (s *Service) SetPrimaryPhoneNumber(ctx *gin.Context) {
+	var (
+		tok   *authentication.Token
+		phone PhoneNumber
+		err   error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	phoneId, err := strconv.Atoi(ctx.Param("phone_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	phone, err = s.GetUserPhoneNumberById(tok.UserId, uint(phoneId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPhoneError,
+		})
+		return
+	}
+
+	if !phone.IsVerified {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnverifiedPhoneError,
+		})
+		return
+	}
+
+	err = s.DB.Exec(`UPDATE phone_number SET is_primary = (id = ?), updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND is_urgency = false`,
+		phone.Id, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+SEND A VERIFICATION CODE BY SMS TO A PHONE NUMBER OF THE CURRENT USER
+*/
+func (s *Service) SendPhoneVerificationCode(ctx *gin.Context) {
+	var (
+		tok              *authentication.Token
+		phone            PhoneNumber
+		verificationCode code.Code
+		err              error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	phoneId, err := strconv.Atoi(ctx.Param("phone_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	phone, err = s.GetUserPhoneNumberById(tok.UserId, uint(phoneId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPhoneError,
+		})
+		return
+	}
+
+	verificationCode, err = s.codes.NewPhoneVerificationCode(tok.UserId, phone.Id)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	err = s.Sms.Send(phone.MobilePhoneNumber, fmt.Sprintf("Your Peec verification code is %s. It expires in %d minutes.",
+		verificationCode.String(), int(s.Config.VerificationCodeLifeTime().Minutes())))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.SendSmsError,
+		})
+		return
+	}
+
+	if s.Config.IsDev() {
+		ctx.JSON(http.StatusOK, gin.H{
+			"code": verificationCode.String(),
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+VERIFY A PHONE NUMBER OF THE CURRENT USER WITH THE CODE RECEIVED BY SMS
+*/
+func (s *Service) VerifyPhoneNumber(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		request VerificationRequest
+		phone   PhoneNumber
+		err     error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+			Message: errx.UnAuthorizedError,
 		})
+		return
 	}
 
-	err = database.Get(&phone, `SELECT phone_number.mobile_phone_number
-	FROM phone_number JOIN user_phone_number 
-	ON phone_number.id = user_phone_number.id 
-	WHERE user_phone_number.user_id = ?`, userId)
+	phoneId, err := strconv.Atoi(ctx.Param("phone_id"))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: "Failed to fetch phone number  user_id unknown",
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	verificationCode, err := strconv.Atoi(request.Code)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidVerificationError,
+		})
+		return
+	}
+
+	phone, err = s.GetUserPhoneNumberById(tok.UserId, uint(phoneId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPhoneError,
+		})
+		return
+	}
+
+	err = s.codes.ConsumePhoneVerificationCode(tok.UserId, phone.Id, verificationCode)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidVerificationError,
+		})
+		return
+	}
+
+	phone.IsVerified = true
+
+	err = s.DB.Update(phone)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
 		})
 		return
 	}
@@ -159,3 +487,32 @@ func GetUserPhoneNumber(ctx *gin.Context) {
 /*
 UTILS
 */
+
+func (s *Service) GetUserPhoneNumbers(userId uint) (phones []PhoneNumber, err error) {
+	phones = []PhoneNumber{}
+	err = s.DB.Select(&phones, `SELECT * FROM phone_number WHERE user_id = ? AND is_urgency = false AND `+database.NotDeleted("phone_number")+`
+			ORDER BY is_primary DESC, id`, userId)
+	if err != nil {
+		return phones, err
+	}
+	return phones, err
+}
+
+func (s *Service) GetUserPhoneNumberById(userId, phoneId uint) (phone PhoneNumber, err error) {
+	err = s.DB.Get(&phone, `SELECT * FROM phone_number WHERE id = ? AND user_id = ? AND is_urgency = false AND `+database.NotDeleted("phone_number"), phoneId, userId)
+	if err != nil {
+		return phone, err
+	}
+	return phone, err
+}
+
+// GetPrimaryPhoneNumber returns the verified primary number of the user, the one text messages are sent to.
+func (s *Service) GetPrimaryPhoneNumber(userId uint) (phone PhoneNumber, err error) {
+	err = s.DB.Get(&phone, `SELECT * FROM phone_number
+              WHERE user_id = ? AND is_primary = true AND is_verified = true AND is_urgency = false
+              AND `+database.NotDeleted("phone_number"), userId)
+	if err != nil {
+		return phone, err
+	}
+	return phone, err
+}
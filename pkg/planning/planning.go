@@ -1,19 +1,45 @@
 package planning
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"log"
 	"net/http"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
+	"peec/internal/mailer"
+	"peec/internal/outbox"
+	"peec/internal/query"
+	"peec/internal/realtime"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
+	"peec/pkg/notification"
 	"peec/pkg/user"
 	"peec/pkg/user/authorization"
 	"strconv"
 	"time"
 )
 
+// Service serves the calendar plannings and their actors.
+type Service struct {
+	*app.App
+	authorizations *authorization.Service
+	notifications  *notification.Service
+	users          *user.Service
+}
+
+// NewService returns the planning service, registering the invitation email and notification.
+func NewService(a *app.App, authorizations *authorization.Service, notifications *notification.Service,
+	users *user.Service) *Service {
+	s := &Service{App: a, authorizations: authorizations, notifications: notifications, users: users}
+	notifications.RegisterMail(notification.TypePlanningInvitation, s.planningInvitationMail)
+	s.Outbox.Subscribe("planning.invitation_notification", outbox.EventPlanningActorAdded, s.notifyInvitedActor)
+	return s
+}
+
 type CalendarPlanning struct {
 	Id              uint       `json:"id"`
 	CreatedAt       time.Time  `json:"created_at"`
@@ -25,6 +51,26 @@ type CalendarPlanning struct {
 	Description     string     `json:"description"`
 }
 
+// Planning changes pushed to the participants of a calendar planning.
+const (
+	PlanningCreated      = "created"
+	PlanningDeleted      = "deleted"
+	PlanningActorAdded   = "actor_added"
+	PlanningActorRemoved = "actor_removed"
+)
+
+type PlanningChange struct {
+	Action             string `json:"action"`
+	CalendarPlanningId uint   `json:"calendar_planning_id"`
+	UserId             uint   `json:"user_id,omitempty"`
+}
+
+var actorSpec = query.Spec{
+	Table:   "user",
+	Sorts:   []string{"name", "family_name", "created_at"},
+	Filters: []string{"status"},
+}
+
 type CalendarPlanningActor struct {
 	Id                 uint       `json:"id"`
 	CreatedAt          time.Time  `json:"created_at"`
@@ -32,14 +78,15 @@ type CalendarPlanningActor struct {
 	DeletedAt          *time.Time `json:"deleted_at"`
 	AuthorizationId    uint       `json:"authorization_id"`
 	CalendarPlanningId uint       `json:"calendar_planning_id"`
+	// AcceptedAt is set once the invited user accepted to take part in the planning.
+	AcceptedAt *time.Time `json:"accepted_at"`
 }
 
-func CreateUserPlannings(ctx *gin.Context) {
+func (s *Service) CreateUserPlannings(ctx *gin.Context) {
 	var (
-		tok                   *authentication.Token
-		err                   error
-		calendarPlanning      CalendarPlanning
-		calendarPlanningActor CalendarPlanningActor
+		tok              *authentication.Token
+		err              error
+		calendarPlanning CalendarPlanning
 	)
 
 	err = ctx.ShouldBindJSON(&calendarPlanning)
@@ -58,15 +105,9 @@ func CreateUserPlannings(ctx *gin.Context) {
 		return
 	}
 
-	calendarPlanning.AuthorizationId, err = GetUserAuthorizationId(tok.UserId)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
+	calendarPlanning.AuthorizationId = tok.AuthorizationId
 
-	calendarId, err := database.InsertOne(calendarPlanning)
+	calendarId, err := s.CreateCalendarPlanning(ctx.Request.Context(), calendarPlanning, tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
@@ -74,21 +115,12 @@ func CreateUserPlannings(ctx *gin.Context) {
 		return
 	}
 
-	calendarPlanningActor.AuthorizationId = calendarPlanning.AuthorizationId
-	calendarPlanningActor.CalendarPlanningId = calendarId
-
-	err = AddCalendarPlanningActor(calendarPlanningActor)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.DbInsertError,
-		})
-		return
-	}
+	s.publishPlanningChange(PlanningChange{Action: PlanningCreated, CalendarPlanningId: calendarId}, nil)
 
 	ctx.AbortWithStatusJSON(http.StatusOK, calendarPlanning)
 }
 
-func GetUserPlannings(ctx *gin.Context) {
+func (s *Service) GetUserPlannings(ctx *gin.Context) {
 	var (
 		tok              *authentication.Token
 		err              error
@@ -104,15 +136,9 @@ func GetUserPlannings(ctx *gin.Context) {
 		return
 	}
 
-	authorizationId, err = GetUserAuthorizationId(tok.UserId)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
+	authorizationId = tok.AuthorizationId
 
-	calendarPlanning, err = GetPlanningById(authorizationId)
+	calendarPlanning, err = s.GetPlanningById(authorizationId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -123,7 +149,7 @@ func GetUserPlannings(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, calendarPlanning)
 }
 
-func RemoveUserPlannings(ctx *gin.Context) {
+func (s *Service) RemoveUserPlannings(ctx *gin.Context) {
 	var (
 		tok              *authentication.Token
 		err              error
@@ -139,7 +165,9 @@ func RemoveUserPlannings(ctx *gin.Context) {
 		return
 	}
 
-	authorizationId, err = GetUserAuthorizationId(tok.UserId)
+	authorizationId = tok.AuthorizationId
+
+	calendarPlanning, err = s.GetPlanningById(authorizationId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -147,15 +175,15 @@ func RemoveUserPlannings(ctx *gin.Context) {
 		return
 	}
 
-	calendarPlanning, err = GetPlanningById(authorizationId)
+	participantIds, err := s.GetPlanningUserIds(calendarPlanning.Id)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
+			Message: errx.DbGetError,
 		})
 		return
 	}
 
-	err = database.Delete(calendarPlanning)
+	err = s.DeleteCalendarPlanning(ctx.Request.Context(), calendarPlanning, tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -163,10 +191,12 @@ func RemoveUserPlannings(ctx *gin.Context) {
 		return
 	}
 
+	s.publishPlanningChange(PlanningChange{Action: PlanningDeleted, CalendarPlanningId: calendarPlanning.Id}, participantIds)
+
 	ctx.AbortWithStatus(http.StatusOK)
 }
 
-func AddUserIntoPlanning(ctx *gin.Context) {
+func (s *Service) AddUserIntoPlanning(ctx *gin.Context) {
 	var (
 		tok                   *authentication.Token
 		calendarPlanningActor CalendarPlanningActor
@@ -205,7 +235,31 @@ func AddUserIntoPlanning(ctx *gin.Context) {
 		return
 	}
 
-	authorizationId, err := GetUserAuthorizationId(selectedUser.Id)
+	calendarPlanning, err := s.GetCalendarPlanning(uint(calendarId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPlanningError,
+		})
+		return
+	}
+
+	// Only the author invites to a planning: taking part in one grants access to the emergency contacts of its students.
+	if calendarPlanning.AuthorizationId != tok.AuthorizationId {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
+	}
+
+	actorLevel, ok := authorization.RoleLevel(ctx.Param("actor"))
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidRoleError,
+		})
+		return
+	}
+
+	actorAuthorization, err := s.authorizations.GetUserAuthorization(selectedUser.Id, actorLevel)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -213,25 +267,81 @@ func AddUserIntoPlanning(ctx *gin.Context) {
 		return
 	}
 
-	calendarPlanningActor.AuthorizationId = authorizationId
+	calendarPlanningActor.AuthorizationId = actorAuthorization.Id
 	calendarPlanningActor.CalendarPlanningId = uint(calendarId)
 
-	err = AddCalendarPlanningActor(calendarPlanningActor)
+	err = s.InviteCalendarPlanningActor(ctx.Request.Context(), calendarPlanningActor, selectedUser.Id, tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbInsertError,
 		})
 		return
 	}
+
+	s.publishPlanningChange(PlanningChange{Action: PlanningActorAdded, CalendarPlanningId: uint(calendarId), UserId: selectedUser.Id}, nil)
+
 	ctx.AbortWithStatusJSON(http.StatusOK, calendarPlanningActor)
 }
 
-func GetPlanningActors(ctx *gin.Context) {
+// AcceptPlanning lets an invited user accept to take part in the planning, with the role they currently act as.
+func (s *Service) AcceptPlanning(ctx *gin.Context) {
 	var (
+		tok *authentication.Token
+		err error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	calendarId, err := strconv.Atoi(ctx.Param("calendar_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	accepted, err := s.AcceptCalendarPlanningActor(uint(calendarId), tok.AuthorizationId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	if !accepted {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPlanningInvitationError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+// GetPlanningActors lists the users who accepted to take part in the calendar planning. Only its actors, invited or
+// accepted, may list them. See query.Query for the parameters.
+func (s *Service) GetPlanningActors(ctx *gin.Context) {
+	var (
+		tok                    *authentication.Token
 		err                    error
-		calendarPlanningActors []user.User
+		q                      query.Query
+		calendarPlanningActors query.Page[user.User]
 	)
 
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
 	calendarId, err := strconv.Atoi(ctx.Param("calendar_id"))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
@@ -240,7 +350,30 @@ func GetPlanningActors(ctx *gin.Context) {
 		return
 	}
 
-	calendarPlanningActors, err = GetPlanningActorByCalendarId(uint(calendarId))
+	isActor, err := s.IsPlanningActor(uint(calendarId), tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	if !isActor {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, actorSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	calendarPlanningActors, err = s.GetPlanningActorByCalendarId(q, uint(calendarId))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -251,7 +384,8 @@ func GetPlanningActors(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, calendarPlanningActors)
 }
 
-func RemoveUserFromPlanning(ctx *gin.Context) {
+// RemoveUserFromPlanning lets the author of the planning remove one of its actors, and an actor leave it.
+func (s *Service) RemoveUserFromPlanning(ctx *gin.Context) {
 	var (
 		selectedCalendarPlanningActor CalendarPlanningActor
 		selectedUser                  user.User
@@ -290,7 +424,30 @@ func RemoveUserFromPlanning(ctx *gin.Context) {
 		return
 	}
 
-	selectedCalendarPlanningActor, err = GetSelectedPlanningActor(selectedUser.Id, uint(calendarPlanningId))
+	calendarPlanning, err := s.GetCalendarPlanning(uint(calendarPlanningId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownPlanningError,
+		})
+		return
+	}
+
+	if calendarPlanning.AuthorizationId != tok.AuthorizationId && selectedUser.Id != tok.UserId {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.ForbiddenError,
+		})
+		return
+	}
+
+	selectedCalendarPlanningActor, err = s.GetSelectedPlanningActor(selectedUser.Id, uint(calendarPlanningId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	participantIds, err := s.GetPlanningUserIds(uint(calendarPlanningId))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -298,13 +455,16 @@ func RemoveUserFromPlanning(ctx *gin.Context) {
 		return
 	}
 
-	err = RemoveSelectedPlanningActor(selectedCalendarPlanningActor)
+	err = s.RemoveSelectedPlanningActor(ctx.Request.Context(), selectedCalendarPlanningActor, selectedUser.Id)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
 		})
 		return
 	}
+
+	s.publishPlanningChange(PlanningChange{Action: PlanningActorRemoved, CalendarPlanningId: uint(calendarPlanningId), UserId: selectedUser.Id}, participantIds)
+
 	ctx.AbortWithStatus(http.StatusOK)
 }
 
@@ -312,61 +472,249 @@ func RemoveUserFromPlanning(ctx *gin.Context) {
 	UTILS
 */
 
-func GetUserAuthorizationId(userId uint) (id uint, err error) {
-	var userAuthorization authorization.Authorization
-	err = database.Get(&userAuthorization, `SELECT * FROM authorization WHERE authorization.user_id = ?`, userId)
+// CreateCalendarPlanning inserts the planning with its author as first actor, along with the event of the change.
+func (s *Service) CreateCalendarPlanning(ctx context.Context, calendarPlanning CalendarPlanning, userId uint) (calendarId uint, err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		calendarId, err = database.InsertOneTx(tx, calendarPlanning)
+		if err != nil {
+			return err
+		}
+
+		acceptedAt := time.Now().UTC()
+		_, err = database.InsertOneTx(tx, CalendarPlanningActor{
+			AuthorizationId:    calendarPlanning.AuthorizationId,
+			CalendarPlanningId: calendarId,
+			AcceptedAt:         &acceptedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = s.Outbox.Enqueue(tx, outbox.EventPlanningCreated, outbox.PlanningChanged{CalendarPlanningId: calendarId, UserId: userId})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return calendarId, err
+}
+
+// DeleteCalendarPlanning deletes the planning along with the event of the change.
+func (s *Service) DeleteCalendarPlanning(ctx context.Context, calendarPlanning CalendarPlanning, userId uint) (err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		err = database.DeleteTx(tx, calendarPlanning)
+		if err != nil {
+			return err
+		}
+
+		err = s.Outbox.Enqueue(tx, outbox.EventPlanningDeleted, outbox.PlanningChanged{CalendarPlanningId: calendarPlanning.Id, UserId: userId})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return err
+}
+
+func (s *Service) GetPlanningById(authorizationId uint) (calendarPlanning CalendarPlanning, err error) {
+	err = s.DB.Get(&calendarPlanning, `SELECT *  FROM calendar_planning WHERE calendar_planning.authorization_id = ? AND `+database.NotDeleted("calendar_planning"), authorizationId)
 	if err != nil {
-		return 0, err
+		return calendarPlanning, err
 	}
-	return userAuthorization.Id, nil
+	return calendarPlanning, err
 }
 
-func GetPlanningById(authorizationId uint) (calendarPlanning CalendarPlanning, err error) {
-	err = database.Get(&calendarPlanning, `SELECT *  FROM calendar_planning WHERE calendar_planning.authorization_id = ?`, authorizationId)
+func (s *Service) GetCalendarPlanning(id uint) (calendarPlanning CalendarPlanning, err error) {
+	err = s.DB.Get(&calendarPlanning, `SELECT * FROM calendar_planning WHERE calendar_planning.id = ? AND `+database.NotDeleted("calendar_planning"), id)
 	if err != nil {
 		return calendarPlanning, err
 	}
 	return calendarPlanning, err
 }
 
-func AddCalendarPlanningActor(calendarPlanningActor CalendarPlanningActor) (err error) {
-	_, err = database.InsertOne(calendarPlanningActor)
+func (s *Service) AddCalendarPlanningActor(calendarPlanningActor CalendarPlanningActor) (err error) {
+	_, err = s.DB.InsertOne(calendarPlanningActor)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func GetPlanningActorByCalendarId(calendarId uint) (calendarPlanningActors []user.User, err error) {
-	err = database.GetMany(&calendarPlanningActors,
-		`SELECT user.* FROM user
+// InviteCalendarPlanningActor adds the actor along with the event inviting userId to the planning.
+func (s *Service) InviteCalendarPlanningActor(ctx context.Context, calendarPlanningActor CalendarPlanningActor, userId, invitedBy uint) (err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		_, err = database.InsertOneTx(tx, calendarPlanningActor)
+		if err != nil {
+			return err
+		}
+
+		err = s.Outbox.Enqueue(tx, outbox.EventPlanningActorAdded, outbox.PlanningActorAdded{
+			CalendarPlanningId: calendarPlanningActor.CalendarPlanningId,
+			UserId:             userId,
+			AddedBy:            invitedBy,
+		})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return err
+}
+
+// AcceptCalendarPlanningActor marks the invitation of the authorization to the planning as accepted. It reports
+// false when there is no pending invitation to a live planning.
+func (s *Service) AcceptCalendarPlanningActor(calendarPlanningId, authorizationId uint) (accepted bool, err error) {
+	result, err := s.DB.Client.Exec(`UPDATE calendar_planning_actor JOIN calendar_planning
+				ON calendar_planning.id = calendar_planning_actor.calendar_planning_id
+			SET calendar_planning_actor.accepted_at = UTC_TIMESTAMP(), calendar_planning_actor.updated_at = CURRENT_TIMESTAMP
+			WHERE calendar_planning_actor.calendar_planning_id = ? AND calendar_planning_actor.authorization_id = ?
+				AND calendar_planning_actor.accepted_at IS NULL AND `+database.NotDeleted("calendar_planning"),
+		calendarPlanningId, authorizationId)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, err
+}
+
+// notifyInvitedActor is the outbox handler telling a user they were added to a planning.
+func (s *Service) notifyInvitedActor(event outbox.OutboxEvent) (err error) {
+	var added outbox.PlanningActorAdded
+
+	err = event.Decode(&added)
+	if err != nil {
+		return err
+	}
+
+	return s.notifications.Notify(event.Id, added.UserId, added.AddedBy, notification.TypePlanningInvitation, added.CalendarPlanningId,
+		"You were added to a calendar planning")
+}
+
+// GetPlanningActorByCalendarId lists the users who accepted to take part in the planning, pending invitations left out.
+func (s *Service) GetPlanningActorByCalendarId(q query.Query, calendarId uint) (calendarPlanningActors query.Page[user.User], err error) {
+	calendarPlanningActors, err = query.List[user.User](s.DB, q, `user
               JOIN authorization ON user.id = authorization.user_id
-              JOIN calendar_planning_actor ON authorization.id = calendar_planning_actor.authorization_id
-              JOIN calendar_planning ON calendar_planning_actor.calendar_planning_id = calendar_planning.id
-     WHERE calendar_planning.id = ?`, calendarId)
+              JOIN calendar_planning_actor ON authorization.id = calendar_planning_actor.authorization_id`,
+		`calendar_planning_actor.calendar_planning_id = ? AND calendar_planning_actor.accepted_at IS NOT NULL
+		AND `+database.NotDeleted("authorization")+`
+		AND `+database.NotDeleted("calendar_planning_actor"), calendarId)
 	if err != nil {
 		return calendarPlanningActors, err
 	}
 	return calendarPlanningActors, err
 }
 
-func GetSelectedPlanningActor(userId uint, calendarPlanningId uint) (calendarPlanningActor CalendarPlanningActor, err error) {
-	err = database.Get(&calendarPlanningActor,
+// IsPlanningActor reports whether userId takes part in the live planning, or is invited to, with any of its roles.
+func (s *Service) IsPlanningActor(calendarId, userId uint) (isActor bool, err error) {
+	var count int
+
+	err = s.DB.Get(&count, `SELECT COUNT(*) FROM calendar_planning_actor
+              JOIN authorization ON authorization.id = calendar_planning_actor.authorization_id
+              JOIN calendar_planning ON calendar_planning.id = calendar_planning_actor.calendar_planning_id
+     WHERE calendar_planning.id = ? AND authorization.user_id = ? AND `+database.NotDeleted("calendar_planning")+`
+     AND `+database.NotDeleted("calendar_planning_actor")+` AND `+database.NotDeleted("authorization"), calendarId, userId)
+	if err != nil {
+		return false, err
+	}
+	return count > state.ZERO, err
+}
+
+// GetPlanningUserIds returns the users taking part in the calendar planning, whatever their role.
+func (s *Service) GetPlanningUserIds(calendarId uint) (userIds []uint, err error) {
+	err = s.DB.Select(&userIds, `SELECT DISTINCT authorization.user_id FROM authorization
+              JOIN calendar_planning_actor ON authorization.id = calendar_planning_actor.authorization_id
+     WHERE calendar_planning_actor.calendar_planning_id = ? AND `+database.NotDeleted("authorization")+`
+     AND `+database.NotDeleted("calendar_planning_actor"), calendarId)
+	if err != nil {
+		return userIds, err
+	}
+	return userIds, err
+}
+
+// publishPlanningChange pushes the change to userIds, or to the current participants of the planning when nil.
+// Failures are only logged: the change itself is already saved.
+func (s *Service) publishPlanningChange(change PlanningChange, userIds []uint) {
+	var err error
+
+	if userIds == nil {
+		userIds, err = s.GetPlanningUserIds(change.CalendarPlanningId)
+		if err != nil {
+			log.Println("planning change:", err)
+			return
+		}
+	}
+
+	err = s.Realtime.PublishToUsers(userIds, realtime.EventPlanning, change)
+	if err != nil {
+		log.Println("planning change:", err)
+	}
+}
+
+func (s *Service) GetSelectedPlanningActor(userId uint, calendarPlanningId uint) (calendarPlanningActor CalendarPlanningActor, err error) {
+	err = s.DB.Get(&calendarPlanningActor,
 		`SELECT calendar_planning_actor.*  FROM calendar_planning_actor
                                   JOIN authorization ON calendar_planning_actor.authorization_id = authorization.id
                                   JOIN calendar_planning ON calendar_planning_actor.calendar_planning_id = calendar_planning.id
                                   JOIN user ON authorization.user_id = user.id
-                                  WHERE user.id= ? AND calendar_planning.id = ?`, userId, calendarPlanningId)
+                                  WHERE user.id= ? AND calendar_planning.id = ? AND `+database.NotDeleted("calendar_planning")+`
+                                  AND `+database.NotDeleted("user")+` AND `+database.NotDeleted("authorization")+`
+                                  AND `+database.NotDeleted("calendar_planning_actor"), userId, calendarPlanningId)
 	if err != nil {
 		return calendarPlanningActor, err
 	}
 	return calendarPlanningActor, nil
 }
 
-func RemoveSelectedPlanningActor(calendarPlanningActor CalendarPlanningActor) (err error) {
-	err = database.Delete(calendarPlanningActor)
+// RemoveSelectedPlanningActor removes the actor of userId along with the event of the change.
+func (s *Service) RemoveSelectedPlanningActor(ctx context.Context, calendarPlanningActor CalendarPlanningActor, userId uint) (err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		err = database.HardDeleteTx(tx, calendarPlanningActor)
+		if err != nil {
+			return err
+		}
+
+		err = s.Outbox.Enqueue(tx, outbox.EventPlanningActorRemoved, outbox.PlanningChanged{
+			CalendarPlanningId: calendarPlanningActor.CalendarPlanningId,
+			UserId:             userId,
+		})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return err
+}
+
+// planningInvitationMail is the email of a planning invitation notification, sent in place of the generic one.
+func (s *Service) planningInvitationMail(invitation notification.Notification) (msg mailer.Message, err error) {
+	inviter, err := s.users.GetUserWithId(invitation.ActorId)
 	if err != nil {
-		return err
+		return msg, err
 	}
-	return nil
+
+	invitee, err := s.users.GetUserWithId(invitation.UserId)
+	if err != nil {
+		return msg, err
+	}
+
+	calendarPlanning, err := s.GetCalendarPlanning(invitation.ReferenceId)
+	if err != nil {
+		return msg, err
+	}
+
+	return mailer.Render(mailer.TemplatePlanningInvitation, mailer.PlanningInvitationData{
+		Name:          invitee.Name,
+		InvitedBy:     inviter.Name,
+		Description:   calendarPlanning.Description,
+		StartDateTime: calendarPlanning.StartDateTime,
+		EndDateTime:   calendarPlanning.EndDateTime,
+	})
 }
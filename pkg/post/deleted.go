@@ -0,0 +1,79 @@
+package post
+
+import (
+	"net/http"
+	"peec/database"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var deletedPostSpec = query.Spec{
+	Table:       "post",
+	Sorts:       []string{"created_at", "deleted_at"},
+	Filters:     []string{"poster_id"},
+	DefaultSort: "-deleted_at",
+	Deleted:     true,
+}
+
+// GetDeletedPosts lists the soft deleted posts, last deleted first.
+func (s *Service) GetDeletedPosts(ctx *gin.Context) {
+	var (
+		err   error
+		q     query.Query
+		posts query.Page[Post]
+	)
+
+	q, err = query.Parse(ctx, deletedPostSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	posts, err = query.List[Post](s.DB, q, "post", "")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, posts)
+}
+
+// RestorePost brings a soft deleted post back. Followers are not notified again.
+func (s *Service) RestorePost(ctx *gin.Context) {
+	var post Post
+
+	postId, err := strconv.Atoi(ctx.Param("post_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = s.DB.Get(&post, `SELECT * FROM post WHERE id = ? AND `+database.DeletedClause, postId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownDeletedPostError,
+		})
+		return
+	}
+
+	err = s.DB.Restore(post)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	post.DeletedAt = nil
+	ctx.JSON(http.StatusOK, post)
+}
@@ -0,0 +1,102 @@
+package post
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"peec/database"
+	"peec/internal/authentication"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"strconv"
+	"time"
+)
+
+// UserFollow subscribes FollowerId to the posts of FollowedId.
+type UserFollow struct {
+	Id         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+	FollowerId uint       `json:"follower_id"`
+	FollowedId uint       `json:"followed_id"`
+}
+
+func (s *Service) FollowUser(ctx *gin.Context) {
+	var (
+		tok *authentication.Token
+		err error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	followedId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil || uint(followedId) == tok.UserId {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = s.DB.Exec(`INSERT IGNORE INTO user_follow (follower_id, followed_id) VALUES (?, ?)`, tok.UserId, followedId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+func (s *Service) UnfollowUser(ctx *gin.Context) {
+	var (
+		tok *authentication.Token
+		err error
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	followedId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = s.DB.Exec(`DELETE FROM user_follow WHERE follower_id = ? AND followed_id = ?`, tok.UserId, followedId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbDeleteError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+
+	UTILS
+
+*/
+
+func (s *Service) GetFollowerIds(userId uint) (followerIds []uint, err error) {
+	err = s.DB.Select(&followerIds, `SELECT follower_id FROM user_follow WHERE followed_id = ? AND `+database.NotDeleted("user_follow"), userId)
+	if err != nil {
+		return followerIds, err
+	}
+	return followerIds, err
+}
@@ -1,17 +1,38 @@
 package post
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 	"net/http"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
+	"peec/internal/outbox"
+	"peec/internal/query"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
+	"peec/pkg/notification"
+	"peec/pkg/user"
 	"strconv"
 	"time"
 )
 
+// Service serves the posts and the followers of the users.
+type Service struct {
+	*app.App
+	notifications *notification.Service
+	users         *user.Service
+}
+
+// NewService returns the post service, subscribing the follower notification to the outbox.
+func NewService(a *app.App, notifications *notification.Service, users *user.Service) *Service {
+	s := &Service{App: a, notifications: notifications, users: users}
+	s.Outbox.Subscribe("post.follower_notification", outbox.EventPostPublished, s.notifyFollowers)
+	return s
+}
+
 type Post struct {
 	Id        uint       `json:"id"`
 	CreatedAt time.Time  `json:"created_at"`
@@ -21,6 +42,13 @@ type Post struct {
 	MediaXid  string     `json:"media_xid"`
 }
 
+var postSpec = query.Spec{
+	Table:       "post",
+	Sorts:       []string{"created_at"},
+	Filters:     []string{"poster_id"},
+	DefaultSort: "-created_at",
+}
+
 type UserPost struct {
 	Id        uint       `json:"id"`
 	CreatedAt time.Time  `json:"created_at"`
@@ -30,12 +58,11 @@ type UserPost struct {
 	UserId    uint       `json:"userId"`
 }
 
-func CreatePost(ctx *gin.Context) {
+func (s *Service) CreatePost(ctx *gin.Context) {
 	var (
-		err      error
-		tok      *authentication.Token
-		post     Post
-		userPost UserPost
+		err  error
+		tok  *authentication.Token
+		post Post
 	)
 	err = ctx.ShouldBindJSON(&post)
 	if err != nil {
@@ -61,18 +88,7 @@ func CreatePost(ctx *gin.Context) {
 		return
 	}
 
-	postId, err := database.InsertOne(post)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
-
-	userPost.PostId = postId
-	userPost.UserId = tok.UserId
-
-	_, err = database.InsertOne(userPost)
+	post.Id, err = s.PublishPost(ctx.Request.Context(), post, tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -84,7 +100,7 @@ func CreatePost(ctx *gin.Context) {
 	return
 }
 
-func DeletePost(ctx *gin.Context) {
+func (s *Service) DeletePost(ctx *gin.Context) {
 	var (
 		tok  *authentication.Token
 		err  error
@@ -113,7 +129,7 @@ func DeletePost(ctx *gin.Context) {
 		return
 	}
 
-	post, err = GetPost(postId)
+	post, err = s.GetPost(postId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -121,7 +137,7 @@ func DeletePost(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Delete(post)
+	err = s.DB.Delete(post)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbDeleteError,
@@ -133,7 +149,7 @@ func DeletePost(ctx *gin.Context) {
 	return
 }
 
-func GetSinglePost(ctx *gin.Context) {
+func (s *Service) GetSinglePost(ctx *gin.Context) {
 	var (
 		tok  *authentication.Token
 		err  error
@@ -162,7 +178,7 @@ func GetSinglePost(ctx *gin.Context) {
 		return
 	}
 
-	post, err = GetPost(postId)
+	post, err = s.GetPost(postId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -173,15 +189,26 @@ func GetSinglePost(ctx *gin.Context) {
 	return
 }
 
-func GetPosts(ctx *gin.Context) {
+// GetPosts lists the posts, most recent first. See query.Query for the parameters.
+func (s *Service) GetPosts(ctx *gin.Context) {
 	var (
-		posts []Post
+		q     query.Query
+		posts query.Page[Post]
 		err   error
 	)
-	err = database.Select(posts, `SELECT * FROM post`)
+
+	q, err = query.Parse(ctx, postSpec)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	posts, err = query.List[Post](s.DB, q, "post", "")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
 		})
 		return
 	}
@@ -189,9 +216,11 @@ func GetPosts(ctx *gin.Context) {
 	return
 }
 
-func GetUserPosts(ctx *gin.Context) {
+// GetUserPosts lists the posts of the user, most recent first.
+func (s *Service) GetUserPosts(ctx *gin.Context) {
 	var (
-		posts []Post
+		q     query.Query
+		posts query.Page[Post]
 		err   error
 		tok   *authentication.Token
 	)
@@ -204,10 +233,18 @@ func GetUserPosts(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Select(posts, `SELECT * FROM post where poster_id = ? `, tok.UserId)
+	q, err = query.Parse(ctx, postSpec)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	posts, err = query.List[Post](s.DB, q, "post", "post.poster_id = ?", tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
 		})
 		return
 	}
@@ -221,11 +258,57 @@ func GetUserPosts(ctx *gin.Context) {
 
 */
 
-func GetPost(postId int) (post Post, err error) {
-	err = database.Get(&post, `SELECT * FROM post where id = ? `, postId)
+func (s *Service) GetPost(postId int) (post Post, err error) {
+	err = s.DB.Get(&post, `SELECT * FROM post WHERE id = ? AND `+database.NotDeleted("post"), postId)
 	if err != nil {
 		return post, err
 	}
 
 	return post, nil
 }
+
+// PublishPost inserts the post, its author and the event notifying the followers of the author.
+func (s *Service) PublishPost(ctx context.Context, post Post, posterId uint) (postId uint, err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		postId, err = database.InsertOneTx(tx, post)
+		if err != nil {
+			return err
+		}
+
+		_, err = database.InsertOneTx(tx, UserPost{PostId: postId, UserId: posterId})
+		if err != nil {
+			return err
+		}
+
+		err = s.Outbox.Enqueue(tx, outbox.EventPostPublished, outbox.PostPublished{PostId: postId, PosterId: posterId})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return postId, err
+}
+
+// notifyFollowers is the outbox handler telling the followers of the poster about a new post.
+func (s *Service) notifyFollowers(event outbox.OutboxEvent) (err error) {
+	var published outbox.PostPublished
+
+	err = event.Decode(&published)
+	if err != nil {
+		return err
+	}
+
+	followerIds, err := s.GetFollowerIds(published.PosterId)
+	if err != nil {
+		return err
+	}
+
+	poster, err := s.users.GetUserWithId(published.PosterId)
+	if err != nil {
+		return err
+	}
+
+	return s.notifications.NotifyMany(event.Id, followerIds, published.PosterId, notification.TypePostPublished, published.PostId,
+		poster.Name+" published a new post")
+}
@@ -1,18 +1,48 @@
 package authorization
 
 import (
+	"github.com/jmoiron/sqlx"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/utils/state"
 	"time"
 )
 
+// Service reads and grants the roles of the users.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the authorization service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
 const (
 	StudentAuthorizationLevel   = 0
 	ParentAuthorizationLevel    = 1
 	TutorAuthorizationLevel     = 2
 	ProfessorAuthorizationLevel = 3
+	AdminAuthorizationLevel     = 4
+)
+
+// Role names used to declare route access policies.
+const (
+	StudentRole   = "student"
+	ParentRole    = "parent"
+	TutorRole     = "tutor"
+	ProfessorRole = "professor"
+	AdminRole     = "admin"
 )
 
+var roleLevels = map[string]uint{
+	StudentRole:   StudentAuthorizationLevel,
+	ParentRole:    ParentAuthorizationLevel,
+	TutorRole:     TutorAuthorizationLevel,
+	ProfessorRole: ProfessorAuthorizationLevel,
+	AdminRole:     AdminAuthorizationLevel,
+}
+
 type Authorization struct {
 	Id        uint       `json:"id"`
 	CreatedAt time.Time  `json:"created_at"`
@@ -22,7 +52,7 @@ type Authorization struct {
 	Level     uint       `json:"level"`
 }
 
-func NewUserAuthorization(userId, authorizationLevel uint) (err error) {
+func (s *Service) NewUserAuthorization(userId, authorizationLevel uint) (err error) {
 	var (
 		auth Authorization
 	)
@@ -30,24 +60,33 @@ func NewUserAuthorization(userId, authorizationLevel uint) (err error) {
 	auth.UserId = userId
 	auth.Level = authorizationLevel
 
-	_, err = database.InsertOne(auth)
+	_, err = s.DB.InsertOne(auth)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func GetUserAuthorizations(userId uint) (auth []Authorization, err error) {
-	query := `SELECT a.* FROM authorization a WHERE a.user_id = ?`
-	err = database.Select(&auth, query, userId)
+// NewUserAuthorizationTx is NewUserAuthorization within tx.
+func NewUserAuthorizationTx(tx *sqlx.Tx, userId, authorizationLevel uint) (err error) {
+	_, err = database.InsertOneTx(tx, Authorization{UserId: userId, Level: authorizationLevel})
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+func (s *Service) GetUserAuthorizations(userId uint) (auth []Authorization, err error) {
+	query := `SELECT a.* FROM authorization a WHERE a.user_id = ? AND ` + database.NotDeleted("a") + ` ORDER BY a.id`
+	err = s.DB.Select(&auth, query, userId)
 	if err != nil {
 		return nil, err
 	}
 	return auth, err
 }
 
-func GetUserAuthorization(userId, level uint) (auth Authorization, err error) {
-	err = database.Get(&auth, `SELECT * FROM authorization WHERE user_id = ? AND level = ?`, userId, level)
+func (s *Service) GetUserAuthorization(userId, level uint) (auth Authorization, err error) {
+	err = s.DB.Get(&auth, `SELECT * FROM authorization WHERE user_id = ? AND level = ? AND `+database.NotDeleted("authorization"), userId, level)
 	if err != nil {
 		return auth, err
 	}
@@ -55,17 +94,17 @@ func GetUserAuthorization(userId, level uint) (auth Authorization, err error) {
 	return auth, err
 }
 
-func DeleteUserAuthorization(userId, level uint) (err error) {
+func (s *Service) DeleteUserAuthorization(userId, level uint) (err error) {
 	var (
 		auth Authorization
 	)
 
-	auth, err = GetUserAuthorization(userId, level)
+	auth, err = s.GetUserAuthorization(userId, level)
 	if err != nil {
 		return err
 	}
 
-	err = database.Delete(auth)
+	err = s.DB.HardDelete(auth)
 	if err != nil {
 		return err
 	}
@@ -73,21 +112,21 @@ func DeleteUserAuthorization(userId, level uint) (err error) {
 	return err
 }
 
-func DeleteUserAuthorizations(userId uint) (err error) {
-	err = database.Exec(`DELETE FROM authorization WHERE user_id = ?`, userId)
+func (s *Service) DeleteUserAuthorizations(userId uint) (err error) {
+	err = s.DB.Exec(`DELETE FROM authorization WHERE user_id = ?`, userId)
 	if err != nil {
 		return err
 	}
 	return err
 }
 
-func isUserHasAuthorizationLevel(userId, authorizationLevel uint) (ret bool) {
+func (s *Service) isUserHasAuthorizationLevel(userId, authorizationLevel uint) (ret bool) {
 	var (
 		err  error
 		auth Authorization
 	)
 
-	auth, err = GetUserAuthorization(userId, authorizationLevel)
+	auth, err = s.GetUserAuthorization(userId, authorizationLevel)
 	if err != nil {
 		return false
 	}
@@ -95,18 +134,45 @@ func isUserHasAuthorizationLevel(userId, authorizationLevel uint) (ret bool) {
 	return auth.Id > state.ZERO
 }
 
-func IsUserStudent(userId uint) (ret bool) {
-	return isUserHasAuthorizationLevel(userId, StudentAuthorizationLevel)
+func (s *Service) IsUserStudent(userId uint) (ret bool) {
+	return s.isUserHasAuthorizationLevel(userId, StudentAuthorizationLevel)
+}
+
+func (s *Service) IsUserParent(userId uint) (ret bool) {
+	return s.isUserHasAuthorizationLevel(userId, ParentAuthorizationLevel)
+}
+
+func (s *Service) IsUserTutor(userId uint) (ret bool) {
+	return s.isUserHasAuthorizationLevel(userId, TutorAuthorizationLevel)
 }
 
-func IsUserParent(userId uint) (ret bool) {
-	return isUserHasAuthorizationLevel(userId, ParentAuthorizationLevel)
+func (s *Service) IsUserProfessor(userId uint) (ret bool) {
+	return s.isUserHasAuthorizationLevel(userId, ProfessorAuthorizationLevel)
 }
 
-func IsUserTutor(userId uint) (ret bool) {
-	return isUserHasAuthorizationLevel(userId, TutorAuthorizationLevel)
+func (s *Service) IsUserAdmin(userId uint) (ret bool) {
+	return s.isUserHasAuthorizationLevel(userId, AdminAuthorizationLevel)
 }
 
-func IsUserProfessor(userId uint) (ret bool) {
-	return isUserHasAuthorizationLevel(userId, ProfessorAuthorizationLevel)
+// IsSelfAssignableLevel reports whether a user may pick the authorization level on registration.
+// The admin level can only be granted by another admin.
+func IsSelfAssignableLevel(level uint) bool {
+	return level <= ProfessorAuthorizationLevel
+}
+
+func RoleLevel(role string) (level uint, ok bool) {
+	level, ok = roleLevels[role]
+	return level, ok
+}
+
+// IsLevelInRoles reports whether the authorization level matches one of the given roles.
+func IsLevelInRoles(level uint, roles []string) (ret bool) {
+	for i := 0; i < len(roles); i++ {
+		roleLevel, ok := RoleLevel(roles[i])
+		if ok && roleLevel == level {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,123 @@
+package user
+
+import (
+	"net/http"
+	"peec/database"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var deletedUserSpec = query.Spec{
+	Table:       "user",
+	Sorts:       []string{"created_at", "deleted_at", "email"},
+	Filters:     []string{"email", "status"},
+	DefaultSort: "-deleted_at",
+	Deleted:     true,
+}
+
+/*
+
+	ROUTES
+
+*/
+
+// DeleteUser soft deletes a user and revokes its sessions. The account can be restored with RestoreUser.
+func (s *Service) DeleteUser(ctx *gin.Context) {
+	userId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	user, err := s.GetUserWithId(uint(userId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownUserError,
+		})
+		return
+	}
+
+	err = s.DB.Delete(user)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbDeleteError,
+		})
+		return
+	}
+
+	err = s.auth.RevokeUserSessions(user.Id, state.EMPTY)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+// GetDeletedUsers lists the soft deleted users, last deleted first.
+func (s *Service) GetDeletedUsers(ctx *gin.Context) {
+	var (
+		err   error
+		q     query.Query
+		users query.Page[User]
+	)
+
+	q, err = query.Parse(ctx, deletedUserSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	users, err = query.List[User](s.DB, q, "user", "")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, users)
+}
+
+// RestoreUser brings a soft deleted user back. Its sessions stay revoked: the user logs in again.
+func (s *Service) RestoreUser(ctx *gin.Context) {
+	var user User
+
+	userId, err := strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = s.DB.Get(&user, `SELECT * FROM user WHERE id = ? AND `+database.DeletedClause, userId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownDeletedUserError,
+		})
+		return
+	}
+
+	err = s.DB.Restore(user)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	user.DeletedAt = nil
+	ctx.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,456 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"peec/database"
+	"peec/internal/app"
+	"peec/internal/authentication"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Service records the login failures and locks the accounts and addresses they come from.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the lockout service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
+const (
+	ActionLock   = "lock"
+	ActionUnlock = "unlock"
+)
+
+const (
+	failuresReason = "too many failed login attempts"
+	unlockReason   = "unlocked by an administrator"
+)
+
+var (
+	ErrLocked  = errors.New("login temporarily locked")
+	ErrTooSoon = errors.New("login attempted too soon after a failure")
+)
+
+// LoginAttempt records every login attempt. Failures are cleared by a successful login or an unlock.
+type LoginAttempt struct {
+	Id        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	UserId    uint       `json:"user_id"`
+	Ip        string     `json:"ip"`
+	IsSuccess bool       `json:"is_success"`
+	IsCleared bool       `json:"is_cleared"`
+}
+
+// Lockout blocks logins of an account, or of an ip address when UserId is zero, until LockedUntil.
+type Lockout struct {
+	Id          uint       `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+	UserId      uint       `json:"user_id"`
+	Ip          string     `json:"ip"`
+	LockedUntil time.Time  `json:"locked_until"`
+	Reason      string     `json:"reason"`
+}
+
+// LockoutEvent is the audit trail of every lock and unlock.
+type LockoutEvent struct {
+	Id        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	UserId    uint       `json:"user_id"`
+	Ip        string     `json:"ip"`
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason"`
+	ActorId   uint       `json:"actor_id"`
+}
+
+// UnlockRequest optionally names an ip address whose lock is lifted along with the account.
+type UnlockRequest struct {
+	Reason string `json:"reason"`
+	Ip     string `json:"ip"`
+}
+
+var lockoutEventSpec = query.Spec{
+	Table:       "lockout_event",
+	Sorts:       []string{"created_at"},
+	Filters:     []string{"user_id", "ip", "action", "actor_id"},
+	DefaultSort: "-created_at",
+}
+
+type failureStat struct {
+	Failures int
+	Elapsed  int
+}
+
+const userFailureStatQuery = `SELECT COUNT(*) AS failures, COALESCE(TIMESTAMPDIFF(SECOND, MAX(created_at), NOW()), 0) AS elapsed
+		FROM login_attempt
+		WHERE user_id = ? AND is_success = false AND is_cleared = false AND created_at > NOW() - INTERVAL ? MINUTE`
+
+/*
+
+	ROUTES
+
+*/
+
+func (s *Service) UnlockUser(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		err     error
+		userId  int
+		request UnlockRequest
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	userId, err = strconv.Atoi(ctx.Param("user_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	// The reason is optional.
+	_ = ctx.ShouldBindJSON(&request)
+	if request.Reason == state.EMPTY {
+		request.Reason = unlockReason
+	}
+
+	err = s.Unlock(uint(userId), request.Ip, request.Reason, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+// UnlockIp lifts the lock of an ip address, such as one locked by attempts on emails matching no account.
+func (s *Service) UnlockIp(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		err     error
+		request UnlockRequest
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil || request.Ip == state.EMPTY {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	if request.Reason == state.EMPTY {
+		request.Reason = unlockReason
+	}
+
+	err = s.Unlock(state.ZERO, request.Ip, request.Reason, tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+// GetLockoutEvents lists the locks and unlocks, most recent first. See query.Query for the parameters.
+func (s *Service) GetLockoutEvents(ctx *gin.Context) {
+	var (
+		err    error
+		q      query.Query
+		events query.Page[LockoutEvent]
+	)
+
+	q, err = query.Parse(ctx, lockoutEventSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	events, err = query.List[LockoutEvent](s.DB, q, "lockout_event", "")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, events)
+}
+
+/*
+
+	UTILS
+
+*/
+
+// ReserveAttempt tells whether a login may be attempted for the account from the ip address and, if so, reserves
+// it: the attempt is stored as a failure before any password hash is computed, so concurrent attempts see each
+// other. The account row is locked meanwhile, which queues the attempts of an account one behind the other.
+// RecordSuccess or Release settle the attempt once its outcome is known, RecordFailure leaves it a failure.
+//
+// userId is zero when the email matches no account. On ErrLocked or ErrTooSoon, nothing is reserved and wait is
+// the time left before the next attempt.
+func (s *Service) ReserveAttempt(ctx context.Context, userId uint, ip string) (attemptId uint, wait time.Duration, err error) {
+	var (
+		remaining  sql.NullInt64
+		stat       failureStat
+		ipFailures int
+		protection = s.Config.Login()
+	)
+
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		// The locking read comes first, so that the reads below see what the previous attempt committed.
+		if userId > state.ZERO {
+			var id uint
+			err = database.GetTx(tx, &id, `SELECT id FROM user WHERE id = ? FOR UPDATE`, userId)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = database.GetTx(tx, &remaining, `SELECT TIMESTAMPDIFF(SECOND, UTC_TIMESTAMP(), MAX(locked_until)) FROM lockout
+				WHERE ((user_id = 0 AND ip = ?) OR (user_id = ? AND user_id <> 0)) AND locked_until > UTC_TIMESTAMP()`, ip, userId)
+		if err != nil {
+			return err
+		}
+
+		if remaining.Valid {
+			wait = time.Duration(remaining.Int64+1) * time.Second
+			return ErrLocked
+		}
+
+		if userId > state.ZERO {
+			err = database.GetTx(tx, &stat, userFailureStatQuery, userId, protection.FailureWindow)
+			if err != nil {
+				return err
+			}
+
+			delay := throttleDelay(stat.Failures, protection.MaxDelay)
+			if stat.Elapsed < delay {
+				wait = time.Duration(delay-stat.Elapsed) * time.Second
+				return ErrTooSoon
+			}
+		}
+
+		// Failures of the address made after its last lock: past the limit, the attempts in flight are about to lock
+		// it again.
+		err = database.GetTx(tx, &ipFailures, `SELECT COUNT(*) FROM login_attempt
+				WHERE ip = ? AND is_success = false AND is_cleared = false AND created_at > NOW() - INTERVAL ? MINUTE
+					AND created_at >= (SELECT COALESCE(MAX(created_at), '1000-01-01') FROM lockout WHERE user_id = 0 AND ip = ?)`,
+			ip, protection.FailureWindow, ip)
+		if err != nil {
+			return err
+		}
+
+		if ipFailures >= protection.MaxIpFailures {
+			wait = time.Second
+			return ErrTooSoon
+		}
+
+		attemptId, err = database.InsertOneTx(tx, LoginAttempt{UserId: userId, Ip: ip})
+		return err
+	})
+	if err != nil {
+		return 0, wait, err
+	}
+
+	return attemptId, 0, nil
+}
+
+// RecordFailure locks the account or the ip address of a failed attempt once it went over its limit. The attempt
+// itself was stored by ReserveAttempt.
+func (s *Service) RecordFailure(userId uint, ip string) (err error) {
+	var (
+		stat       failureStat
+		ipFailures int
+		protection = s.Config.Login()
+	)
+
+	if userId > state.ZERO {
+		stat, err = s.getUserFailureStat(userId)
+		if err != nil {
+			return err
+		}
+
+		if stat.Failures >= protection.MaxAccountFailures {
+			err = s.Lock(userId, ip, failuresReason, state.ZERO)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = s.DB.Get(&ipFailures, `SELECT COUNT(*) FROM login_attempt
+			WHERE ip = ? AND is_success = false AND is_cleared = false AND created_at > NOW() - INTERVAL ? MINUTE`,
+		ip, protection.FailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if ipFailures >= protection.MaxIpFailures {
+		return s.Lock(state.ZERO, ip, failuresReason, state.ZERO)
+	}
+
+	return err
+}
+
+// RecordSuccess marks the attempt reserved by ReserveAttempt as a success and clears the failures of the account.
+func (s *Service) RecordSuccess(attemptId, userId uint) (err error) {
+	err = s.DB.Exec(`UPDATE login_attempt SET is_success = true, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, attemptId)
+	if err != nil {
+		return err
+	}
+
+	return s.clearFailures(userId)
+}
+
+// Release drops an attempt reserved by ReserveAttempt which was neither a failure nor a success yet, such as a
+// correct password waiting for its second factor.
+func (s *Service) Release(attemptId uint) (err error) {
+	return s.DB.HardDelete(LoginAttempt{Id: attemptId})
+}
+
+// Lock blocks the account, or the ip address when userId is zero, for the configured duration.
+func (s *Service) Lock(userId uint, ip, reason string, actorId uint) (err error) {
+	var lock Lockout
+
+	lock.UserId = userId
+	lock.Ip = ip
+	lock.Reason = reason
+	lock.LockedUntil = time.Now().UTC().Add(time.Duration(s.Config.Login().LockDuration) * time.Minute)
+
+	_, err = s.DB.InsertOne(lock)
+	if err != nil {
+		return err
+	}
+
+	return s.recordEvent(userId, ip, ActionLock, reason, actorId)
+}
+
+// Unlock lifts every active lock of the account and forgets its failed attempts. When ip is set, the lock of the ip
+// address is lifted and its failed attempts forgotten as well; userId is zero to only unlock the address. Each lock
+// lifted is recorded with the address it was set for.
+func (s *Service) Unlock(userId uint, ip, reason string, actorId uint) (err error) {
+	var locks []Lockout
+
+	condition := `((user_id = ? AND user_id <> 0) OR (user_id = 0 AND ip = ? AND ip <> '')) AND locked_until > UTC_TIMESTAMP()`
+
+	err = s.DB.Select(&locks, `SELECT * FROM lockout WHERE `+condition, userId, ip)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Exec(`UPDATE lockout SET locked_until = UTC_TIMESTAMP(), updated_at = CURRENT_TIMESTAMP WHERE `+condition, userId, ip)
+	if err != nil {
+		return err
+	}
+
+	if userId > state.ZERO {
+		err = s.clearFailures(userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ip != state.EMPTY {
+		err = s.DB.Exec(`UPDATE login_attempt SET is_cleared = true WHERE ip = ? AND is_cleared = false`, ip)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(locks) == state.ZERO {
+		return s.recordEvent(userId, ip, ActionUnlock, reason, actorId)
+	}
+
+	for _, lock := range locks {
+		err = s.recordEvent(lock.UserId, lock.Ip, ActionUnlock, reason, actorId)
+		if err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// throttleDelay returns the seconds to wait after the last of failures: 1s, 2s, 4s... up to maxDelay.
+func throttleDelay(failures, maxDelay int) int {
+	if failures <= state.ZERO {
+		return 0
+	}
+
+	if failures <= 16 && 1<<(failures-1) < maxDelay {
+		return 1 << (failures - 1)
+	}
+	return maxDelay
+}
+
+func (s *Service) getUserFailureStat(userId uint) (stat failureStat, err error) {
+	err = s.DB.Get(&stat, userFailureStatQuery, userId, s.Config.Login().FailureWindow)
+	if err != nil {
+		return stat, err
+	}
+	return stat, err
+}
+
+func (s *Service) clearFailures(userId uint) (err error) {
+	err = s.DB.Exec(`UPDATE login_attempt SET is_cleared = true WHERE user_id = ? AND is_cleared = false`, userId)
+	if err != nil {
+		return err
+	}
+	return err
+}
+
+func (s *Service) recordEvent(userId uint, ip, action, reason string, actorId uint) (err error) {
+	var event LockoutEvent
+
+	event.UserId = userId
+	event.Ip = ip
+	event.Action = action
+	event.Reason = reason
+	event.ActorId = actorId
+
+	_, err = s.DB.InsertOne(event)
+	if err != nil {
+		return err
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+package lockout
+
+import "testing"
+
+func TestThrottleDelay(t *testing.T) {
+	for failures, want := range map[int]int{0: 0, 1: 1, 2: 2, 3: 4, 4: 8, 5: 16, 6: 30, 17: 30, 64: 30} {
+		if got := throttleDelay(failures, 30); got != want {
+			t.Errorf("throttleDelay(%d, 30) = %d, want %d", failures, got, want)
+		}
+	}
+
+	if got := throttleDelay(3, 2); got != 2 {
+		t.Errorf("throttleDelay(3, 2) = %d, want the maximum 2", got)
+	}
+}
@@ -3,12 +3,23 @@ package password
 import (
 	"errors"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/utils"
 	"peec/internal/utils/state"
-	"strings"
 	"time"
 )
 
+// Service stores the password history and checks new passwords against the policy.
+type Service struct {
+	*app.App
+	blocklist map[string]bool
+}
+
+// NewService returns the password service, loading the blocklist of common passwords.
+func NewService(a *app.App) *Service {
+	return &Service{App: a, blocklist: loadBlocklist(a.Config.Password().BlocklistFile)}
+}
+
 type Password struct {
 	Id          uint       `json:"id"`
 	CreatedAt   time.Time  `json:"created_at"`
@@ -19,17 +30,23 @@ type Password struct {
 	ContentHash string     `json:"hash"`
 }
 
-func CreatePassword(userId uint, password Password) (err error) {
-	if strings.TrimSpace(password.Psw) == state.EMPTY {
-		return errors.New("password should not be empty")
-	}
+// PasswordChange is a password of the history, without its hashes.
+type PasswordChange struct {
+	Id        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserId    uint      `json:"user_id"`
+}
 
+// CreatePassword stores a new password for the user. A *PolicyError is returned when the password breaks the policy.
+func (s *Service) CreatePassword(userId uint, password Password) (err error) {
 	if userId == state.ZERO {
 		return errors.New("user id should not be empty")
 	}
 
-	if utils.PasswordHasValidLength(password.Psw) {
-		return errors.New("maximum value of password is 18")
+	err = s.CheckPolicy(userId, password.Psw)
+	if err != nil {
+		return err
 	}
 
 	password.ContentHash, err = utils.CreateContentHash(password.Psw)
@@ -43,7 +60,7 @@ func CreatePassword(userId uint, password Password) (err error) {
 	}
 
 	password.UserId = userId
-	_, err = database.Insert(password)
+	_, err = s.DB.Insert(password)
 	if err != nil {
 		return errors.New("something went wring while creating new password record on db")
 	}
@@ -51,15 +68,12 @@ func CreatePassword(userId uint, password Password) (err error) {
 	return err
 }
 
-func GetUserPasswordHash(userId uint) (hash string, err error) {
-	return hash, err
-}
-
-func IsPasswordValid(userId uint, passwordNaked string) bool {
+func (s *Service) IsPasswordValid(userId uint, passwordNaked string) bool {
 	var password Password
 	var err error
 
-	err = database.Get(&password, `SELECT * FROM password WHERE user_id = ? ORDER BY created_at DESC LIMIT 1`, userId)
+	err = s.DB.Get(&password, `SELECT * FROM password WHERE user_id = ? AND `+database.NotDeleted("password")+`
+			ORDER BY created_at DESC, id DESC LIMIT 1`, userId)
 	if err != nil {
 		return false
 	}
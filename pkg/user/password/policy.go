@@ -0,0 +1,176 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"os"
+	"peec/database"
+	"peec/internal/utils"
+	"strings"
+	"unicode"
+)
+
+const (
+	RuleEmpty            = "empty"
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RuleCommonPassword   = "common_password"
+	RuleRecentlyUsed     = "recently_used"
+)
+
+//go:embed blocklist.txt
+var defaultBlocklist string
+
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule of the password policy the password breaks.
+type PolicyError struct {
+	Violations []PolicyViolation `json:"violations"`
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for i := 0; i < len(e.Violations); i++ {
+		messages = append(messages, e.Violations[i].Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// ErrorMessage returns the violations when err is a *PolicyError and the error text otherwise,
+// ready to be used as an ErrorResponse message.
+func ErrorMessage(err error) any {
+	var policyErr *PolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr
+	}
+	return err.Error()
+}
+
+func (e *PolicyError) add(rule, message string) {
+	e.Violations = append(e.Violations, PolicyViolation{Rule: rule, Message: message})
+}
+
+// CheckPolicy validates the password against the configured policy and the last passwords of the user.
+// It returns a *PolicyError when at least one rule is broken, and the database error when the last passwords cannot
+// be read: the password is rejected rather than checked against nothing.
+func (s *Service) CheckPolicy(userId uint, psw string) (err error) {
+	var (
+		policy    = s.Config.Password()
+		policyErr PolicyError
+	)
+
+	if strings.TrimSpace(psw) == "" {
+		policyErr.add(RuleEmpty, "password should not be empty")
+		return &policyErr
+	}
+
+	if len([]rune(psw)) < policy.MinLength {
+		policyErr.add(RuleMinLength, "password is too short")
+	}
+
+	if len(psw) > policy.MaxLength || !utils.PasswordHasValidLength(psw) {
+		policyErr.add(RuleMaxLength, "password is too long")
+	}
+
+	if countCharacterClasses(psw) < policy.MinCharacterClasses {
+		policyErr.add(RuleCharacterClasses, "password must mix lower case, upper case, digits and symbols")
+	}
+
+	if s.isCommonPassword(psw) {
+		policyErr.add(RuleCommonPassword, "password is too common")
+	}
+
+	if len(policyErr.Violations) == 0 {
+		used, err := s.isRecentlyUsed(userId, psw, policy.HistorySize)
+		if err != nil {
+			return err
+		}
+		if used {
+			policyErr.add(RuleRecentlyUsed, "password has been used recently")
+		}
+	}
+
+	if len(policyErr.Violations) > 0 {
+		return &policyErr
+	}
+
+	return nil
+}
+
+func countCharacterClasses(psw string) (count int) {
+	var lower, upper, digit, symbol bool
+	for _, char := range psw {
+		switch {
+		case unicode.IsLower(char):
+			lower = true
+		case unicode.IsUpper(char):
+			upper = true
+		case unicode.IsDigit(char):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Service) isCommonPassword(psw string) bool {
+	return s.blocklist[strings.ToLower(psw)]
+}
+
+// loadBlocklist reads the embedded blocklist along with file, when set and readable.
+func loadBlocklist(file string) (blocklist map[string]bool) {
+	blocklist = make(map[string]bool)
+	addToBlocklist(blocklist, bufio.NewScanner(strings.NewReader(defaultBlocklist)))
+
+	if file == "" {
+		return blocklist
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return blocklist
+	}
+	defer f.Close()
+
+	addToBlocklist(blocklist, bufio.NewScanner(f))
+	return blocklist
+}
+
+func addToBlocklist(blocklist map[string]bool, scanner *bufio.Scanner) {
+	for scanner.Scan() {
+		entry := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if entry != "" {
+			blocklist[entry] = true
+		}
+	}
+}
+
+// isRecentlyUsed compares the password with the hashes of the last historySize passwords of the user.
+func (s *Service) isRecentlyUsed(userId uint, psw string, historySize int) (used bool, err error) {
+	var passwords []Password
+
+	err = s.DB.Select(&passwords, `SELECT * FROM password WHERE user_id = ? AND `+database.NotDeleted("password")+`
+			ORDER BY created_at DESC, id DESC LIMIT ?`, userId, historySize)
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; i < len(passwords); i++ {
+		if utils.CheckPasswordHash(psw, passwords[i].Psw) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,73 @@
+package password
+
+import (
+	"errors"
+	"peec/database"
+	"peec/internal/app"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// newTestService returns a password service with the default policy, over a database which cannot be reached.
+func newTestService(t *testing.T) *Service {
+	client, err := sqlx.Open("mysql", "peec@tcp(127.0.0.1:1)/peec?timeout=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return &Service{App: &app.App{DB: &database.DB{Client: client}}, blocklist: loadBlocklist("")}
+}
+
+func violatedRules(err error) (rules []string) {
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+
+	for _, violation := range policyErr.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestCheckPolicyViolations(t *testing.T) {
+	s := newTestService(t)
+
+	for psw, want := range map[string][]string{
+		"   ":                            {RuleEmpty},
+		"Ab1!":                           {RuleMinLength},
+		"abcdefghij":                     {RuleCharacterClasses},
+		"Password1":                      {RuleCommonPassword},
+		"Aa1!" + strings.Repeat("a", 80): {RuleMaxLength},
+		"abc":                            {RuleMinLength, RuleCharacterClasses},
+	} {
+		rules := violatedRules(s.CheckPolicy(1, psw))
+		if !slices.Equal(rules, want) {
+			t.Errorf("CheckPolicy(%q) broke %v, want %v", psw, rules, want)
+		}
+	}
+}
+
+func TestCheckPolicyRejectsWhenTheHistoryCannotBeRead(t *testing.T) {
+	s := newTestService(t)
+
+	err := s.CheckPolicy(1, "Tr0ub4dor&3-horse")
+	if err == nil {
+		t.Fatal("CheckPolicy accepted a password it could not compare with the history")
+	}
+	if rules := violatedRules(err); rules != nil {
+		t.Errorf("CheckPolicy broke %v, want the database error", rules)
+	}
+}
+
+func TestCountCharacterClasses(t *testing.T) {
+	for psw, want := range map[string]int{"": 0, "abc": 1, "abcDEF": 2, "abcDEF123": 3, "aB3$": 4, "éÉ9": 3} {
+		if got := countCharacterClasses(psw); got != want {
+			t.Errorf("countCharacterClasses(%q) = %d, want %d", psw, got, want)
+		}
+	}
+}
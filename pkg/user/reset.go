@@ -0,0 +1,200 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"peec/internal/mailer"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"peec/pkg/code"
+	"peec/pkg/user/lockout"
+	"peec/pkg/user/password"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmation struct {
+	Email string `json:"email"`
+	Code  int    `json:"code"`
+	Psw   string `json:"psw"`
+}
+
+/*
+
+	ROUTES
+
+*/
+
+// RequestPasswordReset issues a password reset code for the account. The response does not tell
+// whether the email belongs to an account, nor whether the account or the ip address ran out of codes: past
+// max_reset_codes or max_ip_reset_codes over the failure window, no code is issued.
+func (s *Service) RequestPasswordReset(ctx *gin.Context) {
+	var (
+		err       error
+		request   PasswordResetRequest
+		usr       User
+		resetCode code.Code
+	)
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	usr, err = s.GetUserByEmail(request.Email)
+	if err != nil {
+		ctx.Status(http.StatusOK)
+		return
+	}
+
+	protection := s.Config.Login()
+	forUser, forIp, err := s.codes.CountPasswordResetCodes(usr.Id, ctx.ClientIP(), protection.FailureWindow)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	if forUser >= protection.MaxResetCodes || forIp >= protection.MaxIpResetCodes {
+		ctx.Status(http.StatusOK)
+		return
+	}
+
+	resetCode, err = s.codes.NewPasswordResetCode(usr.Id, ctx.ClientIP())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	err = mailer.SendTemplate(s.Mailer, usr.Email, mailer.TemplatePasswordReset, mailer.PasswordResetData{
+		Name:      usr.Name,
+		Code:      resetCode.String(),
+		ExpiresIn: s.Config.PasswordResetCodeLifeTime(),
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.SendMailError,
+		})
+		return
+	}
+
+	if s.Config.IsDev() {
+		ctx.JSON(http.StatusOK, gin.H{
+			"code": resetCode.String(),
+		})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+// ConfirmPasswordReset sets a new password once the reset code is checked and logs the user out of every device.
+// Wrong codes count as failed logins, so they are throttled and lock the account and the ip address alike.
+func (s *Service) ConfirmPasswordReset(ctx *gin.Context) {
+	var (
+		err          error
+		confirmation PasswordResetConfirmation
+		usr          User
+	)
+
+	err = ctx.ShouldBindJSON(&confirmation)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	usr, err = s.GetUserByEmail(confirmation.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	attemptId, wait, err := s.lockouts.ReserveAttempt(ctx.Request.Context(), usr.Id, ctx.ClientIP())
+	if errors.Is(err, lockout.ErrLocked) || errors.Is(err, lockout.ErrTooSoon) {
+		ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, utils.ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	if usr.Id == state.ZERO {
+		err = s.lockouts.RecordFailure(state.ZERO, ctx.ClientIP())
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbInsertError,
+			})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidPasswordResetError,
+		})
+		return
+	}
+
+	err = s.codes.ConsumePasswordResetCode(usr.Id, confirmation.Code)
+	if err != nil {
+		err = s.lockouts.RecordFailure(usr.Id, ctx.ClientIP())
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbInsertError,
+			})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidPasswordResetError,
+		})
+		return
+	}
+
+	err = s.lockouts.RecordSuccess(attemptId, usr.Id)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	err = s.passwords.CreatePassword(usr.Id, password.Password{Psw: confirmation.Psw})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: password.ErrorMessage(err),
+		})
+		return
+	}
+
+	err = s.auth.RevokeUserSessions(usr.Id, "")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
@@ -0,0 +1,417 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"net/http"
+	"peec/database"
+	"peec/internal/app"
+	"peec/internal/authentication"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"strings"
+	"time"
+)
+
+// Service enrolls the users in two factor authentication and checks their second factor.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the two factor service.
+func NewService(a *app.App) *Service {
+	return &Service{App: a}
+}
+
+const recoveryCodeCount = 10
+
+// TwoFactor holds the TOTP secret of a user. It is only enforced on login once IsEnabled is set,
+// which requires a first valid code.
+type TwoFactor struct {
+	Id           uint       `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at"`
+	UserId       uint       `json:"user_id"`
+	Secret       string     `json:"-"`
+	IsEnabled    bool       `json:"is_enabled"`
+	LastUsedStep int64      `json:"-"`
+}
+
+// RecoveryCode is a single use code replacing a TOTP code when the device is lost. Only its hash is stored.
+type RecoveryCode struct {
+	Id        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	UserId    uint       `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	IsUsed    bool       `json:"is_used"`
+}
+
+type CodeRequest struct {
+	Code string `json:"code"`
+}
+
+/*
+
+	ROUTES
+
+*/
+
+// Enroll generates a new TOTP secret for the user. Two factor authentication stays disabled until
+// the secret is confirmed with Activate.
+func (s *Service) Enroll(ctx *gin.Context) {
+	var (
+		tok       *authentication.Token
+		err       error
+		twoFactor TwoFactor
+		email     string
+		qrImage   string
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	twoFactor, err = s.GetUserTwoFactor(tok.UserId)
+	if err == nil && twoFactor.IsEnabled {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.TwoFactorAlreadyEnabledError,
+		})
+		return
+	}
+
+	err = s.DB.Get(&email, `SELECT email FROM user WHERE id = ? AND `+database.NotDeleted("user"), tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	twoFactor.UserId = tok.UserId
+	twoFactor.Secret, err = newSecret()
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	if twoFactor.Id > 0 {
+		err = s.DB.Update(twoFactor)
+	} else {
+		twoFactor.Id, err = s.DB.InsertOne(twoFactor)
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	link := provisioningUrl(twoFactor.Secret, email)
+
+	qrImage, err = utils.QrCodeDataUri(link)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"secret":      twoFactor.Secret,
+		"otpauth_url": link,
+		"qr_code":     qrImage,
+	})
+}
+
+// Activate enables two factor authentication once the user proved the secret is registered on the device.
+// The recovery codes are returned only once.
+func (s *Service) Activate(ctx *gin.Context) {
+	var (
+		tok           *authentication.Token
+		err           error
+		request       CodeRequest
+		twoFactor     TwoFactor
+		recoveryCodes []string
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	twoFactor, err = s.GetUserTwoFactor(tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.TwoFactorNotEnrolledError,
+		})
+		return
+	}
+
+	err = s.consumeTotp(&twoFactor, request.Code)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidTwoFactorCodeError,
+		})
+		return
+	}
+
+	twoFactor.IsEnabled = true
+	err = s.DB.WithTx(ctx.Request.Context(), func(tx *sqlx.Tx) error {
+		err = database.UpdateTx(tx, twoFactor)
+		if err != nil {
+			return err
+		}
+
+		recoveryCodes, err = newRecoveryCodes(tx, tok.UserId)
+		return err
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user.
+func (s *Service) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var (
+		tok           *authentication.Token
+		err           error
+		request       CodeRequest
+		recoveryCodes []string
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	err = s.Verify(tok.UserId, request.Code)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidTwoFactorCodeError,
+		})
+		return
+	}
+
+	recoveryCodes, err = s.NewRecoveryCodes(ctx.Request.Context(), tok.UserId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// Disable turns two factor authentication off. A valid code is required.
+func (s *Service) Disable(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		err     error
+		request CodeRequest
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	err = s.Verify(tok.UserId, request.Code)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidTwoFactorCodeError,
+		})
+		return
+	}
+
+	err = s.DB.WithTx(ctx.Request.Context(), func(tx *sqlx.Tx) error {
+		err = database.ExecTx(tx, `DELETE FROM two_factor WHERE user_id = ?`, tok.UserId)
+		if err != nil {
+			return err
+		}
+
+		return database.ExecTx(tx, `DELETE FROM recovery_code WHERE user_id = ?`, tok.UserId)
+	})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbDeleteError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+
+	UTILS
+
+*/
+
+func (s *Service) GetUserTwoFactor(userId uint) (twoFactor TwoFactor, err error) {
+	err = s.DB.Get(&twoFactor, `SELECT * FROM two_factor WHERE user_id = ? AND `+database.NotDeleted("two_factor"), userId)
+	if err != nil {
+		return twoFactor, err
+	}
+	return twoFactor, err
+}
+
+func (s *Service) IsEnabled(userId uint) bool {
+	twoFactor, err := s.GetUserTwoFactor(userId)
+	if err != nil {
+		return false
+	}
+	return twoFactor.IsEnabled
+}
+
+// Verify accepts either a TOTP code or an unused recovery code of a user with two factor authentication enabled.
+func (s *Service) Verify(userId uint, code string) (err error) {
+	var twoFactor TwoFactor
+
+	twoFactor, err = s.GetUserTwoFactor(userId)
+	if err != nil || !twoFactor.IsEnabled {
+		return errors.New("two factor authentication is not enabled")
+	}
+
+	code = strings.TrimSpace(code)
+	if s.consumeTotp(&twoFactor, code) == nil {
+		return nil
+	}
+
+	return s.consumeRecoveryCode(userId, code)
+}
+
+// NewRecoveryCodes replaces the recovery codes of the user and returns the new ones in clear.
+func (s *Service) NewRecoveryCodes(ctx context.Context, userId uint) (codes []string, err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		codes, err = newRecoveryCodes(tx, userId)
+		return err
+	})
+	return codes, err
+}
+
+func newRecoveryCodes(tx *sqlx.Tx, userId uint) (codes []string, err error) {
+	err = database.ExecTx(tx, `DELETE FROM recovery_code WHERE user_id = ?`, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		_, err = rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(secretEncoding.EncodeToString(b))
+		code = code[:4] + "-" + code[4:]
+
+		_, err = database.InsertOneTx(tx, RecoveryCode{UserId: userId, CodeHash: authentication.HashToken(code)})
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, err
+}
+
+// consumeTotp checks the code and refuses a time step that was already used. The step is recorded by a conditional
+// update, so that two requests racing with the same code cannot both pass.
+func (s *Service) consumeTotp(twoFactor *TwoFactor, code string) (err error) {
+	step, ok := validateTotp(twoFactor.Secret, code, time.Now())
+	if !ok || step <= twoFactor.LastUsedStep {
+		return errors.New("invalid code")
+	}
+
+	result, err := s.DB.Client.Exec(`UPDATE two_factor SET last_used_step = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND last_used_step < ?`, step, twoFactor.UserId, step)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New("invalid code")
+	}
+
+	twoFactor.LastUsedStep = step
+	return nil
+}
+
+func (s *Service) consumeRecoveryCode(userId uint, code string) (err error) {
+	result, err := s.DB.Client.Exec(`UPDATE recovery_code SET is_used = true, updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND code_hash = ? AND is_used = false`, userId, authentication.HashToken(strings.ToLower(code)))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New("invalid code")
+	}
+	return nil
+}
@@ -1,23 +1,49 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net/http"
 	"peec/database"
+	"peec/internal/app"
 	"peec/internal/authentication"
+	"peec/internal/mailer"
+	"peec/internal/outbox"
+	"peec/internal/query"
 	"peec/internal/utils"
 	"peec/internal/utils/errx"
 	"peec/internal/utils/state"
 	"peec/pkg/code"
 	"peec/pkg/user/authorization"
+	"peec/pkg/user/lockout"
 	"peec/pkg/user/password"
+	"peec/pkg/user/twofactor"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 )
 
+// Service serves the accounts of the users.
+type Service struct {
+	*app.App
+	auth      *authentication.Service
+	codes     *code.Service
+	lockouts  *lockout.Service
+	passwords *password.Service
+	twoFactor *twofactor.Service
+}
+
+// NewService returns the user service, subscribing the verification email to the registration events.
+func NewService(a *app.App, auth *authentication.Service, codes *code.Service, lockouts *lockout.Service,
+	passwords *password.Service, twoFactor *twofactor.Service) *Service {
+	s := &Service{App: a, auth: auth, codes: codes, lockouts: lockouts, passwords: passwords, twoFactor: twoFactor}
+	s.Outbox.Subscribe("user.verification_email", outbox.EventUserRegistered, s.sendRegistrationVerification)
+	return s
+}
+
 // user status is used as follows:
 // a- first user create an account with an email required. ( at this point user is called new ) .
 // b- One created, a user received a verification code to validate his email ( user pass to status unverified )
@@ -55,13 +81,36 @@ type User struct {
 	ProfileImageXid string     `json:"profile_image_xid"`
 }
 
+var passwordHistorySpec = query.Spec{
+	Table:       "password",
+	Columns:     "password.id, password.created_at, password.updated_at, password.user_id",
+	Sorts:       []string{"created_at"},
+	DefaultSort: "-created_at",
+}
+
+// ProfileRequest holds what users may change on their own profile. The email, the status and the profile image go
+// through their own routes.
+type ProfileRequest struct {
+	Name       string    `json:"name"`
+	FamilyName string    `json:"family_name"`
+	NickName   string    `json:"nick_name"`
+	Age        uint      `json:"age"`
+	BirthDate  time.Time `json:"birth_date"`
+	Sex        int       `json:"sex"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
 /*
 
 	ROUTES
 
 */
 
-func Register(ctx *gin.Context) {
+func (s *Service) Register(ctx *gin.Context) {
 	var (
 		err                error
 		user               User
@@ -85,83 +134,10 @@ func Register(ctx *gin.Context) {
 		return
 	}
 
-	if !utils.IsValidEmail(user.Email) {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.InvalidEmailError,
-		})
-		return
-	}
-
-	_, err = GetUserByEmail(user.Email)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
-
-	if user.Id > state.ZERO {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
-			Message: errx.DuplicateUserError,
-		})
-		return
-	}
-
-	user.Matricule, err = utils.GenerateMatricule()
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
-
-	if user.Name == state.EMPTY {
-		user.Name = user.Matricule
-	}
-
-	if user.NickName == state.EMPTY {
-		user.NickName = user.Matricule
-	}
-
-	user.Id, err = database.InsertOne(user)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.DbInsertError,
-		})
-		return
-	}
-
-	err = authorization.NewUserAuthorization(user.Id, uint(authorizationLevel))
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
-
-	tokenStr, err := authentication.GetTokenString(user.Id)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
-
-	err = code.NewUserVerificationCode(user.Id)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
-	}
-
-	ctx.JSON(http.StatusOK, gin.H{
-		"token": tokenStr,
-	})
-	return
+	s.register(ctx, user, authorizationLevel)
 }
 
-func GetCode(ctx *gin.Context) {
+func (s *Service) GetCode(ctx *gin.Context) {
 	var (
 		err            error
 		tok            *authentication.Token
@@ -176,19 +152,28 @@ func GetCode(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Get(&validationCode, `SELECT * FROM code WHERE user_id = ? ORDER BY created_at desc LIMIT 1`, tok.UserId)
+	// Codes are only ever delivered by email outside development.
+	if !s.Config.IsDev() {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	validationCode, err = s.codes.GetPendingCode(tok.UserId, code.PurposeEmailVerification)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
+			Message: errx.InvalidVerificationError,
 		})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, validationCode)
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":       validationCode.String(),
+		"expires_at": validationCode.ExpiresAt,
+	})
 	return
 }
 
-func VerifyUserEmailValidationCode(ctx *gin.Context) {
+func (s *Service) VerifyUserEmailValidationCode(ctx *gin.Context) {
 	var (
 		err            error
 		tok            *authentication.Token
@@ -212,15 +197,15 @@ func VerifyUserEmailValidationCode(ctx *gin.Context) {
 		return
 	}
 
-	err = code.IsUserVerificationCodeValid(tok.UserId, validationCode)
+	err = s.codes.ConsumeUserVerificationCode(tok.UserId, validationCode)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
+			Message: errx.InvalidVerificationError,
 		})
 		return
 	}
 
-	user, err = GetUserWithId(tok.UserId)
+	user, err = s.GetUserWithId(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -232,7 +217,7 @@ func VerifyUserEmailValidationCode(ctx *gin.Context) {
 		user.Status = StatusNeedPassword
 	}
 
-	err = database.Update(user)
+	err = s.DB.Update(user)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -244,7 +229,7 @@ func VerifyUserEmailValidationCode(ctx *gin.Context) {
 	return
 }
 
-func SendUserEmailValidationCode(ctx *gin.Context) {
+func (s *Service) SendUserEmailValidationCode(ctx *gin.Context) {
 	var (
 		err  error
 		tok  *authentication.Token
@@ -259,37 +244,40 @@ func SendUserEmailValidationCode(ctx *gin.Context) {
 		return
 	}
 
-	err = code.NewUserVerificationCode(tok.UserId)
+	user, err = s.GetUserWithId(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
+			Message: errx.UnAuthorizedError,
 		})
 		return
 	}
 
-	user, err = GetUserWithId(tok.UserId)
+	err = s.SendVerificationCode(user)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.UnAuthorizedError,
+			Message: errx.SendMailError,
 		})
 		return
 	}
 
-	user.Status = StatusUnverified
+	// Sending the code again must not take a verified account back.
+	if user.Status < StatusUnverified {
+		user.Status = StatusUnverified
 
-	err = database.Update(user)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
-		})
-		return
+		err = s.DB.Update(user)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.Lambda(err),
+			})
+			return
+		}
 	}
 
 	ctx.Status(http.StatusOK)
 	return
 }
 
-func MyProfile(ctx *gin.Context) {
+func (s *Service) MyProfile(ctx *gin.Context) {
 	var (
 		tok  *authentication.Token
 		err  error
@@ -304,7 +292,7 @@ func MyProfile(ctx *gin.Context) {
 		return
 	}
 
-	user, err = GetUserWithId(tok.UserId)
+	user, err = s.GetUserWithId(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: err,
@@ -316,7 +304,7 @@ func MyProfile(ctx *gin.Context) {
 	return
 }
 
-func UpdMyProfile(ctx *gin.Context) {
+func (s *Service) UpdMyProfile(ctx *gin.Context) {
 	var (
 		err error
 		tok *authentication.Token
@@ -331,7 +319,7 @@ func UpdMyProfile(ctx *gin.Context) {
 		return
 	}
 
-	usr, err = GetUserWithId(tok.UserId)
+	usr, err = s.GetUserWithId(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.UnAuthorizedError,
@@ -339,7 +327,17 @@ func UpdMyProfile(ctx *gin.Context) {
 		return
 	}
 
-	err = ctx.ShouldBindJSON(&usr)
+	// The fields missing from the body keep their current value.
+	request := ProfileRequest{
+		Name:       usr.Name,
+		FamilyName: usr.FamilyName,
+		NickName:   usr.NickName,
+		Age:        usr.Age,
+		BirthDate:  usr.BirthDate,
+		Sex:        usr.Sex,
+	}
+
+	err = ctx.ShouldBindJSON(&request)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -347,7 +345,14 @@ func UpdMyProfile(ctx *gin.Context) {
 		return
 	}
 
-	err = database.Update(usr)
+	usr.Name = request.Name
+	usr.FamilyName = request.FamilyName
+	usr.NickName = request.NickName
+	usr.Age = request.Age
+	usr.BirthDate = request.BirthDate
+	usr.Sex = request.Sex
+
+	err = s.DB.Update(usr)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -359,7 +364,7 @@ func UpdMyProfile(ctx *gin.Context) {
 	return
 }
 
-func Login(ctx *gin.Context) {
+func (s *Service) Login(ctx *gin.Context) {
 	var (
 		err  error
 		usr  User
@@ -371,25 +376,106 @@ func Login(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.ParseError,
 		})
+		return
 	}
 
 	// GET USER DATA
-	usr, err = GetUserByEmail(auth.Email)
+	usr, err = s.GetUserByEmail(auth.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	// Locked or throttled attempts are rejected before any password hash is computed.
+	attemptId, wait, err := s.lockouts.ReserveAttempt(ctx.Request.Context(), usr.Id, ctx.ClientIP())
+	if errors.Is(err, lockout.ErrLocked) || errors.Is(err, lockout.ErrTooSoon) {
+		ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, utils.ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	if usr.Id == state.ZERO {
+		err = s.lockouts.RecordFailure(state.ZERO, ctx.ClientIP())
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbInsertError,
+			})
+			return
+		}
+
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.UnknownUserError,
 		})
 		return
 	}
 
-	if !password.IsPasswordValid(usr.Id, auth.Password) {
+	if !s.passwords.IsPasswordValid(usr.Id, auth.Password) {
+		err = s.lockouts.RecordFailure(usr.Id, ctx.ClientIP())
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbInsertError,
+			})
+			return
+		}
+
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.IncorrectPassword,
 		})
 		return
 	}
 
-	tokenStr, err := authentication.GetTokenString(usr.Id)
+	// The failures are only cleared once the second factor is completed as well.
+	if s.twoFactor.IsEnabled(usr.Id) {
+		err = s.lockouts.Release(attemptId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbDeleteError,
+			})
+			return
+		}
+
+		challenge, err := s.auth.NewTwoFactorChallenge(usr.Id)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.Lambda(err),
+			})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
+		return
+	}
+
+	err = s.lockouts.RecordSuccess(attemptId, usr.Id)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	tokenStr, session, err := s.auth.GetTokenString(ctx, usr.Id)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	refreshStr, err := s.auth.GetRefreshTokenString(session)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -398,13 +484,100 @@ func Login(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"token": tokenStr,
+		"token":         tokenStr,
+		"refresh_token": refreshStr,
 	})
 
 	return
 }
 
-func NewPassword(ctx *gin.Context) {
+// LoginTwoFactor completes a login started with Login for a user with two factor authentication enabled.
+// The code is either a TOTP code or a recovery code.
+func (s *Service) LoginTwoFactor(ctx *gin.Context) {
+	var (
+		err     error
+		userId  uint
+		request TwoFactorLoginRequest
+	)
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	userId, err = s.auth.ParseTwoFactorChallenge(request.ChallengeToken)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.InvalidTwoFactorChallenge,
+		})
+		return
+	}
+
+	attemptId, wait, err := s.lockouts.ReserveAttempt(ctx.Request.Context(), userId, ctx.ClientIP())
+	if errors.Is(err, lockout.ErrLocked) || errors.Is(err, lockout.ErrTooSoon) {
+		ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, utils.ErrorResponse{
+			Message: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	err = s.twoFactor.Verify(userId, request.Code)
+	if err != nil {
+		err = s.lockouts.RecordFailure(userId, ctx.ClientIP())
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.DbInsertError,
+			})
+			return
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidTwoFactorCodeError,
+		})
+		return
+	}
+
+	err = s.lockouts.RecordSuccess(attemptId, userId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	tokenStr, session, err := s.auth.GetTokenString(ctx, userId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	refreshStr, err := s.auth.GetRefreshTokenString(session)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":         tokenStr,
+		"refresh_token": refreshStr,
+	})
+}
+
+func (s *Service) NewPassword(ctx *gin.Context) {
 	var (
 		pass password.Password
 		err  error
@@ -428,15 +601,15 @@ func NewPassword(ctx *gin.Context) {
 		return
 	}
 
-	err = password.CreatePassword(tok.UserId, pass)
+	err = s.passwords.CreatePassword(tok.UserId, pass)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: err,
+			Message: password.ErrorMessage(err),
 		})
 		return
 	}
 
-	usr, err = GetUserWithId(tok.UserId)
+	usr, err = s.GetUserWithId(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -446,7 +619,7 @@ func NewPassword(ctx *gin.Context) {
 
 	if usr.Status < StatusOnboardingInProgress {
 		usr.Status = StatusOnboardingInProgress
-		err = database.Update(usr)
+		err = s.DB.Update(usr)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 				Message: errx.Lambda(err),
@@ -459,9 +632,12 @@ func NewPassword(ctx *gin.Context) {
 	return
 }
 
-func GetPasswordHistory(ctx *gin.Context) {
+// GetPasswordHistory lists when the user changed their password, most recent first, without the hashes. See
+// query.Query for the parameters.
+func (s *Service) GetPasswordHistory(ctx *gin.Context) {
 	var (
-		passwords []password.Password
+		q         query.Query
+		passwords query.Page[password.PasswordChange]
 		tok       *authentication.Token
 		err       error
 	)
@@ -473,11 +649,16 @@ func GetPasswordHistory(ctx *gin.Context) {
 		})
 		return
 	}
-	err = database.GetMany(&passwords,
-		`SELECT password.*
-			FROM password
-			WHERE password.user_id = ?
-			ORDER BY password.created_at DESC`, tok.UserId)
+
+	q, err = query.Parse(ctx, passwordHistorySpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	passwords, err = query.List[password.PasswordChange](s.DB, q, "password", "password.user_id = ?", tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.DbGetError,
@@ -488,7 +669,7 @@ func GetPasswordHistory(ctx *gin.Context) {
 	ctx.AbortWithStatusJSON(http.StatusOK, passwords)
 }
 
-func ActivateUser(ctx *gin.Context) {
+func (s *Service) ActivateUser(ctx *gin.Context) {
 	var (
 		tok *authentication.Token
 		err error
@@ -503,7 +684,7 @@ func ActivateUser(ctx *gin.Context) {
 		return
 	}
 
-	usr, err = GetUserWithId(tok.UserId)
+	usr, err = s.GetUserWithId(tok.UserId)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -524,7 +705,7 @@ func ActivateUser(ctx *gin.Context) {
 	return
 }
 
-func RegisterByEmail(ctx *gin.Context) {
+func (s *Service) RegisterByEmail(ctx *gin.Context) {
 	var (
 		user User
 		err  error
@@ -538,6 +719,14 @@ func RegisterByEmail(ctx *gin.Context) {
 		return
 	}
 	user.Email = ctx.Param("email")
+	s.register(ctx, user, authorizationLevel)
+}
+
+// register checks the email and the level of a new account, creates it and answers with its tokens. It is shared
+// by Register and RegisterByEmail, which only differ in where they read the user from.
+func (s *Service) register(ctx *gin.Context, user User, level int) {
+	var err error
+
 	if !utils.IsValidEmail(user.Email) {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.InvalidEmailError,
@@ -545,7 +734,7 @@ func RegisterByEmail(ctx *gin.Context) {
 		return
 	}
 
-	_, err = GetUserByEmail(user.Email)
+	existing, err := s.GetUserByEmail(user.Email)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -553,13 +742,20 @@ func RegisterByEmail(ctx *gin.Context) {
 		return
 	}
 
-	if user.Id > state.ZERO {
+	if existing.Id > state.ZERO {
 		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
 			Message: errx.DuplicateUserError,
 		})
 		return
 	}
 
+	if !authorization.IsSelfAssignableLevel(uint(level)) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, utils.ErrorResponse{
+			Message: errx.InvalidRoleError,
+		})
+		return
+	}
+
 	user.Matricule, err = utils.GenerateMatricule()
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
@@ -576,23 +772,22 @@ func RegisterByEmail(ctx *gin.Context) {
 		user.NickName = user.Matricule
 	}
 
-	user.Id, err = database.InsertOne(user)
-	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.DbInsertError,
+	// The unique index on user.email settles concurrent registrations the lookup above let through.
+	user.Id, err = s.CreateUser(ctx.Request.Context(), user, uint(level))
+	if database.IsDuplicate(err) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, utils.ErrorResponse{
+			Message: errx.DuplicateUserError,
 		})
 		return
 	}
-
-	err = authorization.NewUserAuthorization(user.Id, uint(authorizationLevel))
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
-			Message: errx.Lambda(err),
+			Message: errx.DbInsertError,
 		})
 		return
 	}
 
-	tokenStr, err := authentication.GetTokenString(user.Id)
+	tokenStr, session, err := s.auth.GetTokenString(ctx, user.Id)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -600,7 +795,7 @@ func RegisterByEmail(ctx *gin.Context) {
 		return
 	}
 
-	err = code.NewUserVerificationCode(user.Id)
+	refreshStr, err := s.auth.GetRefreshTokenString(session)
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
 			Message: errx.Lambda(err),
@@ -609,9 +804,9 @@ func RegisterByEmail(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"token": tokenStr,
+		"token":         tokenStr,
+		"refresh_token": refreshStr,
 	})
-	return
 }
 
 /*
@@ -620,8 +815,8 @@ func RegisterByEmail(ctx *gin.Context) {
 
 */
 
-func GetUserByEmail(email string) (user User, err error) {
-	err = database.Get(&user, `SELECT * FROM user WHERE email = ?`, email)
+func (s *Service) GetUserByEmail(email string) (user User, err error) {
+	err = s.DB.Get(&user, `SELECT * FROM user WHERE email = ? AND `+database.NotDeleted("user"), email)
 	if err != nil {
 		return user, err
 	}
@@ -629,11 +824,66 @@ func GetUserByEmail(email string) (user User, err error) {
 	return user, err
 }
 
-func GetUserWithId(id uint) (user User, err error) {
-	err = database.Get(&user, `SELECT * FROM user WHERE id = ?`, id)
+func (s *Service) GetUserWithId(id uint) (user User, err error) {
+	err = s.DB.Get(&user, `SELECT * FROM user WHERE id = ? AND `+database.NotDeleted("user"), id)
 	if err != nil {
 		return user, err
 	}
 
 	return user, err
 }
+
+// CreateUser inserts the user with its first authorization. The verification email is sent by the outbox once
+// both are committed.
+func (s *Service) CreateUser(ctx context.Context, user User, authorizationLevel uint) (userId uint, err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		userId, err = database.InsertOneTx(tx, user)
+		if err != nil {
+			return err
+		}
+
+		err = authorization.NewUserAuthorizationTx(tx, userId, authorizationLevel)
+		if err != nil {
+			return err
+		}
+
+		err = s.Outbox.Enqueue(tx, outbox.EventUserRegistered, outbox.UserRegistered{UserId: userId})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return userId, err
+}
+
+// sendRegistrationVerification is the outbox handler mailing the first verification code of a new user.
+func (s *Service) sendRegistrationVerification(event outbox.OutboxEvent) (err error) {
+	var registered outbox.UserRegistered
+
+	err = event.Decode(&registered)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.GetUserWithId(registered.UserId)
+	if err != nil {
+		return err
+	}
+
+	return s.SendVerificationCode(user)
+}
+
+// SendVerificationCode issues a new email verification code and mails it to the user.
+func (s *Service) SendVerificationCode(user User) (err error) {
+	verificationCode, err := s.codes.NewUserVerificationCode(user.Id)
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendTemplate(s.Mailer, user.Email, mailer.TemplateVerification, mailer.VerificationData{
+		Name:      user.Name,
+		Code:      verificationCode.String(),
+		ExpiresIn: s.Config.VerificationCodeLifeTime(),
+	})
+}
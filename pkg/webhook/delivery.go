@@ -0,0 +1,303 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"peec/database"
+	"peec/internal/outbox"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Headers of a webhook request. SignatureHeader holds "sha256=" followed by the hex HMAC-SHA256 of the body,
+// keyed with the secret of the webhook.
+const (
+	EventHeader     = "X-Peec-Event"
+	DeliveryHeader  = "X-Peec-Delivery"
+	SignatureHeader = "X-Peec-Signature"
+)
+
+// Delivery states of a webhook request.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	maxErrorLength = 1000
+)
+
+var client = &http.Client{Timeout: requestTimeout}
+
+// WebhookDelivery logs the requests made for one event to one webhook. Retries go through the outbox, with its
+// exponential backoff.
+type WebhookDelivery struct {
+	Id             uint       `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at"`
+	WebhookId      uint       `json:"webhook_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+// Body is the json document posted to the webhook.
+type Body struct {
+	Id        uint            `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+var deliverySpec = query.Spec{
+	Table:       "webhook_delivery",
+	Sorts:       []string{"created_at"},
+	Filters:     []string{"event_type", "status", "response_status"},
+	DefaultSort: "-id",
+}
+
+/*
+
+	ROUTES
+
+*/
+
+// GetDeliveries lists the deliveries of a webhook, most recent first. See query.Query for the parameters.
+func (s *Service) GetDeliveries(ctx *gin.Context) {
+	var (
+		err        error
+		q          query.Query
+		deliveries query.Page[WebhookDelivery]
+	)
+
+	webhookId, err := strconv.Atoi(ctx.Param("webhook_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	q, err = query.Parse(ctx, deliverySpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	deliveries, err = query.List[WebhookDelivery](s.DB, q, "webhook_delivery", "webhook_delivery.webhook_id = ?", webhookId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+// Redeliver sends the event of a past delivery again, as a new delivery.
+func (s *Service) Redeliver(ctx *gin.Context) {
+	var delivery WebhookDelivery
+
+	deliveryId, err := strconv.Atoi(ctx.Param("delivery_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = s.DB.Get(&delivery, `SELECT * FROM webhook_delivery WHERE id = ? AND `+database.NotDeleted("webhook_delivery"), deliveryId)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownWebhookDeliveryError,
+		})
+		return
+	}
+
+	delivery, err = s.newDeliveries(ctx.Request.Context(), []WebhookDelivery{{
+		WebhookId: delivery.WebhookId,
+		EventType: delivery.EventType,
+		Payload:   delivery.Payload,
+	}})
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, delivery)
+}
+
+/*
+
+	UTILS
+
+*/
+
+// fanOut is the outbox handler creating one delivery per webhook subscribed to the event.
+func (s *Service) fanOut(event outbox.OutboxEvent) (err error) {
+	var (
+		webhooks   []Webhook
+		deliveries []WebhookDelivery
+	)
+
+	err = s.DB.Select(&webhooks, `SELECT * FROM webhook WHERE is_active = true AND `+database.NotDeleted("webhook"))
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event.Type) {
+			continue
+		}
+
+		deliveries = append(deliveries, WebhookDelivery{
+			WebhookId: webhook.Id,
+			EventType: event.Type,
+			Payload:   event.Payload,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	_, err = s.newDeliveries(context.Background(), deliveries)
+	return err
+}
+
+// newDeliveries inserts the deliveries along with the events sending them, and returns the last one.
+func (s *Service) newDeliveries(ctx context.Context, deliveries []WebhookDelivery) (last WebhookDelivery, err error) {
+	err = s.DB.WithTx(ctx, func(tx *sqlx.Tx) error {
+		for _, delivery := range deliveries {
+			delivery.Status = DeliveryPending
+			delivery.CreatedAt = time.Now().UTC()
+
+			delivery.Id, err = database.InsertOneTx(tx, delivery)
+			if err != nil {
+				return err
+			}
+
+			err = s.Outbox.Enqueue(tx, outbox.EventWebhookDelivery, outbox.WebhookDelivery{DeliveryId: delivery.Id})
+			if err != nil {
+				return err
+			}
+
+			last = delivery
+		}
+
+		return nil
+	})
+	return last, err
+}
+
+// send is the outbox handler posting a delivery to its webhook. An error makes the outbox retry it later.
+func (s *Service) send(event outbox.OutboxEvent) (err error) {
+	var (
+		queued   outbox.WebhookDelivery
+		delivery WebhookDelivery
+	)
+
+	err = event.Decode(&queued)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.Get(&delivery, `SELECT * FROM webhook_delivery WHERE id = ? AND `+database.NotDeleted("webhook_delivery"), queued.DeliveryId)
+	if err != nil {
+		return err
+	}
+
+	webhook, err := s.GetWebhook(delivery.WebhookId)
+	if err != nil || !webhook.IsActive {
+		// Removed or disabled since: there is nobody left to retry for.
+		return s.DB.Exec(`UPDATE webhook_delivery SET status = ?, last_error = 'webhook removed or disabled',
+				updated_at = CURRENT_TIMESTAMP WHERE id = ?`, DeliveryFailed, delivery.Id)
+	}
+
+	responseStatus, err := post(webhook, delivery)
+	if err != nil {
+		message := err.Error()
+		if len(message) > maxErrorLength {
+			message = message[:maxErrorLength]
+		}
+
+		logErr := s.DB.Exec(`UPDATE webhook_delivery SET status = ?, attempts = attempts + 1, response_status = ?,
+				last_error = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, DeliveryFailed, responseStatus, message, delivery.Id)
+		if logErr != nil {
+			return logErr
+		}
+		return err
+	}
+
+	return s.DB.Exec(`UPDATE webhook_delivery SET status = ?, attempts = attempts + 1, response_status = ?, last_error = '',
+				delivered_at = UTC_TIMESTAMP(), updated_at = CURRENT_TIMESTAMP WHERE id = ?`, DeliveryDelivered, responseStatus, delivery.Id)
+}
+
+// post makes the signed request. Any status but 2xx is an error.
+func post(webhook Webhook, delivery WebhookDelivery) (responseStatus int, err error) {
+	body, err := json.Marshal(Body{
+		Id:        delivery.Id,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      json.RawMessage(delivery.Payload),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Peec-Webhook")
+	request.Header.Set(EventHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, strconv.Itoa(int(delivery.Id)))
+	request.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("webhook answered %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body, the value receivers recompute to check SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
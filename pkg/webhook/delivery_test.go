@@ -0,0 +1,360 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"peec/database"
+	"peec/internal/app"
+	"peec/internal/configuration"
+	"peec/internal/outbox"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/gin-gonic/gin"
+	"github.com/iancoleman/strcase"
+	"github.com/jmoiron/sqlx"
+)
+
+const testSecret = "s3cr3t"
+
+// received is a request the test receiver got.
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver starts an httptest server answering status and recording the requests it gets.
+func receiver(t *testing.T, status int) (server *httptest.Server, requests chan received) {
+	requests = make(chan received, 8)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// newTestService returns a service over a fake database holding an active webhook posting to url and a pending
+// delivery of it.
+func newTestService(t *testing.T, url string) (s *Service, store *fakeStore) {
+	store = &fakeStore{tables: map[string][]map[string]driver.Value{}}
+	store.seed("webhook", Webhook{Id: 1, UserId: 1, Url: url, Secret: testSecret, EventTypes: outbox.EventPostPublished, IsActive: true})
+	store.seed("webhook_delivery", WebhookDelivery{Id: 1, CreatedAt: time.Now().UTC(), WebhookId: 1, EventType: outbox.EventPostPublished,
+		Payload: `{"post_id":7}`, Status: DeliveryPending})
+
+	client := sqlx.NewDb(sql.OpenDB(fakeConnector{store: store}), "mysql")
+	client.MapperFunc(strcase.ToSnake)
+	t.Cleanup(func() { client.Close() })
+
+	db := &database.DB{Client: client}
+	return NewService(&app.App{DB: db, Outbox: outbox.New(db, configuration.Outbox{})}), store
+}
+
+func deliveryEvent(t *testing.T, deliveryId uint) outbox.OutboxEvent {
+	payload, err := json.Marshal(outbox.WebhookDelivery{DeliveryId: deliveryId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outbox.OutboxEvent{Id: 1, Type: outbox.EventWebhookDelivery, Payload: string(payload)}
+}
+
+func TestSendSignsTheBody(t *testing.T) {
+	server, requests := receiver(t, http.StatusOK)
+	s, _ := newTestService(t, server.URL)
+
+	err := s.send(deliveryEvent(t, 1))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	request := <-requests
+	if got, want := request.header.Get(SignatureHeader), "sha256="+Sign(testSecret, request.body); got != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+	if got := request.header.Get(SignatureHeader); got == "sha256="+Sign("another secret", request.body) {
+		t.Errorf("%s does not depend on the secret", SignatureHeader)
+	}
+	if got := request.header.Get(EventHeader); got != outbox.EventPostPublished {
+		t.Errorf("%s = %q, want %q", EventHeader, got, outbox.EventPostPublished)
+	}
+	if got := request.header.Get(DeliveryHeader); got != "1" {
+		t.Errorf("%s = %q, want 1", DeliveryHeader, got)
+	}
+
+	var body Body
+	err = json.Unmarshal(request.body, &body)
+	if err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if body.Id != 1 || body.Type != outbox.EventPostPublished || string(body.Data) != `{"post_id":7}` {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestSendMarksSuccessfulDeliveryDelivered(t *testing.T) {
+	server, _ := receiver(t, http.StatusNoContent)
+	s, store := newTestService(t, server.URL)
+
+	err := s.send(deliveryEvent(t, 1))
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	args := store.lastUpdate(t, "webhook_delivery")
+	if args[0] != DeliveryDelivered || args[1] != int64(http.StatusNoContent) || args[len(args)-1] != int64(1) {
+		t.Errorf("update args = %v, want delivered with 204 for delivery 1", args)
+	}
+}
+
+func TestSendRecordsFailureAndLeavesRetryToOutbox(t *testing.T) {
+	server, _ := receiver(t, http.StatusInternalServerError)
+	s, store := newTestService(t, server.URL)
+
+	err := s.send(deliveryEvent(t, 1))
+	if err == nil {
+		t.Fatal("send succeeded on a 500, the outbox would not retry it")
+	}
+
+	args := store.lastUpdate(t, "webhook_delivery")
+	if args[0] != DeliveryFailed || args[1] != int64(http.StatusInternalServerError) || args[len(args)-1] != int64(1) {
+		t.Errorf("update args = %v, want failed with 500 for delivery 1", args)
+	}
+	if message, _ := args[2].(string); !strings.Contains(message, "500") {
+		t.Errorf("last_error = %q, want the status", message)
+	}
+}
+
+func TestRedeliverSendsTheEventAgain(t *testing.T) {
+	server, requests := receiver(t, http.StatusOK)
+	s, store := newTestService(t, server.URL)
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	ctx.Params = gin.Params{{Key: "delivery_id", Value: "1"}}
+
+	s.Redeliver(ctx)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	var delivery WebhookDelivery
+	err := json.Unmarshal(recorder.Body.Bytes(), &delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Id == 1 || delivery.Status != DeliveryPending || delivery.WebhookId != 1 || delivery.Payload != `{"post_id":7}` {
+		t.Fatalf("redelivery = %+v, want a new pending delivery of the same event", delivery)
+	}
+
+	events := store.rows("outbox_event")
+	if len(events) != 1 || events[0]["type"] != outbox.EventWebhookDelivery {
+		t.Fatalf("outbox events = %v, want one %s", events, outbox.EventWebhookDelivery)
+	}
+
+	err = s.send(outbox.OutboxEvent{Id: 2, Type: outbox.EventWebhookDelivery, Payload: events[0]["payload"].(string)})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	request := <-requests
+	if got, want := request.header.Get(DeliveryHeader), strconv.Itoa(int(delivery.Id)); got != want {
+		t.Errorf("%s = %q, want %q", DeliveryHeader, got, want)
+	}
+	if got, want := request.header.Get(SignatureHeader), "sha256="+Sign(testSecret, request.body); got != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, got, want)
+	}
+}
+
+/*
+
+	FAKE DATABASE
+
+*/
+
+// fakeStore is the database behind the fake driver. It knows just enough SQL for the delivery code: selects by id,
+// inserts with a column list, and any other statement, which it records.
+type fakeStore struct {
+	mutex  sync.Mutex
+	tables map[string][]map[string]driver.Value
+	execs  []fakeExec
+	lastId int64
+}
+
+type fakeExec struct {
+	query string
+	args  []driver.Value
+}
+
+// seed stores v as a row of table, leaving out the nil pointers and zero times as the database would hold NULL.
+func (store *fakeStore) seed(table string, v any) {
+	row := map[string]driver.Value{}
+	for _, field := range structs.New(v).Fields() {
+		value := reflect.ValueOf(field.Value())
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		if t, ok := value.Interface().(time.Time); ok && t.IsZero() {
+			continue
+		}
+
+		converted, err := driver.DefaultParameterConverter.ConvertValue(value.Interface())
+		if err != nil {
+			panic(err)
+		}
+		row[strcase.ToSnake(field.Name())] = converted
+	}
+
+	store.tables[table] = append(store.tables[table], row)
+	store.lastId = max(store.lastId, row["id"].(int64))
+}
+
+func (store *fakeStore) rows(table string) []map[string]driver.Value {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.tables[table]
+}
+
+// lastUpdate returns the arguments of the last UPDATE of table.
+func (store *fakeStore) lastUpdate(t *testing.T, table string) []driver.Value {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i := len(store.execs) - 1; i >= 0; i-- {
+		if strings.HasPrefix(strings.ToUpper(store.execs[i].query), "UPDATE "+strings.ToUpper(table)+" ") {
+			return store.execs[i].args
+		}
+	}
+	t.Fatalf("no update of %s", table)
+	return nil
+}
+
+func (store *fakeStore) exec(query string, args []driver.Value) (driver.Result, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	query = strings.Join(strings.Fields(query), " ")
+	store.execs = append(store.execs, fakeExec{query: query, args: args})
+
+	if !strings.HasPrefix(strings.ToLower(query), "insert into ") {
+		return driver.RowsAffected(1), nil
+	}
+
+	// insert into <table> (<columns>) VALUES (<values>)
+	fields := strings.SplitN(query, " ", 4)
+	table := fields[2]
+	start, end := strings.Index(query, "("), strings.Index(query, ")")
+	columns := strings.Split(query[start+1:end], ",")
+	values := query[end+1:]
+	values = values[strings.Index(values, "(")+1 : strings.LastIndex(values, ")")]
+
+	store.lastId++
+	row := map[string]driver.Value{"id": store.lastId}
+	for i, column := range columns {
+		if strings.TrimSpace(strings.Split(values, ",")[i]) == "?" {
+			row[strings.TrimSpace(column)] = args[0]
+			args = args[1:]
+		}
+	}
+	store.tables[table] = append(store.tables[table], row)
+
+	return fakeResult{lastId: store.lastId}, nil
+}
+
+// query answers SELECT * FROM <table> WHERE id = ? ..., the only reads of the delivery code.
+func (store *fakeStore) query(query string, args []driver.Value) (driver.Rows, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	fields := strings.Fields(query)
+	table := fields[3]
+	for _, row := range store.tables[table] {
+		if row["id"] == args[0] {
+			return newFakeRows(row), nil
+		}
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeConnector struct {
+	store *fakeStore
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	store *fakeStore
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{store: c.store, query: query}, nil
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	store *fakeStore
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.store.exec(s.query, args)
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.store.query(s.query, args)
+}
+
+type fakeResult struct {
+	lastId int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastId, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func newFakeRows(row map[string]driver.Value) *fakeRows {
+	rows := &fakeRows{values: [][]driver.Value{{}}}
+	for column, value := range row {
+		rows.columns = append(rows.columns, column)
+		rows.values[0] = append(rows.values[0], value)
+	}
+	return rows
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,310 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"peec/database"
+	"peec/internal/app"
+	"peec/internal/authentication"
+	"peec/internal/outbox"
+	"peec/internal/query"
+	"peec/internal/utils"
+	"peec/internal/utils/errx"
+	"peec/internal/utils/state"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Service manages the webhooks and delivers the domain events to them.
+type Service struct {
+	*app.App
+}
+
+// NewService returns the webhook service, subscribing the delivery of every event to the outbox.
+func NewService(a *app.App) *Service {
+	s := &Service{App: a}
+	for _, kind := range Events {
+		s.Outbox.Subscribe("webhook."+kind, kind, s.fanOut)
+	}
+	s.Outbox.Subscribe("webhook.send", outbox.EventWebhookDelivery, s.send)
+	return s
+}
+
+// Events lists the domain events partners can subscribe to.
+var Events = []string{
+	outbox.EventUserRegistered,
+	outbox.EventUserRated,
+	outbox.EventPlanningCreated,
+	outbox.EventPlanningDeleted,
+	outbox.EventPlanningActorAdded,
+	outbox.EventPlanningActorRemoved,
+	outbox.EventPostPublished,
+}
+
+// Webhook is a partner endpoint receiving the events listed in EventTypes, comma separated. Every request is
+// signed with Secret.
+type Webhook struct {
+	Id         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+	UserId     uint       `json:"user_id"`
+	Url        string     `json:"url"`
+	Secret     string     `json:"-"`
+	EventTypes string     `json:"event_types"`
+	IsActive   bool       `json:"is_active"`
+}
+
+type WebhookRequest struct {
+	Url        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+	IsActive   *bool    `json:"is_active"`
+}
+
+var webhookSpec = query.Spec{
+	Table:   "webhook",
+	Sorts:   []string{"created_at", "url"},
+	Filters: []string{"user_id", "is_active"},
+}
+
+/*
+
+	ROUTES
+
+*/
+
+// NewWebhook registers a partner endpoint. A secret is generated when none is given; it is only returned here.
+func (s *Service) NewWebhook(ctx *gin.Context) {
+	var (
+		tok     *authentication.Token
+		err     error
+		request WebhookRequest
+		webhook Webhook
+	)
+
+	tok, err = authentication.GetTokenDataFromContext(ctx)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.UnAuthorizedError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	if !isValidUrl(request.Url) || !isValidEventTypes(request.EventTypes) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidWebhookError,
+		})
+		return
+	}
+
+	webhook.UserId = tok.UserId
+	webhook.Url = request.Url
+	webhook.EventTypes = strings.Join(request.EventTypes, ",")
+	webhook.IsActive = request.IsActive == nil || *request.IsActive
+	webhook.Secret = request.Secret
+	if webhook.Secret == state.EMPTY {
+		webhook.Secret, err = newSecret()
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+				Message: errx.Lambda(err),
+			})
+			return
+		}
+	}
+
+	webhook.Id, err = s.DB.InsertOne(webhook)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbInsertError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"webhook": webhook,
+		"secret":  webhook.Secret,
+	})
+}
+
+// GetWebhooks lists the webhooks. See query.Query for the parameters.
+func (s *Service) GetWebhooks(ctx *gin.Context) {
+	var (
+		err      error
+		q        query.Query
+		webhooks query.Page[Webhook]
+	)
+
+	q, err = query.Parse(ctx, webhookSpec)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.Lambda(err),
+		})
+		return
+	}
+
+	webhooks, err = query.List[Webhook](s.DB, q, "webhook", "")
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbGetError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhooks)
+}
+
+// UpdateWebhook changes the url, the events or the state of a webhook. Fields left empty are kept, and the secret
+// is only replaced when a new one is given.
+func (s *Service) UpdateWebhook(ctx *gin.Context) {
+	var (
+		err     error
+		request WebhookRequest
+		webhook Webhook
+	)
+
+	webhookId, err := strconv.Atoi(ctx.Param("webhook_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	err = ctx.ShouldBindJSON(&request)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParseError,
+		})
+		return
+	}
+
+	webhook, err = s.GetWebhook(uint(webhookId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownWebhookError,
+		})
+		return
+	}
+
+	if request.Url != state.EMPTY {
+		webhook.Url = request.Url
+	}
+	if request.EventTypes != nil {
+		webhook.EventTypes = strings.Join(request.EventTypes, ",")
+	}
+	if request.Secret != state.EMPTY {
+		webhook.Secret = request.Secret
+	}
+	if request.IsActive != nil {
+		webhook.IsActive = *request.IsActive
+	}
+
+	if !isValidUrl(webhook.Url) || !isValidEventTypes(strings.Split(webhook.EventTypes, ",")) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.InvalidWebhookError,
+		})
+		return
+	}
+
+	err = s.DB.Update(webhook)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbUpdateError,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, webhook)
+}
+
+func (s *Service) RemoveWebhook(ctx *gin.Context) {
+	webhookId, err := strconv.Atoi(ctx.Param("webhook_id"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.ParamsError,
+		})
+		return
+	}
+
+	webhook, err := s.GetWebhook(uint(webhookId))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, utils.ErrorResponse{
+			Message: errx.UnknownWebhookError,
+		})
+		return
+	}
+
+	err = s.DB.Delete(webhook)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, utils.ErrorResponse{
+			Message: errx.DbDeleteError,
+		})
+		return
+	}
+
+	ctx.AbortWithStatus(http.StatusOK)
+}
+
+/*
+
+	UTILS
+
+*/
+
+func (s *Service) GetWebhook(id uint) (webhook Webhook, err error) {
+	err = s.DB.Get(&webhook, `SELECT * FROM webhook WHERE id = ? AND `+database.NotDeleted("webhook"), id)
+	if err != nil {
+		return webhook, err
+	}
+	return webhook, err
+}
+
+// Subscribes tells whether the webhook receives events of kind.
+func (webhook Webhook) Subscribes(kind string) bool {
+	return webhook.IsActive && slices.Contains(strings.Split(webhook.EventTypes, ","), kind)
+}
+
+func newSecret() (secret string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return secret, err
+	}
+	return hex.EncodeToString(b), err
+}
+
+func isValidUrl(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != state.EMPTY
+}
+
+func isValidEventTypes(eventTypes []string) bool {
+	if len(eventTypes) == 0 {
+		return false
+	}
+
+	for _, eventType := range eventTypes {
+		if !slices.Contains(Events, eventType) {
+			return false
+		}
+	}
+	return true
+}